@@ -195,7 +195,7 @@ void MainWindow::on_btnUpload_clicked() {
         QString fname = fullpath.split('/').last();
         QString pathToLoad = ui->lineMyDisk->text();
         if(AddFileRequest(pathToLoad, fname, ui->tableWidget_2->item(i, 1)->text() == "dir" ? true : false, ui->tableWidget_2->item(i, 2)->text().toULongLong())) {
-            UploadFile(ui->tableWidget_2->item(i, 0)->text().toStdString(), (pathToLoad+"/"+fname).toStdString(), "", 0, &v, 1600, 1, ip.toStdString(), ring_sz_up, certificate_token.toStdString());
+            UploadFile(ui->tableWidget_2->item(i, 0)->text().toStdString(), (pathToLoad+"/"+fname).toStdString(), "", 0, &v, 1600, 1, ip.toStdString(), certificate_token.toStdString());
             QMessageBox::information(this, "done", "done");
         } else {
             QMessageBox::information(this, "no", "no");
@@ -534,9 +534,8 @@ int MainWindow::processingDelDir(QJsonObject repBody, int status) {
     if (status == 0) {
         delete_certificate_token = repBody["certificate_token"].toString();
         delete_ip = repBody["ip"].toString();
-        ring_sz_del = repBody["ring_size"].toInt();
         QMessageBox::information(this, "yeah", "");
-        qDebug() << certificate_token << ip << ring_sz_up;
+        qDebug() << certificate_token << ip;
     }
     return 1;
 }
@@ -545,9 +544,8 @@ int MainWindow::processingAddFile(QJsonObject repBody, int status) {
     if (status == 0) {
         certificate_token = repBody["certificate_token"].toString();
         ip = repBody["ip"].toString();
-        ring_sz_up = repBody["ring_size"].toInt();
         QMessageBox::information(this, "yeah", "");
-        qDebug() << certificate_token << ip << ring_sz_up;
+        qDebug() << certificate_token << ip;
     }
     return 1;
 }
@@ -556,10 +554,9 @@ int MainWindow::processingDownloadFile(QJsonObject repBody, int status) {
     if (status == 0) {
         download_certificate_token = repBody["certificate_token"].toString();
         download_ip = repBody["ip"].toString();
-        ring_sz_down = repBody["ring_size"].toInt();
         numshards = repBody["num_shards"].toInt();
         QMessageBox::information(this, "yeah", "");
-        qDebug() << download_certificate_token << download_ip << ring_sz_down << numshards;
+        qDebug() << download_certificate_token << download_ip << numshards;
     }
     return 1;
 }
@@ -821,7 +818,7 @@ void MainWindow::on_btnUpload2_clicked() {
         for (int i = 0; i < ui->tableWidget_4->rowCount(); i++) {
             QString fullpath = ui->tableWidget_4->item(i, 0)->text();
             if(DowloadFileRequet(fullpath)) {
-                download(fullpath.toStdString(), ui->lineMyDisk_6->text().toStdString(), &v, 1, download_ip.toStdString(), ring_sz_down, download_certificate_token.toStdString(), numshards, "", 1600*4096);
+                download(fullpath.toStdString(), ui->lineMyDisk_6->text().toStdString(), &v, 1, download_ip.toStdString(), download_certificate_token.toStdString(), numshards, "", 1600*4096);
                 QMessageBox::information(this, "done", "done");
             } else {
                 QMessageBox::information(this, "no", "no");
@@ -854,6 +851,6 @@ void MainWindow::on_btnForward2_clicked() {//delete
     }
     QString name = currPath+"/"+toDel;
     if (DelDirRequest(name)) {
-        Delete(delete_ip.toStdString(), name.toStdString(), ring_sz_del, delete_certificate_token.toStdString(), numshards_del);
+        Delete(delete_ip.toStdString(), name.toStdString(), delete_certificate_token.toStdString(), numshards_del);
     }
 }
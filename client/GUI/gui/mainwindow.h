@@ -156,7 +156,7 @@ private:
     bool is_authorised = false;
 
     QString certificate_token, ip, download_ip, download_certificate_token, delete_certificate_token, delete_ip;
-    unsigned long ring_sz_down, ring_sz_up, numshards, ring_sz_del, numshards_del;
+    unsigned long numshards, numshards_del;
 
     MyDiskFs FS;
 
@@ -35,8 +35,8 @@ namespace fs = std::filesystem;
 int pow(int bas, int value);
 std::string getName(const std::string& name, int pos, int nSym);
 int getNumPieces(unsigned long long size, int mode);
-int shardFile(const std::string &filename, std::string name, visFuncs* vis, unsigned long long shardLength, std::string ip, unsigned long ringsz, std::string JWT);
-int UploadFile(const std::string& filename, std::string name, const std::string& suff, bool remove, visFuncs* vis, unsigned long long shardLength, int method, std::string ip, unsigned long ringsz, std::string JWT);
+int shardFile(const std::string &filename, std::string name, visFuncs* vis, unsigned long long shardLength, std::string ip, std::string JWT);
+int UploadFile(const std::string& filename, std::string name, const std::string& suff, bool remove, visFuncs* vis, unsigned long long shardLength, int method, std::string ip, std::string JWT);
 std::string ZIPFunc(const fs::path& filename, int method);
 
 //zip funcs
@@ -45,8 +45,8 @@ std::string Pbzip2(const std::string& filename);
 
 
 //download
-int download(const std::string& filename, const std::string& path, visFuncs* vis, int method, std::string ip, unsigned long ringsz, std::string JWT, unsigned long nshards, std::string suff, unsigned long size);
-int Merge(std::vector<std::string>& shards, const std::string& filename, const std::string& path, visFuncs* vis, std::string ip, unsigned long ringsz, std::string JWT, std::string suff, unsigned long size);
+int download(const std::string& filename, const std::string& path, visFuncs* vis, int method, std::string ip, std::string JWT, unsigned long nshards, std::string suff, unsigned long size);
+int Merge(std::vector<std::string>& shards, const std::string& filename, const std::string& path, visFuncs* vis, std::string ip, std::string JWT, std::string suff, unsigned long size);
 int unZIPFunc(const std::string& filename, const std::string& path, int method, visFuncs*);
 void GetNames(const std::string& filename, std::vector<std::string>& shards, unsigned long nshards);
 
@@ -60,4 +60,4 @@ int RemoveFile(const std::string& filename);
 
 
 //delete
-int Delete(std::string ip, std::string filename, unsigned long ringsz, std::string JWT, unsigned long nshards);
\ No newline at end of file
+int Delete(std::string ip, std::string filename, std::string JWT, unsigned long nshards);
\ No newline at end of file
@@ -1,13 +1,13 @@
 #include "../include/duload.h"
 
-int Delete(std::string ip, std::string filename, unsigned long ringsz, std::string JWT, unsigned long nshards) {
+int Delete(std::string ip, std::string filename, std::string JWT, unsigned long nshards) {
 
     GoString IP = {ip.c_str(), ip.length()};
     GoString dJWT = {JWT.c_str(), JWT.length()};
 
     GoString codename = {(filename+"_KEY").c_str(), (filename+"_KEY").length()};
     //deleting codes
-    DeleteFileRSC(IP, codename, ringsz, dJWT);
+    DeleteFileRSC(IP, codename, dJWT);
     std::vector<std::string> shards;
     GetNames(filename, shards, nshards);
 
@@ -15,7 +15,7 @@ int Delete(std::string ip, std::string filename, unsigned long ringsz, std::stri
         std::string currName = shards[i];
 
         GoString Name = {currName.c_str(), currName.length()};
-        DeleteFileRSC(IP, Name, ringsz, dJWT);
+        DeleteFileRSC(IP, Name, dJWT);
 
     }
 }
\ No newline at end of file
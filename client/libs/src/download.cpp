@@ -8,12 +8,12 @@ void GetNames(const std::string& filename, std::vector<std::string>& shards, uns
     }
 }
 
-int download(const std::string& filename, const std::string& path, visFuncs* vis, int method, std::string ip, unsigned long ringsz, std::string JWT, unsigned long nshards, std::string suff, unsigned long size) {
+int download(const std::string& filename, const std::string& path, visFuncs* vis, int method, std::string ip, std::string JWT, unsigned long nshards, std::string suff, unsigned long size) {
     std::vector<std::string> shards;
     GetNames(filename, shards, nshards);
     std::string zipname = path + "/download_crowd";
     vis->Begin1(filename);
-    int res = Merge(shards, zipname, path, vis, ip, ringsz, JWT, suff, size);
+    int res = Merge(shards, zipname, path, vis, ip, JWT, suff, size);
     vis->End1(filename);
     if (res > 0) {
         zipname += ".tar.gz";
@@ -28,7 +28,7 @@ int download(const std::string& filename, const std::string& path, visFuncs* vis
 }
 
 //merging chunks into file
-int Merge(std::vector<std::string>& shards, const std::string& filename, const std::string& path, visFuncs* vis, std::string ip, unsigned long ringsz, std::string JWT, std::string suff, unsigned long size) {
+int Merge(std::vector<std::string>& shards, const std::string& filename, const std::string& path, visFuncs* vis, std::string ip, std::string JWT, std::string suff, unsigned long size) {
     off_t curr_pt = 0;
     int current = 0, show = 0;
     int mode = 0666;
@@ -50,7 +50,7 @@ int Merge(std::vector<std::string>& shards, const std::string& filename, const s
     GoString codename = {(filename+"_KEY").c_str(), (filename+"_KEY").length()};
 
     //getting code
-    //DownloadFileRSC(IP, codename, ringsz, buff, rJWT);
+    //DownloadFileRSC(IP, codename, buff, rJWT);
     //XORcypher decoder(size, (char*)buff.data);
 
     //opening result file
@@ -67,7 +67,7 @@ int Merge(std::vector<std::string>& shards, const std::string& filename, const s
         char *dst;
         //mmapping chunk
 
-        GoInt remainingSpace = DownloadFileRSC(IP, fname, ringsz, buff, rJWT);
+        GoInt remainingSpace = DownloadFileRSC(IP, fname, buff, rJWT);
 
         //making offset in result file
         if (lseek (fdout, curr_pt + (size-remainingSpace) - 1, SEEK_SET) == -1) {
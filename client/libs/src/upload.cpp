@@ -9,7 +9,7 @@ int getNumPieces(unsigned long long size, int mode) {
 
 
 //deviding into chunks
-int shardFile(const std::string &filename, std::string Name, visFuncs* vis, unsigned long long shardLength, std::string ip, unsigned long ringsz, std::string JWT) {
+int shardFile(const std::string &filename, std::string Name, visFuncs* vis, unsigned long long shardLength, std::string ip, std::string JWT) {
     vis->SetField();
     int show = 0, current = 0;
 
@@ -62,7 +62,7 @@ int shardFile(const std::string &filename, std::string Name, visFuncs* vis, unsi
     GoString codename = {(Name+"_KEY").c_str(), (Name+"_KEY").length()};
 
     //sending code
-    //UploadFileRSC(IP, codename, ringsz, code, wJWT);
+    //UploadFileRSC(IP, codename, code, wJWT);
 
     
     for (int i = 0; i < num; i++) {
@@ -93,7 +93,7 @@ int shardFile(const std::string &filename, std::string Name, visFuncs* vis, unsi
             cap: curr_size
         };
 
-        UploadFileRSC(IP, fname, ringsz, fcontent_clice, wJWT);
+        UploadFileRSC(IP, fname, fcontent_clice, wJWT);
 
         munmap(src, curr_size);
 
@@ -188,7 +188,7 @@ void RollDir(const std::string&) {
     return;
 }
 
-int UploadFile(const std::string& filename, std::string name, const std::string& suff, bool remove, visFuncs* vis, unsigned long long shardLength, int method, std::string ip, unsigned long ringsz, std::string JWT) { //zero if fail, else 1
+int UploadFile(const std::string& filename, std::string name, const std::string& suff, bool remove, visFuncs* vis, unsigned long long shardLength, int method, std::string ip, std::string JWT) { //zero if fail, else 1
     bool isDir = false;
     vis->Begin2(filename);
     fs::path file(filename);
@@ -210,7 +210,7 @@ int UploadFile(const std::string& filename, std::string name, const std::string&
     vis->End2(filename);
 
     //chunking
-    int result = shardFile(ZipedFile, name, vis, shardLength, ip, ringsz, JWT);
+    int result = shardFile(ZipedFile, name, vis, shardLength, ip, JWT);
     //std::cout << ZipedFile << "\n";
 
     //removing temp files
@@ -4,7 +4,7 @@ from flask import Blueprint, request, make_response, jsonify
 from flask.views import MethodView
 
 from project.server import bcrypt, db
-from project.server.models import User, BlacklistToken, Сertificate, File, Node
+from project.server.models import User, BlacklistToken, Сertificate, File, Node, certificate_jwks
 
 import json
 from functools import reduce  # forward compatibility for Python 3
@@ -288,7 +288,7 @@ class RequestAPI(MethodView):
                 raise ValueError({'status': 1, 'message': 'There is no nodes in the ring!'}, 400)
 
             n_shards = (item["Size"] // self.shard_size) * self.num_mini_shards + math.ceil((item["Size"] % self.shard_size) / self.mini_shard_size)
-            certificate = Сertificate(user_id=self.user_id, mini_shard_size=self.mini_shard_size, shards=n_shards, act=1, file_name=name)
+            certificate = Сertificate(user_id=self.user_id, file_size=item["Size"], shards=n_shards, act=1, file_name=name)
             new_file = File(user_id=self.user_id, file_name=name, file_size=item["Size"], n_shards=n_shards, initial_ip=random_ip.ip_address)
                     
             ring_size = Node.query.count()
@@ -438,7 +438,7 @@ class RequestAPI(MethodView):
                             'email': self.post_data.get('email'),
                             'body': {}
                         }
-                        certificate = Сertificate(user_id=self.user_id, mini_shard_size=self.mini_shard_size, shards=exist_file.total_shards, act=0, file_name=exist_file.file_name)
+                        certificate = Сertificate(user_id=self.user_id, file_size=exist_file.file_size, shards=exist_file.total_shards, act=0, file_name=exist_file.file_name)
                         ring_size = Node.query.count()
                         if certificate:
                             responseObject['body'] = {
@@ -513,6 +513,15 @@ class NodeActionAPI(MethodView):
             return make_response(jsonify({'status': 1, 'message': e})), 200
 
 
+class JWKSAPI(MethodView):
+    """
+    Public keys of certificates, nodes load them with -jwks
+    """
+
+    def get(self):
+        return make_response(jsonify(certificate_jwks())), 200
+
+
 class AddNodeAPI(MethodView):
     """
     Add Node Resource
@@ -653,8 +662,8 @@ class FileRebuildAPI(MethodView):
                 upload = []
                 download = []
                 for File in files:
-                    certificate_upload = Сertificate(user_id=delete_data.get('user_id'), mini_shard_size=self.mini_shard_size, shards=File.total_shards, act=1, file_name=File.file_name)
-                    certificate_download = Сertificate(user_id=delete_data.get('user_id'), mini_shard_size=self.mini_shard_size, shards=File.total_shards, act=0, file_name=File.file_name)
+                    certificate_upload = Сertificate(user_id=delete_data.get('user_id'), file_size=File.file_size, shards=File.total_shards, act=1, file_name=File.file_name)
+                    certificate_download = Сertificate(user_id=delete_data.get('user_id'), file_size=File.file_size, shards=File.total_shards, act=0, file_name=File.file_name)
                     db.session.add(certificate_upload)
                     db.session.add(certificate_download)
                     upload.append(certificate_upload.token)
@@ -691,6 +700,7 @@ user_view = UserAPI.as_view('user_api')
 logout_view = LogoutAPI.as_view('logout_api')
 request_view = RequestAPI.as_view('request_api')
 action_view = NodeActionAPI.as_view('action_api')
+jwks_view = JWKSAPI.as_view('jwks_api')
 add_node_view = AddNodeAPI.as_view('add_node_api')
 delete_node_view = DeleteNodeAPI.as_view('delete_node_api')
 rebuild_view = FileRebuildAPI.as_view('rebuild_node_api')
@@ -726,6 +736,11 @@ auth_blueprint.add_url_rule(
     view_func=action_view,
     methods=['POST']
 )
+auth_blueprint.add_url_rule(
+    '/auth/jwks',
+    view_func=jwks_view,
+    methods=['GET']
+)
 auth_blueprint.add_url_rule(
     '/auth/node/add',
     view_func=add_node_view,
@@ -9,6 +9,9 @@ database_name = 'flask_jwt_auth'
 class BaseConfig:
     """Base configuration."""
     SECRET_KEY = os.getenv('SECRET_KEY', 'my_precious')
+    # RSA key that signs certificates, nodes get its public part from /auth/jwks
+    CERTIFICATE_KEY_FILE = os.getenv('CERTIFICATE_KEY_FILE', os.path.join(basedir, 'certificate_key.pem'))
+    CERTIFICATE_KEY_ID = os.getenv('CERTIFICATE_KEY_ID', 'auth')
     DEBUG = False
     BCRYPT_LOG_ROUNDS = 13
     SQLALCHEMY_TRACK_MODIFICATIONS = False
@@ -1,11 +1,67 @@
 # project/server/models.py
 
+import base64
 import datetime
 import jwt # for encode_auth_token method in class User
 import json
+import os
+
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives import serialization
+from cryptography.hazmat.primitives.asymmetric import rsa
 
 from project.server import app, db, bcrypt
 
+
+_certificate_key = None
+
+def certificate_key():
+    """
+    Loads the key that signs certificates, a new one is made on the first start
+    :return: RSA private key
+    """
+    global _certificate_key
+    if _certificate_key is not None:
+        return _certificate_key
+
+    path = app.config.get('CERTIFICATE_KEY_FILE')
+    if os.path.exists(path):
+        with open(path, 'rb') as f:
+            _certificate_key = serialization.load_pem_private_key(f.read(), password=None, backend=default_backend())
+    else:
+        _certificate_key = rsa.generate_private_key(public_exponent=65537, key_size=2048, backend=default_backend())
+        fd = os.open(path, os.O_WRONLY | os.O_CREAT | os.O_EXCL, 0o600)
+        with os.fdopen(fd, 'wb') as f:
+            f.write(_certificate_key.private_bytes(
+                encoding=serialization.Encoding.PEM,
+                format=serialization.PrivateFormat.TraditionalOpenSSL,
+                encryption_algorithm=serialization.NoEncryption()
+            ))
+    return _certificate_key
+
+
+def _b64_uint(n):
+    data = n.to_bytes((n.bit_length() + 7) // 8, 'big')
+    return base64.urlsafe_b64encode(data).rstrip(b'=').decode()
+
+
+def certificate_jwks():
+    """
+    Public keys the nodes verify certificates with
+    :return: dict
+    """
+    numbers = certificate_key().public_key().public_numbers()
+    return {
+        'keys': [{
+            'kty': 'RSA',
+            'kid': app.config.get('CERTIFICATE_KEY_ID'),
+            'alg': 'RS256',
+            'use': 'sig',
+            'n': _b64_uint(numbers.n),
+            'e': _b64_uint(numbers.e)
+        }]
+    }
+
 class User(db.Model):
     """ User Model for storing user related details """
     __tablename__ = "users"
@@ -160,8 +216,8 @@ class Сertificate(db.Model):
     token = db.Column(db.String(500), unique=True, nullable=False)
     shards = db.Column(db.Integer, nullable=False)
 
-    def __init__(self, user_id, mini_shard_size, shards, act, file_name):
-        self.token = self.encode_certificate_token(user_id, mini_shard_size, act, file_name).decode()
+    def __init__(self, user_id, file_size, shards, act, file_name):
+        self.token = self.encode_certificate_token(user_id, file_size, act, file_name).decode()
         self.shards = shards
 
 
@@ -169,24 +225,25 @@ class Сertificate(db.Model):
         return '<id: token: {}'.format(self.token)
 
     @staticmethod
-    def encode_certificate_token(user_id, mini_shard_size, act, file_name):
+    def encode_certificate_token(user_id, file_size, act, file_name):
         """
-        Generates the certificate Token
+        Generates the certificate Token, size is of the whole file, nodes work out the size of shards
         :return: string
         """
         try:
             payload = {
                 'exp': datetime.datetime.utcnow() + datetime.timedelta(days=1, seconds=0),
                 'iat': datetime.datetime.utcnow(),
-                'sub': user_id,
-                'size': mini_shard_size,
+                'sub': str(user_id),
+                'size': file_size,
                 'act': act,
                 'name': file_name
             }
             return jwt.encode(
                 payload,
-                app.config.get('SECRET_KEY'),
-                algorithm='HS256'
+                certificate_key(),
+                algorithm='RS256',
+                headers={'kid': app.config.get('CERTIFICATE_KEY_ID')}
             )
         except Exception as e:
             return e
@@ -199,7 +256,7 @@ class Сertificate(db.Model):
         :return: integer|string
         """
         try:
-            payload = jwt.decode(auth_token, app.config.get('SECRET_KEY'))
+            payload = jwt.decode(certificate_token, certificate_key().public_key(), algorithms=['RS256'])
             is_blacklisted_token = BlacklistToken.check_blacklist(certificate_token)
             if is_blacklisted_token:
                 return 'Token blacklisted. Please request again.'
@@ -4,20 +4,61 @@ import (
 	"C"
 	"log"
 	"storagePeer/src/peer"
+	"sync"
 )
 
+// Keys live on the Go side with the options they are used with, C holds their handles.
+// Handles of options without a key only compress.
+var (
+	keysMu  sync.Mutex
+	keys    = make(map[int]peer.Options)
+	nextKey = 1
+)
+
+func getKey(handle int) (peer.Options, bool) {
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	opts, ok := keys[handle]
+	return opts, ok
+}
+
+func addOptions(opts peer.Options) int {
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	handle := nextKey
+	nextKey++
+	keys[handle] = opts
+
+	return handle
+}
+
+//export UseTLS
+func UseTLS(caFile string, certFile string, keyFile string) int {
+
+	if err := peer.UseTLS(caFile, certFile, keyFile); err != nil {
+		log.Println("Error loading TLS certificates!", err)
+		return -1
+	}
+
+	return 0
+}
+
 //export UploadFileRSC
-func UploadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte, certificate string) {
+func UploadFileRSC(ringIP string, fname string, fcontent []byte, certificate string) {
 
-	if err := peer.UploadFileRSC(ringIP, fname, ringsz, fcontent, certificate); err != nil {
+	if err := peer.UploadFileRSC(ringIP, fname, fcontent, certificate); err != nil {
 		log.Println("Error uploading file (RSC)!", err)
 	}
 }
 
 //export DownloadFileRSC
-func DownloadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte, certificate string) int {
+func DownloadFileRSC(ringIP string, fname string, fcontent []byte, certificate string) int {
 
-	emptySpace, err := peer.DownloadFileRSC(ringIP, fname, ringsz, fcontent, certificate)
+	emptySpace, err := peer.DownloadFileRSC(ringIP, fname, fcontent, certificate)
 	if err != nil {
 		log.Println("Error downloading file (RSC)!", err)
 	}
@@ -26,9 +67,123 @@ func DownloadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte
 }
 
 //export DeleteFileRSC
-func DeleteFileRSC(ringIP string, fname string, ringsz uint64, certificate string) {
+func DeleteFileRSC(ringIP string, fname string, certificate string) {
+
+	if err := peer.DeleteFileRSC(ringIP, fname, certificate); err != nil {
+		log.Println("Error deleting file (RSC!", err)
+	}
+}
+
+//export NewKey
+func NewKey(secret []byte) int {
+
+	key, err := peer.NewKey(secret)
+	if err != nil {
+		log.Println("Error creating key!", err)
+		return -1
+	}
+
+	return addOptions(peer.Options{Key: key})
+}
+
+//export NewOptions
+func NewOptions() int {
+	return addOptions(peer.Options{})
+}
+
+//export HideNames
+func HideNames(handle int) int {
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	opts, ok := keys[handle]
+	if !ok {
+		return -1
+	}
+
+	opts.HideName = true
+	keys[handle] = opts
+
+	return 0
+}
+
+//export CompressWith
+func CompressWith(handle int, algorithm string) int {
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	opts, ok := keys[handle]
+	if !ok {
+		return -1
+	}
+
+	opts.Compress = algorithm
+	keys[handle] = opts
+
+	return 0
+}
+
+//export HiddenName
+func HiddenName(handle int, fname string, out []byte) int {
+
+	opts, _ := getKey(handle)
+	if opts.Key == nil {
+		return -1
+	}
+
+	name := peer.HiddenName(opts.Key, fname)
+	if len(out) < len(name) {
+		return -1
+	}
+
+	return copy(out, name)
+}
+
+//export DropKey
+func DropKey(handle int) {
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	delete(keys, handle)
+}
+
+//export UploadFileRSCWithKey
+func UploadFileRSCWithKey(ringIP string, fname string, fcontent []byte, certificate string, key int) int {
+
+	opts, ok := getKey(key)
+	if !ok {
+		log.Println("Error uploading file (RSC)! Unknown key", key)
+		return -1
+	}
+
+	if err := peer.UploadFileWithOptions(ringIP, fname, fcontent, certificate, opts); err != nil {
+		log.Println("Error uploading file (RSC)!", err)
+		return -1
+	}
+
+	return 0
+}
+
+//export DownloadFileRSCWithKey
+func DownloadFileRSCWithKey(ringIP string, fname string, fcontent []byte, certificate string, key int) int {
+
+	opts, _ := getKey(key)
+	emptySpace, err := peer.DownloadFileWithOptions(ringIP, fname, fcontent, certificate, opts)
+	if err != nil {
+		log.Println("Error downloading file (RSC)!", err)
+	}
+
+	return emptySpace
+}
+
+//export DeleteFileRSCWithKey
+func DeleteFileRSCWithKey(ringIP string, fname string, certificate string, key int) {
 
-	if err := peer.DeleteFileRSC(ringIP, fname, ringsz, certificate); err != nil {
+	opts, _ := getKey(key)
+	if err := peer.DeleteFileWithOptions(ringIP, fname, certificate, opts); err != nil {
 		log.Println("Error deleting file (RSC!", err)
 	}
 }
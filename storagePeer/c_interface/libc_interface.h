@@ -69,11 +69,31 @@ extern "C" {
 #endif
 
 
-extern void UploadFileRSC(GoString p0, GoString p1, GoUint64 p2, GoSlice p3, GoString p4);
+extern GoInt UseTLS(GoString p0, GoString p1, GoString p2);
 
-extern GoInt DownloadFileRSC(GoString p0, GoString p1, GoUint64 p2, GoSlice p3, GoString p4);
+extern void UploadFileRSC(GoString p0, GoString p1, GoSlice p2, GoString p3);
 
-extern void DeleteFileRSC(GoString p0, GoString p1, GoUint64 p2, GoString p3);
+extern GoInt DownloadFileRSC(GoString p0, GoString p1, GoSlice p2, GoString p3);
+
+extern void DeleteFileRSC(GoString p0, GoString p1, GoString p2);
+
+extern GoInt NewKey(GoSlice p0);
+
+extern GoInt NewOptions(void);
+
+extern void DropKey(GoInt p0);
+
+extern GoInt HideNames(GoInt p0);
+
+extern GoInt CompressWith(GoInt p0, GoString p1);
+
+extern GoInt HiddenName(GoInt p0, GoString p1, GoSlice p2);
+
+extern GoInt UploadFileRSCWithKey(GoString p0, GoString p1, GoSlice p2, GoString p3, GoInt p4);
+
+extern GoInt DownloadFileRSCWithKey(GoString p0, GoString p1, GoSlice p2, GoString p3, GoInt p4);
+
+extern void DeleteFileRSCWithKey(GoString p0, GoString p1, GoString p2, GoInt p3);
 
 #ifdef __cplusplus
 }
@@ -2,14 +2,15 @@
 #include <assert.h>
 #include <stdlib.h>
 #include <stdio.h>
+#include <string.h>
 
 GoSlice gen_rand_str(int len);
-int testUD_RSC(GoString ip, GoUint64 ringsz, GoString fname, GoString rJWT, GoString wJWT, GoString dJWT);
+int testUD_RSC(GoString ip, GoString fname, GoString rJWT, GoString wJWT, GoString dJWT);
 
 int main(int argc, char* argv[]) {
     // Initialize the arguments. Note, that we use Go types, defined in c_interface.h.
-    if (argc < 3) {
-        fprintf(stderr, "Not enough arguments for c_test: %d < 3", argc);
+    if (argc < 2) {
+        fprintf(stderr, "Not enough arguments for c_test: %d < 2", argc);
         return -1;
     }
     
@@ -17,8 +18,16 @@ int main(int argc, char* argv[]) {
     const char* ip_string = argv[1];
     GoString ip = { ip_string, 14 };
 
-    //ID - the size of the ring
-    GoUint64 ringsz = atoi(argv[2]);
+    //CA bundle, certificate and key of the client, if the nodes use TLS
+    if (argc >= 5) {
+        GoString ca = { argv[2], strlen(argv[2]) };
+        GoString cert = { argv[3], strlen(argv[3]) };
+        GoString key = { argv[4], strlen(argv[4]) };
+
+        if (UseTLS(ca, cert, key) != 0) {
+            return -1;
+        }
+    }
 
     //fname - the name of the file, same format (last number is the length of the string)
     GoString fname = { "testfile", 8 };
@@ -43,7 +52,7 @@ int main(int argc, char* argv[]) {
         n: 176
     };
 
-    int err = testUD_RSC(ip, ringsz, fname, rJWT, wJWT, dJWT);
+    int err = testUD_RSC(ip, fname, rJWT, wJWT, dJWT);
     if (err != 0) {
         return err;
     }
@@ -68,12 +77,12 @@ GoSlice gen_rand_str(int len) {
     return goslice;
 }
 
-int testUD_RSC(GoString ip, GoUint64 ringsz, GoString fname, GoString rJWT, GoString wJWT, GoString dJWT) {
+int testUD_RSC(GoString ip, GoString fname, GoString rJWT, GoString wJWT, GoString dJWT) {
     
     const int ARRSZ = 4096;
     GoSlice fcontent_slice = gen_rand_str(ARRSZ);
     
-    UploadFileRSC(ip, fname, ringsz, fcontent_slice, wJWT);
+    UploadFileRSC(ip, fname, fcontent_slice, wJWT);
 
     GoSlice buff = {
         //Allocate at least 9 more bytes than nescessary
@@ -82,7 +91,7 @@ int testUD_RSC(GoString ip, GoUint64 ringsz, GoString fname, GoString rJWT, GoSt
         cap: ARRSZ + 9
     };
 
-    GoInt remainingSpace = DownloadFileRSC(ip, fname, ringsz, buff, rJWT);
+    GoInt remainingSpace = DownloadFileRSC(ip, fname, buff, rJWT);
 
     GoInt8* fcontent_read = buff.data;
 
@@ -97,7 +106,7 @@ int testUD_RSC(GoString ip, GoUint64 ringsz, GoString fname, GoString rJWT, GoSt
         }
     }
 
-    DeleteFileRSC(ip, fname, ringsz, dJWT);
+    DeleteFileRSC(ip, fname, dJWT);
 
     free(fcontent_read);
     free(fcontent_slice.data);
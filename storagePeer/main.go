@@ -13,20 +13,54 @@ func main() {
 
 	ipPtr := flag.String("ip", "", "External IP of created node")
 	listenPtr := flag.String("list", "", "Local ip that we will listen to")
-	numPtr := flag.Uint64("num", 0, "Number of nodes in the network")
-	deltaT := flag.Int("refreshTime", 0, "Time in which fix routine is invoked (in seconds)")
+	deltaT := flag.Int("refreshTime", 0, "Time in which fix routine is invoked (in seconds, at least 1)")
 	entry := flag.String("entry", "", "Ip of some existing node (if not set this node is considered first)")
+	replicas := flag.Int("replicas", peer.DefaultReplicas, "Number of successors that keep a copy of each shard")
+	dataDir := flag.String("data", "", "Directory with shards and node state, kept across restarts")
+	vnodes := flag.Int("vnodes", 0, "Number of positions of the node on the ring, listening on the next ports (0 to weight by capacity)")
+	capacity := flag.Uint64("capacity", 0, "Disk space given to the node (in GiB)")
+	caFile := flag.String("ca", "", "CA bundle that signs certificates of nodes and clients (without -ca, -cert and -key the node talks plaintext)")
+	certFile := flag.String("cert", "", "Certificate of the node, issued for its external IP with the \"node\" OU")
+	keyFile := flag.String("key", "", "Key of the node certificate")
+	jwks := flag.String("jwks", "", "File or URL with public keys that sign tokens (JWKS)")
+	revoked := flag.String("revoked", "", "File or URL with ids of revoked tokens (JSON array)")
+	authGrace := flag.Int("authGrace", 0, "How long reads go on when the auth server is down (in seconds, 0 for default)")
+	legacyNames := flag.Bool("legacyNames", false, "Let tokens of users read files stored before namespaces, under plain names. Any user's token for the name reads such a file")
 
 	flag.Parse()
 
 	if *ipPtr == "" {
 		panic("ip flag not set")
 	}
-	if *numPtr == 0 {
-		panic("num flag not set")
+
+	// Clients can't show certificates yet, so mutual TLS is only used when it's set up
+	insecure := *caFile == "" && *certFile == "" && *keyFile == ""
+	if insecure {
+		fmt.Println("No -ca, -cert and -key given, talking plaintext")
 	}
+
 	fmt.Println("Starting...")
-	p := peer.NewPeer(*ipPtr, *listenPtr, *numPtr, *entry, time.Duration(*deltaT) * time.Second)
+	p := peer.NewPeerWithConfig(peer.Config{
+		OwnIP:       *ipPtr,
+		ListeningIP: *listenPtr,
+		ExistingIP:  *entry,
+		DeltaT:      time.Duration(*deltaT) * time.Second,
+		Replicas:    *replicas,
+		DataDir:     *dataDir,
+
+		VirtualNodes: *vnodes,
+		Capacity:     *capacity << 30,
+
+		CAFile:   *caFile,
+		CertFile: *certFile,
+		KeyFile:  *keyFile,
+		Insecure: insecure,
+
+		JWKS:        *jwks,
+		Revocations: *revoked,
+		AuthGrace:   time.Duration(*authGrace) * time.Second,
+		LegacyNames: *legacyNames,
+	})
 
 	err := <-p.Errs
 	fmt.Println("Error!:", err)
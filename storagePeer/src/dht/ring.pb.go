@@ -87,8 +87,39 @@ func (m *GetNodePredRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_GetNodePredRequest proto.InternalMessageInfo
 
+type GetNodeSelfRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetNodeSelfRequest) Reset()         { *m = GetNodeSelfRequest{} }
+func (m *GetNodeSelfRequest) String() string { return proto.CompactTextString(m) }
+func (*GetNodeSelfRequest) ProtoMessage()    {}
+func (*GetNodeSelfRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26381ed67e202a6e, []int{2}
+}
+
+func (m *GetNodeSelfRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetNodeSelfRequest.Unmarshal(m, b)
+}
+func (m *GetNodeSelfRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetNodeSelfRequest.Marshal(b, m, deterministic)
+}
+func (m *GetNodeSelfRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetNodeSelfRequest.Merge(m, src)
+}
+func (m *GetNodeSelfRequest) XXX_Size() int {
+	return xxx_messageInfo_GetNodeSelfRequest.Size(m)
+}
+func (m *GetNodeSelfRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetNodeSelfRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetNodeSelfRequest proto.InternalMessageInfo
+
 type FindPredRequest struct {
-	ID                   uint64   `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	ID                   []byte   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -98,7 +129,7 @@ func (m *FindPredRequest) Reset()         { *m = FindPredRequest{} }
 func (m *FindPredRequest) String() string { return proto.CompactTextString(m) }
 func (*FindPredRequest) ProtoMessage()    {}
 func (*FindPredRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{2}
+	return fileDescriptor_26381ed67e202a6e, []int{3}
 }
 
 func (m *FindPredRequest) XXX_Unmarshal(b []byte) error {
@@ -119,15 +150,55 @@ func (m *FindPredRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_FindPredRequest proto.InternalMessageInfo
 
-func (m *FindPredRequest) GetID() uint64 {
+func (m *FindPredRequest) GetID() []byte {
 	if m != nil {
 		return m.ID
 	}
-	return 0
+	return nil
+}
+
+type LookupStepRequest struct {
+	ID                   []byte   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LookupStepRequest) Reset()         { *m = LookupStepRequest{} }
+func (m *LookupStepRequest) String() string { return proto.CompactTextString(m) }
+func (*LookupStepRequest) ProtoMessage()    {}
+func (*LookupStepRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26381ed67e202a6e, []int{4}
+}
+
+func (m *LookupStepRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LookupStepRequest.Unmarshal(m, b)
+}
+func (m *LookupStepRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LookupStepRequest.Marshal(b, m, deterministic)
+}
+func (m *LookupStepRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LookupStepRequest.Merge(m, src)
+}
+func (m *LookupStepRequest) XXX_Size() int {
+	return xxx_messageInfo_LookupStepRequest.Size(m)
+}
+func (m *LookupStepRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_LookupStepRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LookupStepRequest proto.InternalMessageInfo
+
+func (m *LookupStepRequest) GetID() []byte {
+	if m != nil {
+		return m.ID
+	}
+	return nil
 }
 
 type UpdatePredRequest struct {
 	IP                   string   `protobuf:"bytes,1,opt,name=IP,proto3" json:"IP,omitempty"`
+	ID                   []byte   `protobuf:"bytes,2,opt,name=ID,proto3" json:"ID,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -137,7 +208,7 @@ func (m *UpdatePredRequest) Reset()         { *m = UpdatePredRequest{} }
 func (m *UpdatePredRequest) String() string { return proto.CompactTextString(m) }
 func (*UpdatePredRequest) ProtoMessage()    {}
 func (*UpdatePredRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{3}
+	return fileDescriptor_26381ed67e202a6e, []int{5}
 }
 
 func (m *UpdatePredRequest) XXX_Unmarshal(b []byte) error {
@@ -165,8 +236,16 @@ func (m *UpdatePredRequest) GetIP() string {
 	return ""
 }
 
+func (m *UpdatePredRequest) GetID() []byte {
+	if m != nil {
+		return m.ID
+	}
+	return nil
+}
+
 type UpdateSuccRequest struct {
 	IP                   string   `protobuf:"bytes,1,opt,name=IP,proto3" json:"IP,omitempty"`
+	ID                   []byte   `protobuf:"bytes,2,opt,name=ID,proto3" json:"ID,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -176,7 +255,7 @@ func (m *UpdateSuccRequest) Reset()         { *m = UpdateSuccRequest{} }
 func (m *UpdateSuccRequest) String() string { return proto.CompactTextString(m) }
 func (*UpdateSuccRequest) ProtoMessage()    {}
 func (*UpdateSuccRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{4}
+	return fileDescriptor_26381ed67e202a6e, []int{6}
 }
 
 func (m *UpdateSuccRequest) XXX_Unmarshal(b []byte) error {
@@ -204,9 +283,16 @@ func (m *UpdateSuccRequest) GetIP() string {
 	return ""
 }
 
+func (m *UpdateSuccRequest) GetID() []byte {
+	if m != nil {
+		return m.ID
+	}
+	return nil
+}
+
 type UpdateSpecificFingerRequest struct {
 	FingID               int64    `protobuf:"varint,1,opt,name=FingID,proto3" json:"FingID,omitempty"`
-	ID                   uint64   `protobuf:"varint,2,opt,name=ID,proto3" json:"ID,omitempty"`
+	ID                   []byte   `protobuf:"bytes,2,opt,name=ID,proto3" json:"ID,omitempty"`
 	IP                   string   `protobuf:"bytes,3,opt,name=IP,proto3" json:"IP,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -217,7 +303,7 @@ func (m *UpdateSpecificFingerRequest) Reset()         { *m = UpdateSpecificFinge
 func (m *UpdateSpecificFingerRequest) String() string { return proto.CompactTextString(m) }
 func (*UpdateSpecificFingerRequest) ProtoMessage()    {}
 func (*UpdateSpecificFingerRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{5}
+	return fileDescriptor_26381ed67e202a6e, []int{7}
 }
 
 func (m *UpdateSpecificFingerRequest) XXX_Unmarshal(b []byte) error {
@@ -245,11 +331,11 @@ func (m *UpdateSpecificFingerRequest) GetFingID() int64 {
 	return 0
 }
 
-func (m *UpdateSpecificFingerRequest) GetID() uint64 {
+func (m *UpdateSpecificFingerRequest) GetID() []byte {
 	if m != nil {
 		return m.ID
 	}
-	return 0
+	return nil
 }
 
 func (m *UpdateSpecificFingerRequest) GetIP() string {
@@ -261,6 +347,7 @@ func (m *UpdateSpecificFingerRequest) GetIP() string {
 
 type UpdateSuccListRequest struct {
 	IP                   string   `protobuf:"bytes,1,opt,name=IP,proto3" json:"IP,omitempty"`
+	ID                   []byte   `protobuf:"bytes,2,opt,name=ID,proto3" json:"ID,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -270,7 +357,7 @@ func (m *UpdateSuccListRequest) Reset()         { *m = UpdateSuccListRequest{} }
 func (m *UpdateSuccListRequest) String() string { return proto.CompactTextString(m) }
 func (*UpdateSuccListRequest) ProtoMessage()    {}
 func (*UpdateSuccListRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{6}
+	return fileDescriptor_26381ed67e202a6e, []int{8}
 }
 
 func (m *UpdateSuccListRequest) XXX_Unmarshal(b []byte) error {
@@ -298,8 +385,15 @@ func (m *UpdateSuccListRequest) GetIP() string {
 	return ""
 }
 
+func (m *UpdateSuccListRequest) GetID() []byte {
+	if m != nil {
+		return m.ID
+	}
+	return nil
+}
+
 type UpdateKeysInfoRequest struct {
-	ID                   uint64   `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	ID                   []byte   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
 	Keys                 []string `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -310,7 +404,7 @@ func (m *UpdateKeysInfoRequest) Reset()         { *m = UpdateKeysInfoRequest{} }
 func (m *UpdateKeysInfoRequest) String() string { return proto.CompactTextString(m) }
 func (*UpdateKeysInfoRequest) ProtoMessage()    {}
 func (*UpdateKeysInfoRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{7}
+	return fileDescriptor_26381ed67e202a6e, []int{9}
 }
 
 func (m *UpdateKeysInfoRequest) XXX_Unmarshal(b []byte) error {
@@ -331,11 +425,11 @@ func (m *UpdateKeysInfoRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_UpdateKeysInfoRequest proto.InternalMessageInfo
 
-func (m *UpdateKeysInfoRequest) GetID() uint64 {
+func (m *UpdateKeysInfoRequest) GetID() []byte {
 	if m != nil {
 		return m.ID
 	}
-	return 0
+	return nil
 }
 
 func (m *UpdateKeysInfoRequest) GetKeys() []string {
@@ -347,6 +441,7 @@ func (m *UpdateKeysInfoRequest) GetKeys() []string {
 
 type UpdateKeysRequest struct {
 	Keys                 []string `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	Inherited            bool     `protobuf:"varint,3,opt,name=inherited,proto3" json:"inherited,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -356,7 +451,7 @@ func (m *UpdateKeysRequest) Reset()         { *m = UpdateKeysRequest{} }
 func (m *UpdateKeysRequest) String() string { return proto.CompactTextString(m) }
 func (*UpdateKeysRequest) ProtoMessage()    {}
 func (*UpdateKeysRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{8}
+	return fileDescriptor_26381ed67e202a6e, []int{10}
 }
 
 func (m *UpdateKeysRequest) XXX_Unmarshal(b []byte) error {
@@ -384,7 +479,15 @@ func (m *UpdateKeysRequest) GetKeys() []string {
 	return nil
 }
 
+func (m *UpdateKeysRequest) GetInherited() bool {
+	if m != nil {
+		return m.Inherited
+	}
+	return false
+}
+
 type GetKeysRequest struct {
+	Replicas             bool     `protobuf:"varint,1,opt,name=replicas,proto3" json:"replicas,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -394,7 +497,7 @@ func (m *GetKeysRequest) Reset()         { *m = GetKeysRequest{} }
 func (m *GetKeysRequest) String() string { return proto.CompactTextString(m) }
 func (*GetKeysRequest) ProtoMessage()    {}
 func (*GetKeysRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{9}
+	return fileDescriptor_26381ed67e202a6e, []int{11}
 }
 
 func (m *GetKeysRequest) XXX_Unmarshal(b []byte) error {
@@ -415,10 +518,159 @@ func (m *GetKeysRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_GetKeysRequest proto.InternalMessageInfo
 
+func (m *GetKeysRequest) GetReplicas() bool {
+	if m != nil {
+		return m.Replicas
+	}
+	return false
+}
+
+type TreeLevelRequest struct {
+	Start                []byte   `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End                  []byte   `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	Replicas             bool     `protobuf:"varint,3,opt,name=replicas,proto3" json:"replicas,omitempty"`
+	Digests              bool     `protobuf:"varint,4,opt,name=digests,proto3" json:"digests,omitempty"`
+	Level                uint32   `protobuf:"varint,5,opt,name=level,proto3" json:"level,omitempty"`
+	Indices              []uint32 `protobuf:"varint,6,rep,packed,name=indices,proto3" json:"indices,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TreeLevelRequest) Reset()         { *m = TreeLevelRequest{} }
+func (m *TreeLevelRequest) String() string { return proto.CompactTextString(m) }
+func (*TreeLevelRequest) ProtoMessage()    {}
+func (*TreeLevelRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26381ed67e202a6e, []int{12}
+}
+
+func (m *TreeLevelRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TreeLevelRequest.Unmarshal(m, b)
+}
+func (m *TreeLevelRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TreeLevelRequest.Marshal(b, m, deterministic)
+}
+func (m *TreeLevelRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TreeLevelRequest.Merge(m, src)
+}
+func (m *TreeLevelRequest) XXX_Size() int {
+	return xxx_messageInfo_TreeLevelRequest.Size(m)
+}
+func (m *TreeLevelRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TreeLevelRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TreeLevelRequest proto.InternalMessageInfo
+
+func (m *TreeLevelRequest) GetStart() []byte {
+	if m != nil {
+		return m.Start
+	}
+	return nil
+}
+
+func (m *TreeLevelRequest) GetEnd() []byte {
+	if m != nil {
+		return m.End
+	}
+	return nil
+}
+
+func (m *TreeLevelRequest) GetReplicas() bool {
+	if m != nil {
+		return m.Replicas
+	}
+	return false
+}
+
+func (m *TreeLevelRequest) GetDigests() bool {
+	if m != nil {
+		return m.Digests
+	}
+	return false
+}
+
+func (m *TreeLevelRequest) GetLevel() uint32 {
+	if m != nil {
+		return m.Level
+	}
+	return 0
+}
+
+func (m *TreeLevelRequest) GetIndices() []uint32 {
+	if m != nil {
+		return m.Indices
+	}
+	return nil
+}
+
+type BucketKeysRequest struct {
+	Start                []byte   `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End                  []byte   `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	Replicas             bool     `protobuf:"varint,3,opt,name=replicas,proto3" json:"replicas,omitempty"`
+	Buckets              []uint32 `protobuf:"varint,4,rep,packed,name=buckets,proto3" json:"buckets,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BucketKeysRequest) Reset()         { *m = BucketKeysRequest{} }
+func (m *BucketKeysRequest) String() string { return proto.CompactTextString(m) }
+func (*BucketKeysRequest) ProtoMessage()    {}
+func (*BucketKeysRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26381ed67e202a6e, []int{13}
+}
+
+func (m *BucketKeysRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BucketKeysRequest.Unmarshal(m, b)
+}
+func (m *BucketKeysRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BucketKeysRequest.Marshal(b, m, deterministic)
+}
+func (m *BucketKeysRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BucketKeysRequest.Merge(m, src)
+}
+func (m *BucketKeysRequest) XXX_Size() int {
+	return xxx_messageInfo_BucketKeysRequest.Size(m)
+}
+func (m *BucketKeysRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BucketKeysRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BucketKeysRequest proto.InternalMessageInfo
+
+func (m *BucketKeysRequest) GetStart() []byte {
+	if m != nil {
+		return m.Start
+	}
+	return nil
+}
+
+func (m *BucketKeysRequest) GetEnd() []byte {
+	if m != nil {
+		return m.End
+	}
+	return nil
+}
+
+func (m *BucketKeysRequest) GetReplicas() bool {
+	if m != nil {
+		return m.Replicas
+	}
+	return false
+}
+
+func (m *BucketKeysRequest) GetBuckets() []uint32 {
+	if m != nil {
+		return m.Buckets
+	}
+	return nil
+}
+
 // Replies
 type NodeReply struct {
 	IP                   string   `protobuf:"bytes,1,opt,name=IP,proto3" json:"IP,omitempty"`
-	ID                   uint64   `protobuf:"varint,2,opt,name=ID,proto3" json:"ID,omitempty"`
+	ID                   []byte   `protobuf:"bytes,2,opt,name=ID,proto3" json:"ID,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -428,7 +680,7 @@ func (m *NodeReply) Reset()         { *m = NodeReply{} }
 func (m *NodeReply) String() string { return proto.CompactTextString(m) }
 func (*NodeReply) ProtoMessage()    {}
 func (*NodeReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{10}
+	return fileDescriptor_26381ed67e202a6e, []int{14}
 }
 
 func (m *NodeReply) XXX_Unmarshal(b []byte) error {
@@ -456,11 +708,66 @@ func (m *NodeReply) GetIP() string {
 	return ""
 }
 
-func (m *NodeReply) GetID() uint64 {
+func (m *NodeReply) GetID() []byte {
 	if m != nil {
 		return m.ID
 	}
-	return 0
+	return nil
+}
+
+type LookupStepReply struct {
+	Succ                 *NodeReply   `protobuf:"bytes,1,opt,name=succ,proto3" json:"succ,omitempty"`
+	Candidates           []*NodeReply `protobuf:"bytes,2,rep,name=candidates,proto3" json:"candidates,omitempty"`
+	Self                 *NodeReply   `protobuf:"bytes,3,opt,name=self,proto3" json:"self,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *LookupStepReply) Reset()         { *m = LookupStepReply{} }
+func (m *LookupStepReply) String() string { return proto.CompactTextString(m) }
+func (*LookupStepReply) ProtoMessage()    {}
+func (*LookupStepReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26381ed67e202a6e, []int{15}
+}
+
+func (m *LookupStepReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LookupStepReply.Unmarshal(m, b)
+}
+func (m *LookupStepReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LookupStepReply.Marshal(b, m, deterministic)
+}
+func (m *LookupStepReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LookupStepReply.Merge(m, src)
+}
+func (m *LookupStepReply) XXX_Size() int {
+	return xxx_messageInfo_LookupStepReply.Size(m)
+}
+func (m *LookupStepReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_LookupStepReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LookupStepReply proto.InternalMessageInfo
+
+func (m *LookupStepReply) GetSucc() *NodeReply {
+	if m != nil {
+		return m.Succ
+	}
+	return nil
+}
+
+func (m *LookupStepReply) GetCandidates() []*NodeReply {
+	if m != nil {
+		return m.Candidates
+	}
+	return nil
+}
+
+func (m *LookupStepReply) GetSelf() *NodeReply {
+	if m != nil {
+		return m.Self
+	}
+	return nil
 }
 
 type UpdateReply struct {
@@ -474,7 +781,7 @@ func (m *UpdateReply) Reset()         { *m = UpdateReply{} }
 func (m *UpdateReply) String() string { return proto.CompactTextString(m) }
 func (*UpdateReply) ProtoMessage()    {}
 func (*UpdateReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{11}
+	return fileDescriptor_26381ed67e202a6e, []int{16}
 }
 
 func (m *UpdateReply) XXX_Unmarshal(b []byte) error {
@@ -513,7 +820,7 @@ func (m *KeyReply) Reset()         { *m = KeyReply{} }
 func (m *KeyReply) String() string { return proto.CompactTextString(m) }
 func (*KeyReply) ProtoMessage()    {}
 func (*KeyReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_26381ed67e202a6e, []int{12}
+	return fileDescriptor_26381ed67e202a6e, []int{17}
 }
 
 func (m *KeyReply) XXX_Unmarshal(b []byte) error {
@@ -541,10 +848,98 @@ func (m *KeyReply) GetKeys() []string {
 	return nil
 }
 
+type TreeLevelReply struct {
+	Hashes               [][]byte `protobuf:"bytes,1,rep,name=hashes,proto3" json:"hashes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TreeLevelReply) Reset()         { *m = TreeLevelReply{} }
+func (m *TreeLevelReply) String() string { return proto.CompactTextString(m) }
+func (*TreeLevelReply) ProtoMessage()    {}
+func (*TreeLevelReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26381ed67e202a6e, []int{18}
+}
+
+func (m *TreeLevelReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TreeLevelReply.Unmarshal(m, b)
+}
+func (m *TreeLevelReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TreeLevelReply.Marshal(b, m, deterministic)
+}
+func (m *TreeLevelReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TreeLevelReply.Merge(m, src)
+}
+func (m *TreeLevelReply) XXX_Size() int {
+	return xxx_messageInfo_TreeLevelReply.Size(m)
+}
+func (m *TreeLevelReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_TreeLevelReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TreeLevelReply proto.InternalMessageInfo
+
+func (m *TreeLevelReply) GetHashes() [][]byte {
+	if m != nil {
+		return m.Hashes
+	}
+	return nil
+}
+
+type BucketKeysReply struct {
+	Keys                 []string `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	Digests              [][]byte `protobuf:"bytes,2,rep,name=digests,proto3" json:"digests,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BucketKeysReply) Reset()         { *m = BucketKeysReply{} }
+func (m *BucketKeysReply) String() string { return proto.CompactTextString(m) }
+func (*BucketKeysReply) ProtoMessage()    {}
+func (*BucketKeysReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26381ed67e202a6e, []int{19}
+}
+
+func (m *BucketKeysReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BucketKeysReply.Unmarshal(m, b)
+}
+func (m *BucketKeysReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BucketKeysReply.Marshal(b, m, deterministic)
+}
+func (m *BucketKeysReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BucketKeysReply.Merge(m, src)
+}
+func (m *BucketKeysReply) XXX_Size() int {
+	return xxx_messageInfo_BucketKeysReply.Size(m)
+}
+func (m *BucketKeysReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_BucketKeysReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BucketKeysReply proto.InternalMessageInfo
+
+func (m *BucketKeysReply) GetKeys() []string {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+func (m *BucketKeysReply) GetDigests() [][]byte {
+	if m != nil {
+		return m.Digests
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*GetNodeSuccRequest)(nil), "dht.GetNodeSuccRequest")
 	proto.RegisterType((*GetNodePredRequest)(nil), "dht.GetNodePredRequest")
+	proto.RegisterType((*GetNodeSelfRequest)(nil), "dht.GetNodeSelfRequest")
 	proto.RegisterType((*FindPredRequest)(nil), "dht.FindPredRequest")
+	proto.RegisterType((*LookupStepRequest)(nil), "dht.LookupStepRequest")
 	proto.RegisterType((*UpdatePredRequest)(nil), "dht.UpdatePredRequest")
 	proto.RegisterType((*UpdateSuccRequest)(nil), "dht.UpdateSuccRequest")
 	proto.RegisterType((*UpdateSpecificFingerRequest)(nil), "dht.UpdateSpecificFingerRequest")
@@ -552,9 +947,14 @@ func init() {
 	proto.RegisterType((*UpdateKeysInfoRequest)(nil), "dht.UpdateKeysInfoRequest")
 	proto.RegisterType((*UpdateKeysRequest)(nil), "dht.UpdateKeysRequest")
 	proto.RegisterType((*GetKeysRequest)(nil), "dht.GetKeysRequest")
+	proto.RegisterType((*TreeLevelRequest)(nil), "dht.TreeLevelRequest")
+	proto.RegisterType((*BucketKeysRequest)(nil), "dht.BucketKeysRequest")
 	proto.RegisterType((*NodeReply)(nil), "dht.NodeReply")
+	proto.RegisterType((*LookupStepReply)(nil), "dht.LookupStepReply")
 	proto.RegisterType((*UpdateReply)(nil), "dht.UpdateReply")
 	proto.RegisterType((*KeyReply)(nil), "dht.KeyReply")
+	proto.RegisterType((*TreeLevelReply)(nil), "dht.TreeLevelReply")
+	proto.RegisterType((*BucketKeysReply)(nil), "dht.BucketKeysReply")
 }
 
 func init() {
@@ -562,34 +962,52 @@ func init() {
 }
 
 var fileDescriptor_26381ed67e202a6e = []byte{
-	// 423 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x94, 0xd1, 0xaa, 0xda, 0x40,
-	0x10, 0x86, 0x35, 0x11, 0xab, 0x23, 0x4d, 0xed, 0xd6, 0x5a, 0xb1, 0xb4, 0xd8, 0xed, 0x85, 0x42,
-	0xc1, 0x82, 0xbd, 0x29, 0xf4, 0xa2, 0xbd, 0x10, 0x25, 0x44, 0xaa, 0xac, 0xf8, 0x00, 0x6d, 0x32,
-	0xea, 0xd2, 0x92, 0xe4, 0x24, 0xf1, 0x40, 0x1e, 0xfa, 0xbc, 0xc3, 0x21, 0x6b, 0xd6, 0x6c, 0xe2,
-	0xea, 0x5d, 0x32, 0xfb, 0xff, 0xf3, 0xcf, 0x64, 0x3f, 0x02, 0x10, 0x71, 0xff, 0x30, 0x0d, 0xa3,
-	0x20, 0x09, 0x88, 0xe9, 0x1d, 0x13, 0xda, 0x03, 0xb2, 0xc4, 0xe4, 0x77, 0xe0, 0xe1, 0xf6, 0xe4,
-	0xba, 0x0c, 0x1f, 0x4e, 0x18, 0xab, 0xd5, 0x4d, 0x84, 0x9e, 0xac, 0x7e, 0x82, 0x57, 0x0b, 0xee,
-	0x7b, 0x4a, 0x89, 0x58, 0x60, 0xd8, 0xf3, 0x41, 0x7d, 0x54, 0x9f, 0x34, 0x98, 0x61, 0xcf, 0xe9,
-	0x67, 0x78, 0xbd, 0x0b, 0xbd, 0x3f, 0x09, 0x56, 0x45, 0x1b, 0x21, 0x6a, 0x33, 0xc3, 0xde, 0x14,
-	0x22, 0x25, 0xf2, 0x4a, 0xb4, 0x83, 0xf7, 0xb9, 0x28, 0x44, 0x97, 0xef, 0xb9, 0xbb, 0xe0, 0xfe,
-	0x01, 0x23, 0x29, 0xef, 0x43, 0x33, 0x2b, 0xe4, 0xe1, 0x26, 0xcb, 0xdf, 0xf2, 0x81, 0x0c, 0x39,
-	0x50, 0xde, 0xd6, 0xbc, 0xb4, 0x1d, 0xc3, 0xdb, 0x22, 0x7b, 0xc5, 0xe3, 0xe4, 0x56, 0xfe, 0x0f,
-	0x29, 0x74, 0x30, 0x8d, 0x6d, 0x7f, 0x1f, 0xdc, 0x58, 0x99, 0x10, 0x68, 0xfc, 0xc3, 0x34, 0x1e,
-	0x18, 0x23, 0x73, 0xd2, 0x66, 0xe2, 0x99, 0x8e, 0xe5, 0x86, 0x99, 0x59, 0x1a, 0x75, 0xc2, 0x2e,
-	0x58, 0x4b, 0x4c, 0x14, 0x15, 0xfd, 0x02, 0xed, 0xec, 0xbb, 0x33, 0x0c, 0xff, 0xa7, 0xd5, 0xa1,
-	0xaa, 0xdb, 0xd1, 0x0f, 0xd0, 0x39, 0xe7, 0x5c, 0xe4, 0x6b, 0x47, 0xc8, 0x5b, 0xcc, 0x58, 0x3b,
-	0xf4, 0x23, 0xb4, 0x1c, 0x4c, 0xcf, 0x67, 0x32, 0xbd, 0x5e, 0xa4, 0xcf, 0x9e, 0x1a, 0xd0, 0x61,
-	0xdc, 0x3f, 0x6c, 0x31, 0x7a, 0xe4, 0x2e, 0x92, 0xef, 0xd0, 0x51, 0x60, 0x20, 0xef, 0xa6, 0xde,
-	0x31, 0x99, 0x5e, 0xe3, 0x31, 0xb4, 0xc4, 0xc1, 0x65, 0x4c, 0x5a, 0x53, 0x9c, 0xd9, 0xc5, 0x97,
-	0x9d, 0x0a, 0x0a, 0x1a, 0xe7, 0x0c, 0x5a, 0x12, 0x2a, 0xd2, 0x13, 0xa7, 0x15, 0xc6, 0x34, 0x9e,
-	0x9f, 0x2a, 0x65, 0xe8, 0x62, 0x1c, 0x07, 0x11, 0xe9, 0x0b, 0xd9, 0x15, 0x7d, 0xc3, 0xae, 0x52,
-	0x2f, 0xc6, 0x85, 0x82, 0x82, 0x92, 0x53, 0x5d, 0x53, 0xe7, 0x5c, 0x41, 0x4f, 0x87, 0x25, 0x19,
-	0xa9, 0x3d, 0x74, 0xc4, 0x6a, 0xbb, 0xfd, 0x02, 0xab, 0x4c, 0x23, 0x19, 0x56, 0x66, 0x51, 0x10,
-	0xbd, 0xbf, 0x49, 0xc6, 0x50, 0x69, 0x13, 0x05, 0xaa, 0xfb, 0xd9, 0x12, 0xf0, 0x52, 0x76, 0x85,
-	0x7a, 0x6d, 0x87, 0xaf, 0xf0, 0x22, 0x87, 0x97, 0xbc, 0x91, 0x17, 0xae, 0xa6, 0xbe, 0x14, 0x45,
-	0x49, 0x20, 0xad, 0xfd, 0x6d, 0x8a, 0x1f, 0xcf, 0xb7, 0xe7, 0x00, 0x00, 0x00, 0xff, 0xff, 0x98,
-	0x2e, 0xcd, 0x93, 0x86, 0x04, 0x00, 0x00,
+	// 705 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x5d, 0x6e, 0xda, 0x40,
+	0x10, 0x2e, 0x76, 0x42, 0x60, 0x08, 0x24, 0x6c, 0x48, 0x8a, 0xdc, 0x1f, 0x51, 0xf7, 0x05, 0xa9,
+	0x15, 0x95, 0x92, 0x87, 0x56, 0x6a, 0xa5, 0x54, 0x55, 0x1a, 0x84, 0x40, 0x4d, 0x64, 0x9a, 0x03,
+	0x10, 0x7b, 0x80, 0x55, 0x2c, 0xdb, 0xb1, 0x97, 0x48, 0x1c, 0xa1, 0xb7, 0xe8, 0xe1, 0x7a, 0x90,
+	0xca, 0xeb, 0x5d, 0xbc, 0xfe, 0x09, 0xe9, 0x43, 0xdf, 0x98, 0xd9, 0xf9, 0xbe, 0x99, 0xf1, 0xcc,
+	0x7c, 0x02, 0x20, 0xa4, 0xde, 0x62, 0x10, 0x84, 0x3e, 0xf3, 0x89, 0xee, 0x2c, 0x99, 0xd9, 0x01,
+	0x32, 0x44, 0xf6, 0xc3, 0x77, 0x70, 0xba, 0xb2, 0x6d, 0x0b, 0xef, 0x57, 0x18, 0xa9, 0xde, 0xeb,
+	0x10, 0x9d, 0xa2, 0x77, 0x8a, 0xee, 0x5c, 0x7a, 0xdf, 0xc0, 0xc1, 0x25, 0xf5, 0x1c, 0x25, 0x90,
+	0xb4, 0x40, 0x1b, 0x5d, 0x74, 0x2b, 0xbd, 0x4a, 0x7f, 0xdf, 0xd2, 0x46, 0x17, 0xe6, 0x5b, 0x68,
+	0x4f, 0x7c, 0xff, 0x6e, 0x15, 0x4c, 0x19, 0x06, 0x8f, 0x05, 0x9d, 0x41, 0xfb, 0x26, 0x70, 0x66,
+	0x0c, 0xf3, 0x4c, 0xd7, 0x3c, 0xa8, 0x6e, 0x69, 0xa3, 0x6b, 0x01, 0xd2, 0x8a, 0x20, 0xa5, 0xfa,
+	0x27, 0x41, 0x37, 0xf0, 0x42, 0x80, 0x02, 0xb4, 0xe9, 0x9c, 0xda, 0x97, 0xd4, 0x5b, 0x60, 0x28,
+	0xe1, 0x27, 0x50, 0x8d, 0x1d, 0xa2, 0x38, 0xdd, 0x12, 0x56, 0x9e, 0x46, 0xa4, 0xd1, 0x65, 0x1a,
+	0xf3, 0x23, 0x1c, 0xa7, 0xb5, 0x4c, 0x68, 0xc4, 0xfe, 0xb5, 0x9e, 0xcf, 0x12, 0x38, 0xc6, 0x75,
+	0x34, 0xf2, 0xe6, 0xfe, 0x23, 0x9f, 0x88, 0x10, 0xd8, 0xb9, 0xc3, 0x75, 0xd4, 0xd5, 0x7a, 0x7a,
+	0xbf, 0x6e, 0xf1, 0xdf, 0xe6, 0x77, 0x68, 0xa7, 0x60, 0x09, 0x2c, 0x09, 0x24, 0x2f, 0xa1, 0x4e,
+	0xbd, 0x25, 0x86, 0x94, 0xa1, 0xc3, 0xab, 0xae, 0x59, 0xa9, 0xc3, 0x7c, 0x0f, 0xad, 0x21, 0x32,
+	0x95, 0xc3, 0x80, 0x5a, 0x88, 0x81, 0x4b, 0xed, 0x59, 0xc4, 0x4b, 0xa8, 0x59, 0x1b, 0xdb, 0xfc,
+	0x5d, 0x81, 0xc3, 0x9f, 0x21, 0xe2, 0x04, 0x1f, 0xd0, 0x95, 0x80, 0x0e, 0xec, 0x46, 0x6c, 0x16,
+	0x32, 0x51, 0x70, 0x62, 0x90, 0x43, 0xd0, 0xd1, 0x73, 0x44, 0xb7, 0xf1, 0xcf, 0x0c, 0xb1, 0x9e,
+	0x25, 0x26, 0x5d, 0xd8, 0x73, 0xe8, 0x02, 0x23, 0x16, 0x75, 0x77, 0xf8, 0x93, 0x34, 0x63, 0x76,
+	0x37, 0xce, 0xd6, 0xdd, 0xed, 0x55, 0xfa, 0x4d, 0x2b, 0x31, 0xe2, 0x78, 0xea, 0x39, 0xd4, 0xc6,
+	0xa8, 0x5b, 0xed, 0xe9, 0xfd, 0xa6, 0x25, 0x4d, 0xf3, 0x1e, 0xda, 0xdf, 0x56, 0xf6, 0x5d, 0xb6,
+	0xa7, 0xff, 0x54, 0xe2, 0x2d, 0x27, 0x8e, 0x4b, 0xe4, 0x29, 0x85, 0x69, 0xbe, 0x83, 0x7a, 0x7c,
+	0x1c, 0x16, 0x06, 0xee, 0xfa, 0xc9, 0xa1, 0xff, 0xaa, 0xc0, 0x81, 0x7a, 0x14, 0x31, 0xc6, 0x84,
+	0x9d, 0x68, 0x65, 0xdb, 0x1c, 0xd5, 0x38, 0x6d, 0x0d, 0x9c, 0x25, 0x1b, 0x6c, 0x18, 0x2d, 0xfe,
+	0x46, 0x06, 0x00, 0xf6, 0xcc, 0x73, 0x68, 0x3c, 0xf2, 0x64, 0xc0, 0xc5, 0x48, 0x25, 0x82, 0x73,
+	0xa2, 0x3b, 0xe7, 0x6d, 0x94, 0x71, 0xa2, 0x3b, 0x37, 0x5f, 0x41, 0x23, 0xd9, 0xa1, 0x4d, 0xe9,
+	0x57, 0x63, 0x31, 0x73, 0xed, 0x6a, 0x6c, 0xbe, 0x86, 0xda, 0x18, 0xd7, 0xc9, 0x9b, 0xdc, 0xac,
+	0x8a, 0xb2, 0x82, 0x7d, 0x68, 0x29, 0xcb, 0x10, 0x47, 0x9d, 0x40, 0x75, 0x39, 0x8b, 0x96, 0x98,
+	0xc4, 0xed, 0x5b, 0xc2, 0x32, 0xcf, 0xe1, 0x40, 0x1d, 0xca, 0x23, 0x84, 0xea, 0x16, 0x68, 0x1c,
+	0x2f, 0xcd, 0xd3, 0x3f, 0x55, 0x68, 0x58, 0xd4, 0x5b, 0x4c, 0x31, 0x7c, 0xa0, 0x36, 0x92, 0x4f,
+	0xd0, 0x50, 0xe4, 0x8b, 0x3c, 0xe7, 0xed, 0x15, 0x05, 0xcd, 0xc8, 0xf5, 0x6d, 0x3e, 0x53, 0x90,
+	0xb1, 0xde, 0x64, 0x91, 0x8a, 0x02, 0x6d, 0x45, 0xc6, 0x32, 0x98, 0xcb, 0x99, 0x0a, 0x63, 0x09,
+	0xf2, 0x14, 0x6a, 0x52, 0x2a, 0x49, 0x87, 0xbf, 0xe6, 0x94, 0xb3, 0x04, 0xf3, 0x05, 0x20, 0x5d,
+	0x13, 0x72, 0xc2, 0xdf, 0x0b, 0x62, 0x6a, 0x74, 0x0a, 0xfe, 0x04, 0x7d, 0xae, 0x8a, 0x2a, 0xda,
+	0x18, 0x45, 0x7e, 0x28, 0x48, 0x0a, 0x62, 0x6b, 0x1c, 0x2a, 0xfe, 0xb4, 0x59, 0x48, 0x45, 0x2d,
+	0x83, 0x54, 0x3f, 0x6f, 0x19, 0x72, 0x02, 0x9d, 0x32, 0x95, 0x25, 0x3d, 0x95, 0xa3, 0x4c, 0x80,
+	0x4b, 0xd9, 0xbe, 0x42, 0x2b, 0x2b, 0xae, 0xc4, 0xc8, 0xd5, 0xa2, 0x28, 0xee, 0xf6, 0x4e, 0xe2,
+	0xdd, 0xcb, 0x74, 0xa2, 0x28, 0xc4, 0xf6, 0xdc, 0x52, 0x9f, 0x33, 0xb9, 0x73, 0xa2, 0x5d, 0xca,
+	0xf0, 0x01, 0xf6, 0x84, 0xba, 0x92, 0x23, 0xb9, 0x2e, 0x6a, 0xd6, 0x26, 0x77, 0xca, 0x23, 0xe3,
+	0x53, 0xdf, 0x1f, 0x22, 0xdb, 0x5c, 0x15, 0x39, 0xe6, 0x01, 0x79, 0xc9, 0x35, 0x8e, 0xf2, 0x6e,
+	0x39, 0xf5, 0xe6, 0x10, 0x59, 0x7a, 0x69, 0xa2, 0xdb, 0x82, 0x1e, 0x1a, 0x9d, 0x82, 0x9f, 0x13,
+	0xdc, 0x56, 0xf9, 0x3f, 0x84, 0xb3, 0xbf, 0x03, 0x00, 0xf2, 0x62, 0xb4, 0xc3, 0x2f, 0x08, 0x00,
+	0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -607,8 +1025,10 @@ type RingServiceClient interface {
 	// These request return you succ and pred for specific nodes
 	GetNodeSucc(ctx context.Context, in *GetNodeSuccRequest, opts ...grpc.CallOption) (*NodeReply, error)
 	GetNodePred(ctx context.Context, in *GetNodePredRequest, opts ...grpc.CallOption) (*NodeReply, error)
+	GetNodeSelf(ctx context.Context, in *GetNodeSelfRequest, opts ...grpc.CallOption) (*NodeReply, error)
 	// These request return them for id's
 	FindPred(ctx context.Context, in *FindPredRequest, opts ...grpc.CallOption) (*NodeReply, error)
+	LookupStep(ctx context.Context, in *LookupStepRequest, opts ...grpc.CallOption) (*LookupStepReply, error)
 	// Update neighbours data of a node
 	UpdatePredecessor(ctx context.Context, in *UpdatePredRequest, opts ...grpc.CallOption) (*UpdateReply, error)
 	UpdateSucc(ctx context.Context, in *UpdateSuccRequest, opts ...grpc.CallOption) (*UpdateReply, error)
@@ -619,6 +1039,9 @@ type RingServiceClient interface {
 	UpdateKeys(ctx context.Context, in *UpdateKeysRequest, opts ...grpc.CallOption) (*UpdateReply, error)
 	UpdateKeysInfo(ctx context.Context, in *UpdateKeysInfoRequest, opts ...grpc.CallOption) (*UpdateReply, error)
 	GetKeys(ctx context.Context, in *GetKeysRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// Merkle trees over key ranges, so only differing ranges are exchanged
+	GetTreeLevel(ctx context.Context, in *TreeLevelRequest, opts ...grpc.CallOption) (*TreeLevelReply, error)
+	GetBucketKeys(ctx context.Context, in *BucketKeysRequest, opts ...grpc.CallOption) (*BucketKeysReply, error)
 }
 
 type ringServiceClient struct {
@@ -647,6 +1070,15 @@ func (c *ringServiceClient) GetNodePred(ctx context.Context, in *GetNodePredRequ
 	return out, nil
 }
 
+func (c *ringServiceClient) GetNodeSelf(ctx context.Context, in *GetNodeSelfRequest, opts ...grpc.CallOption) (*NodeReply, error) {
+	out := new(NodeReply)
+	err := c.cc.Invoke(ctx, "/dht.RingService/GetNodeSelf", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *ringServiceClient) FindPred(ctx context.Context, in *FindPredRequest, opts ...grpc.CallOption) (*NodeReply, error) {
 	out := new(NodeReply)
 	err := c.cc.Invoke(ctx, "/dht.RingService/FindPred", in, out, opts...)
@@ -656,6 +1088,15 @@ func (c *ringServiceClient) FindPred(ctx context.Context, in *FindPredRequest, o
 	return out, nil
 }
 
+func (c *ringServiceClient) LookupStep(ctx context.Context, in *LookupStepRequest, opts ...grpc.CallOption) (*LookupStepReply, error) {
+	out := new(LookupStepReply)
+	err := c.cc.Invoke(ctx, "/dht.RingService/LookupStep", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *ringServiceClient) UpdatePredecessor(ctx context.Context, in *UpdatePredRequest, opts ...grpc.CallOption) (*UpdateReply, error) {
 	out := new(UpdateReply)
 	err := c.cc.Invoke(ctx, "/dht.RingService/UpdatePredecessor", in, out, opts...)
@@ -719,13 +1160,33 @@ func (c *ringServiceClient) GetKeys(ctx context.Context, in *GetKeysRequest, opt
 	return out, nil
 }
 
+func (c *ringServiceClient) GetTreeLevel(ctx context.Context, in *TreeLevelRequest, opts ...grpc.CallOption) (*TreeLevelReply, error) {
+	out := new(TreeLevelReply)
+	err := c.cc.Invoke(ctx, "/dht.RingService/GetTreeLevel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ringServiceClient) GetBucketKeys(ctx context.Context, in *BucketKeysRequest, opts ...grpc.CallOption) (*BucketKeysReply, error) {
+	out := new(BucketKeysReply)
+	err := c.cc.Invoke(ctx, "/dht.RingService/GetBucketKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // RingServiceServer is the server API for RingService service.
 type RingServiceServer interface {
 	// These request return you succ and pred for specific nodes
 	GetNodeSucc(context.Context, *GetNodeSuccRequest) (*NodeReply, error)
 	GetNodePred(context.Context, *GetNodePredRequest) (*NodeReply, error)
+	GetNodeSelf(context.Context, *GetNodeSelfRequest) (*NodeReply, error)
 	// These request return them for id's
 	FindPred(context.Context, *FindPredRequest) (*NodeReply, error)
+	LookupStep(context.Context, *LookupStepRequest) (*LookupStepReply, error)
 	// Update neighbours data of a node
 	UpdatePredecessor(context.Context, *UpdatePredRequest) (*UpdateReply, error)
 	UpdateSucc(context.Context, *UpdateSuccRequest) (*UpdateReply, error)
@@ -736,6 +1197,9 @@ type RingServiceServer interface {
 	UpdateKeys(context.Context, *UpdateKeysRequest) (*UpdateReply, error)
 	UpdateKeysInfo(context.Context, *UpdateKeysInfoRequest) (*UpdateReply, error)
 	GetKeys(context.Context, *GetKeysRequest) (*KeyReply, error)
+	// Merkle trees over key ranges, so only differing ranges are exchanged
+	GetTreeLevel(context.Context, *TreeLevelRequest) (*TreeLevelReply, error)
+	GetBucketKeys(context.Context, *BucketKeysRequest) (*BucketKeysReply, error)
 }
 
 // UnimplementedRingServiceServer can be embedded to have forward compatible implementations.
@@ -748,9 +1212,15 @@ func (*UnimplementedRingServiceServer) GetNodeSucc(ctx context.Context, req *Get
 func (*UnimplementedRingServiceServer) GetNodePred(ctx context.Context, req *GetNodePredRequest) (*NodeReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetNodePred not implemented")
 }
+func (*UnimplementedRingServiceServer) GetNodeSelf(ctx context.Context, req *GetNodeSelfRequest) (*NodeReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNodeSelf not implemented")
+}
 func (*UnimplementedRingServiceServer) FindPred(ctx context.Context, req *FindPredRequest) (*NodeReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method FindPred not implemented")
 }
+func (*UnimplementedRingServiceServer) LookupStep(ctx context.Context, req *LookupStepRequest) (*LookupStepReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LookupStep not implemented")
+}
 func (*UnimplementedRingServiceServer) UpdatePredecessor(ctx context.Context, req *UpdatePredRequest) (*UpdateReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdatePredecessor not implemented")
 }
@@ -772,6 +1242,12 @@ func (*UnimplementedRingServiceServer) UpdateKeysInfo(ctx context.Context, req *
 func (*UnimplementedRingServiceServer) GetKeys(ctx context.Context, req *GetKeysRequest) (*KeyReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetKeys not implemented")
 }
+func (*UnimplementedRingServiceServer) GetTreeLevel(ctx context.Context, req *TreeLevelRequest) (*TreeLevelReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTreeLevel not implemented")
+}
+func (*UnimplementedRingServiceServer) GetBucketKeys(ctx context.Context, req *BucketKeysRequest) (*BucketKeysReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBucketKeys not implemented")
+}
 
 func RegisterRingServiceServer(s *grpc.Server, srv RingServiceServer) {
 	s.RegisterService(&_RingService_serviceDesc, srv)
@@ -813,6 +1289,24 @@ func _RingService_GetNodePred_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _RingService_GetNodeSelf_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNodeSelfRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RingServiceServer).GetNodeSelf(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/dht.RingService/GetNodeSelf",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RingServiceServer).GetNodeSelf(ctx, req.(*GetNodeSelfRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _RingService_FindPred_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(FindPredRequest)
 	if err := dec(in); err != nil {
@@ -831,6 +1325,24 @@ func _RingService_FindPred_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _RingService_LookupStep_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupStepRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RingServiceServer).LookupStep(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/dht.RingService/LookupStep",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RingServiceServer).LookupStep(ctx, req.(*LookupStepRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _RingService_UpdatePredecessor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(UpdatePredRequest)
 	if err := dec(in); err != nil {
@@ -957,6 +1469,42 @@ func _RingService_GetKeys_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _RingService_GetTreeLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TreeLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RingServiceServer).GetTreeLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/dht.RingService/GetTreeLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RingServiceServer).GetTreeLevel(ctx, req.(*TreeLevelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RingService_GetBucketKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BucketKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RingServiceServer).GetBucketKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/dht.RingService/GetBucketKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RingServiceServer).GetBucketKeys(ctx, req.(*BucketKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _RingService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "dht.RingService",
 	HandlerType: (*RingServiceServer)(nil),
@@ -969,10 +1517,18 @@ var _RingService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetNodePred",
 			Handler:    _RingService_GetNodePred_Handler,
 		},
+		{
+			MethodName: "GetNodeSelf",
+			Handler:    _RingService_GetNodeSelf_Handler,
+		},
 		{
 			MethodName: "FindPred",
 			Handler:    _RingService_FindPred_Handler,
 		},
+		{
+			MethodName: "LookupStep",
+			Handler:    _RingService_LookupStep_Handler,
+		},
 		{
 			MethodName: "UpdatePredecessor",
 			Handler:    _RingService_UpdatePredecessor_Handler,
@@ -1001,6 +1557,14 @@ var _RingService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetKeys",
 			Handler:    _RingService_GetKeys_Handler,
 		},
+		{
+			MethodName: "GetTreeLevel",
+			Handler:    _RingService_GetTreeLevel_Handler,
+		},
+		{
+			MethodName: "GetBucketKeys",
+			Handler:    _RingService_GetBucketKeys_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "ring.proto",
@@ -0,0 +1,211 @@
+package dht
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"net"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+////////
+// Identity of the callers
+////////
+
+// NodeUnit is the organizational unit of certificates issued to ring nodes. Certificates of clients
+// don't have it, so they can only use the storage calls.
+const NodeUnit = "node"
+
+// Nodes are told apart by the public keys of their certificates
+type nodeKey [sha256.Size]byte
+
+func certKey(cert *x509.Certificate) nodeKey {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
+
+// CallerCert returns the certificate of the caller. Plaintext connections (local tests)
+// carry no certificate to check, nil is returned for them without an error.
+func CallerCert(ctx context.Context) (*x509.Certificate, error) {
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, nil
+	}
+
+	if len(info.State.PeerCertificates) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "no certificate")
+	}
+
+	return info.State.PeerCertificates[0], nil
+}
+
+// VerifyNode checks that the caller has a certificate of a ring node
+func VerifyNode(ctx context.Context) error {
+
+	cert, err := CallerCert(ctx)
+	if err != nil || cert == nil {
+		return err
+	}
+
+	for _, unit := range cert.Subject.OrganizationalUnit {
+		if unit == NodeUnit {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%s isn't a ring node", cert.Subject.CommonName)
+}
+
+// CallerIs checks that the caller's certificate is issued for the host of ip
+func CallerIs(ctx context.Context, ip string) error {
+
+	cert, err := CallerCert(ctx)
+	if err != nil || cert == nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(ip)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "bad address %s: %v", ip, err)
+	}
+
+	if err := cert.VerifyHostname(host); err != nil {
+		return status.Errorf(codes.PermissionDenied, "caller isn't %s: %v", ip, err)
+	}
+
+	return nil
+}
+
+// verifyCaller checks that the caller is the node it claims to be: a ring node with a certificate
+// issued for its IP, and the id wasn't claimed with another key before. The first key an id is
+// seen with is kept until the node restarts.
+func (n *RingNode) verifyCaller(ctx context.Context, node finger) error {
+
+	if err := VerifyNode(ctx); err != nil {
+		return err
+	}
+	if err := CallerIs(ctx, node.IP); err != nil {
+		return err
+	}
+
+	cert, err := CallerCert(ctx)
+	if err != nil || cert == nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := certKey(cert)
+	if known, ok := n.identities[node.ID]; ok && known != key {
+		return status.Errorf(codes.PermissionDenied, "%s is claimed by another node", node.ID)
+	}
+	n.identities[node.ID] = key
+
+	return nil
+}
+
+// knownAs checks that the caller already proved to be node
+func (n *RingNode) knownAs(ctx context.Context, node finger) bool {
+
+	cert, err := CallerCert(ctx)
+	if err != nil || cert == nil || CallerIs(ctx, node.IP) != nil {
+		return false
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	known, ok := n.identities[node.ID]
+	return ok && known == certKey(cert)
+}
+
+// verifyNeighbour checks that the caller is one of the nodes we know. Changes that nodes pass on
+// for others come from their neighbours.
+func (n *RingNode) verifyNeighbour(ctx context.Context) error {
+
+	if err := VerifyNode(ctx); err != nil {
+		return err
+	}
+
+	cert, err := CallerCert(ctx)
+	if err != nil || cert == nil {
+		return err
+	}
+
+	for _, ip := range n.Neighbours() {
+		if CallerIs(ctx, ip) == nil {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%s isn't a neighbour", cert.Subject.CommonName)
+}
+
+// verifyRelay checks a claim about node that might be passed on by a neighbour. Returns true if
+// the caller is the node itself, only then the claimed address can be trusted.
+func (n *RingNode) verifyRelay(ctx context.Context, node finger) (bool, error) {
+
+	cert, err := CallerCert(ctx)
+	if err != nil {
+		return false, err
+	}
+	if cert == nil || n.knownAs(ctx, node) {
+		return true, nil
+	}
+
+	// Neighbours on the same host could claim ids of others, so they don't get to bind them
+	if n.verifyNeighbour(ctx) == nil {
+		return false, nil
+	}
+
+	// Joining node telling about itself
+	if err := n.verifyCaller(ctx, node); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// recordGivers remembers which node gave us the keys, the data behind them comes from it
+func (n *RingNode) recordGivers(ctx context.Context, keys []string) {
+
+	cert, err := CallerCert(ctx)
+	if err != nil || cert == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, k := range keys {
+		n.givers[k] = certKey(cert)
+	}
+}
+
+// VerifyGiver checks that the caller is the node that gave us the key, nobody else hands its data over
+func (n *RingNode) VerifyGiver(ctx context.Context, key string) error {
+
+	cert, err := CallerCert(ctx)
+	if err != nil || cert == nil {
+		return err
+	}
+
+	n.mu.RLock()
+	giver, ok := n.givers[key]
+	n.mu.RUnlock()
+
+	if !ok || giver != certKey(cert) {
+		return status.Errorf(codes.PermissionDenied, "%s wasn't given to us by %s", key, cert.Subject.CommonName)
+	}
+
+	return nil
+}
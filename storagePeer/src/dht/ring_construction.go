@@ -1,19 +1,26 @@
 package dht
 
 import (
+	"container/list"
+	"errors"
 	"fmt"
+	"strconv"
 )
 
 ////////
 // Code for initial join of a node to the ring
 ////////
 
+// ErrIDTaken is returned by Join when another alive node has the same id
+var ErrIDTaken = errors.New("id is already taken")
+
 // Join initializes finger table with peers' values
-func (n *RingNode) Join(existingIP string) {
+func (n *RingNode) Join(existingIP string) error {
 
 	if len(existingIP) == 0 {
 
 		// First join
+		n.mu.Lock()
 
 		// Init finger table
 		for i := int64(0); i < int64(len(n.fingerTable)); i++ {
@@ -24,14 +31,17 @@ func (n *RingNode) Join(existingIP string) {
 
 		// Init a predecessor
 		n.predecessor = n.fingerTable[len(n.fingerTable)-1] // TODO: panics when one node in network
+		n.mu.Unlock()
 
 	} else {
 
 		// First initialize your succ and pred
-		n.initClosest(existingIP)
+		if err := n.initClosest(existingIP); err != nil {
+			return err
+		}
 
 		// First we deal with succ lists since they are important for correctness
-		err := n.initSuccList()
+		err := n.initSuccList(list.New())
 		if err != nil {
 			panic(err)
 		}
@@ -44,36 +54,97 @@ func (n *RingNode) Join(existingIP string) {
 	// Launch fix routine
 	go n.fixRoutine(n.deltaT)
 	// Notify server about yourself
+	return nil
+}
+
+// JoinWithSalt joins the ring, if the id is taken a salted one is tried instead (at most attempts times)
+func (n *RingNode) JoinWithSalt(existingIP string, attempts int) error {
+
+	id := n.self.ID
+	for salt := 1; ; salt++ {
+
+		err := n.Join(existingIP)
+		if !errors.Is(err, ErrIDTaken) || salt > attempts {
+			return err
+		}
+
+		fmt.Println(err.Error())
+		n.setID(Hash(append(id.Bytes(), strconv.Itoa(salt)...)))
+		fmt.Printf("%s tries id %s\n", n.self.IP, n.self.ID)
+	}
+}
+
+// Change id of the node before it joins
+func (n *RingNode) setID(id ID) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.self.ID = id
+	n.self.start = id
+	n.predecessor = finger{}
+	for i := range n.fingerTable {
+		n.fingerTable[i] = finger{}
+	}
+}
+
+// taken checks whether node is someone else with our id. Our own old address (after a move) doesn't count.
+func (n *RingNode) taken(node finger) bool {
+
+	if node.ID != n.self.ID || node.IP == n.self.IP {
+		return false
+	}
+
+	other, err := n.invokeGetSelf(node.IP)
+	return err == nil && other.ID == n.self.ID
 }
 
 ///// Say hello to your closest friends
 
 // First init your succ and pred and tell them about yourself
-func (n *RingNode) initClosest(existingIP string) {
+func (n *RingNode) initClosest(existingIP string) error {
 
-	existingNode := finger{IP: existingIP, ID: Hash([]byte(existingIP), n.maxNodes)}
+	// Ids don't depend on IPs, so ask the node itself
+	existingNode, err := n.invokeGetSelf(existingIP)
+	if err != nil {
+		panic(err)
+	}
 
-	// First get successor and predecessor
-	n.predecessor = n.recursivePredFindingStep(n.self.ID, existingNode, n.self)
+	// Lookups can't tell two nodes with the same id apart
+	if n.taken(existingNode) {
+		return fmt.Errorf("%w: %s is used by %s", ErrIDTaken, n.self.ID, existingNode.IP)
+	}
 
-	succ, err := n.invokeGetSucc(n.predecessor.IP)
+	// First get successor and predecessor
+	pred, succ, _, err := n.lookupFrom([]finger{existingNode}, n.self.ID)
 	if err != nil {
-		panic("Couldn't get a successor!")
+		return err
 	}
+	n.mu.Lock()
+	n.predecessor = pred
+	n.mu.Unlock()
 
-	n.fingerTable[0] = succ
-	n.fingerTable[0].start = n.self.ID + 1
+	// Our id is the successor's one, nobody is told about us yet
+	if n.taken(succ) {
+		return fmt.Errorf("%w: %s is used by %s", ErrIDTaken, n.self.ID, succ.IP)
+	}
 
 	// Now get his keys
-	succKeys, err := n.invokeGetKeys(n.fingerTable[0].IP)
+	succKeys, err := n.invokeGetKeys(succ.IP)
 	if err != nil {
 		panic(err)
 	}
+
+	n.mu.Lock()
+	n.fingerTable[0] = succ
+	n.fingerTable[0].start = n.fingerIndex(0, true)
 	n.succKeys = succKeys
+	n.mu.Unlock()
 
 	// Update others
-	n.insertYourself(n.predecessor.IP, succ.IP)
+	n.insertYourself(pred.IP, succ.IP)
 
+	return nil
 }
 
 // Insert yourself as succ and pred of neighbour node
@@ -93,37 +164,43 @@ func (n *RingNode) insertYourself(predIP string, succIP string) {
 
 ///// Succ lists
 
-// Get information about closest neighbours
-func (n *RingNode) initSuccList() error{
+// Get information about closest neighbours. Keys of the nodes from known list are only synced, not fetched.
+// The list is built aside and replaces the old one only when it's complete.
+func (n *RingNode) initSuccList(known *list.List) error{
 
-	first, err := n.invokeGetSucc(n.fingerTable[0].IP)
+	succs := list.New()
+	first, err := n.invokeGetSucc(n.successor().IP)
 	if err != nil {
 		return err
 	}
 
-	succKeys, err := n.invokeGetKeys(first.IP)
+	succKeys, err := n.fetchKeys(first.IP, known)
 	if err != nil {
 		return err
 	}
 
-	n.succList.PushBack(neighbour{node:finger{IP: first.IP, ID: first.ID}, keys:succKeys})
+	succs.PushBack(neighbour{node:finger{IP: first.IP, ID: first.ID}, keys:succKeys})
 
 	for i := uint64(1); i < n.succListSize; i++ {
 
-		node, err := n.invokeGetSucc(n.succList.Back().Value.(neighbour).node.IP)
+		node, err := n.invokeGetSucc(succs.Back().Value.(neighbour).node.IP)
 		if err != nil {
 			return err
 		}
 
 		// You have to store their keys
-		succKeys, err = n.invokeGetKeys(node.IP)
+		succKeys, err = n.fetchKeys(node.IP, known)
 		if err != nil {
 			return err
 		}
 
-		n.succList.PushBack(neighbour{node:finger{IP: node.IP, ID: node.ID}, keys:succKeys})
+		succs.PushBack(neighbour{node:finger{IP: node.IP, ID: node.ID}, keys:succKeys})
 	}
 
+	n.mu.Lock()
+	n.succList = succs
+	n.mu.Unlock()
+
 	return nil
 }
 
@@ -140,30 +217,38 @@ func (n *RingNode) initFingerTable() {
 
 		//fmt.Printf("finger %d with start %d\n", i, start)
 
-		if n.inInterval(n.predecessor.ID, n.self.ID, start, true, false) {
+		n.mu.RLock()
+		pred, prev, succ := n.predecessor, n.fingerTable[i-1], n.fingerTable[0]
+		n.mu.RUnlock()
+
+		var f finger
+		if n.inInterval(pred.ID, n.self.ID, start, true, false) {
 			// It means that new node is responsible for theese keys
-			n.fingerTable[i] = n.self
+			f = n.self
 
 		} else {
-			if n.inInterval(n.self.ID, n.fingerTable[i-1].ID, start, true, false) {
+			if n.inInterval(n.self.ID, prev.ID, start, true, false) {
 
-				n.fingerTable[i] = n.fingerTable[i-1]
+				f = prev
 				//fmt.Printf("using old one\n")
 
 			} else {
 
-				pred := n.recursivePredFindingStep(start, n.fingerTable[0], n.self)
-				succ, err := n.invokeGetSucc(pred.IP)
+				_, s, _, err := n.lookupFrom([]finger{succ}, start)
 				if err != nil {
 					panic(err)
 				}
 
-				n.fingerTable[i] = succ
+				f = s
 				//fmt.Printf("got pred %s\n", pred.IP)
 				//fmt.Printf("asked %s got %s\n", existingIP, succ.IP)
 			}
 		}
-		n.fingerTable[i].start = start
+		f.start = start
+
+		n.mu.Lock()
+		n.fingerTable[i] = f
+		n.mu.Unlock()
 	}
 }
 
@@ -174,7 +259,10 @@ func (n *RingNode) updateOthersFingerTables() {
 
 	for i := int64(0); i < int64(len(n.fingerTable)); i++ {
 
-		p := n.recursivePredFindingStep(n.fingerIndex(i, false), n.fingerTable[0], n.self) // Don't use your own table
+		p, succ, _, err := n.lookupFrom([]finger{n.successor()}, n.fingerIndex(i, false)) // Don't use your own table
+		if err != nil {
+			panic(err)
+		}
 
 		if p.IP == n.self.IP {
 			break
@@ -183,11 +271,6 @@ func (n *RingNode) updateOthersFingerTables() {
 		//fmt.Printf("For %d: %d id got %d\n", i, n.fingerIndex(i, false), p.ID)
 
 		// If this anticlockwise finger hits some node exactly then we also have to change it's fingers
-		succ, err := n.invokeGetSucc(p.IP)
-		if err != nil {
-			panic(err)
-		}
-
 		var target string
 		target = p.IP
 
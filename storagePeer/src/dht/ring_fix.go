@@ -2,7 +2,6 @@ package dht
 
 import (
   "time"
-  "container/list"
   "fmt"
 )
 ////////
@@ -14,7 +13,8 @@ func (n *RingNode) fixSuccList() {
   var res bool = false
 
   // Check how are your successors doing
-  for el := n.succList.Front(); el != nil; el = el.Next() {
+  known := n.succSnapshot()
+  for el := known.Front(); el != nil; el = el.Next() {
 
     val := el.Value.(neighbour)
     _, err := n.invokeGetPred(val.node.IP)
@@ -23,11 +23,10 @@ func (n *RingNode) fixSuccList() {
   }
 
   // TODO: Change total reconstruction to something more intellengent (I am sorry for this :( )
-  if res || (uint64(n.succList.Len()) != n.succListSize) {
+  if res || (uint64(known.Len()) != n.succListSize) {
     // In case they haven't updated their succ yet. Try again
     for {
-      n.succList = list.New()
-      err := n.initSuccList()
+      err := n.initSuccList(known)
       if err == nil {
         //fmt.Printf("%d: trying again\n", n.self.ID)
         break
@@ -40,7 +39,7 @@ func (n *RingNode) fixSuccList() {
 func (n *RingNode) fixSuccessor() {
 
   // Check successor
-  oldSucc := n.fingerTable[0].IP
+  oldSucc := n.successor().IP
   _, err := n.invokeGetPred(oldSucc)
 
   if err != nil {
@@ -48,46 +47,55 @@ func (n *RingNode) fixSuccessor() {
     // Notify server
     n.notifyAboutDeath(oldSucc)
 
-    deadKeys := n.succKeys
+    n.mu.RLock()
+    deadKeys := append([]string{}, n.succKeys...)
+    n.mu.RUnlock()
+
     // Find the first alive node and give it the ownership of dead nodes keys
-    for el := n.succList.Front(); el != nil; el = n.succList.Front() {
+    for el := n.succFront(); el != nil; el = n.succFront() {
 
       val := el.Value.(neighbour)
       _, err := n.invokeGetPred(val.node.IP)
 
       if err != nil {
         deadKeys = append(deadKeys, val.keys...)
-        n.succList.Remove(n.succList.Front())
+        n.mu.Lock()
+        n.succList.Remove(el)
+        n.mu.Unlock()
         // And remember his keys
       } else {
         // Update ourselfs
-        newSucc := n.succList.Front().Value.(neighbour).node
+        newSucc := val.node
+        n.mu.Lock()
         n.fingerTable[0].IP = newSucc.IP
         n.fingerTable[0].ID = newSucc.ID
-        n.succList.Remove(n.succList.Front())
+        n.succList.Remove(el)
+        n.mu.Unlock()
 
         // Update this dude
-        n.invokeUpdatePredecessor(n.fingerTable[0].IP)
+        n.invokeUpdatePredecessor(newSucc.IP)
 
         // Send him new keys
-        ok, err := n.invokeUpdateKeys(newSucc.IP, deadKeys)
+        ok, err := n.invokeUpdateKeys(newSucc.IP, deadKeys, true)
         if !ok || err != nil {
           panic(err)
         }
 
-        // Get all of his keys as succKeys
-        succKeys, err := n.invokeGetKeys(newSucc.IP)
+        // Get all of his keys as succKeys. We know them already, so only sync the difference
+        succKeys, err := n.syncKeys(newSucc.IP, append(val.keys, deadKeys...))
         if err != nil {
           panic(err)
         }
+        n.mu.Lock()
         n.succKeys = succKeys
+        n.mu.Unlock()
 
         break
       }
     }
 
-    if (n.fingerTable[0].IP == oldSucc) && (n.succList.Len() == 0) {
-      panic(fmt.Sprintf("%d lost everyone during fix", n.self.ID))
+    if (n.successor().IP == oldSucc) && (n.succFront() == nil) {
+      panic(fmt.Sprintf("%s lost everyone during fix", n.self.ID))
     }
   } else {
     // Check if pred points to us incase something went wrong (concurrent join)
@@ -107,6 +115,7 @@ func (n *RingNode) fixRoutine(deltaT time.Duration) {
     default:
       n.fixSuccessor()
       n.fixSuccList()
+      n.refreshNeighbourKeys()
     }
   }
 }
@@ -1,26 +1,252 @@
 package dht
 
 import (
+  "fmt"
+
   "golang.org/x/net/context"
-  "google.golang.org/grpc"
 )
 
 ////////
 // Local
 ///////
 
-func (n *RingNode) SaveKey(key string) {
+// SaveKey adds the key and tells the predecessor about it. The key is ours even if the predecessor
+// doesn't answer, its copy of our keys catches up when it syncs with us.
+func (n *RingNode) SaveKey(key string) error {
+
+  n.mu.Lock()
+
+  // Rewriting a file doesn't make it a new key
+  if n.hasKey(key) {
+    n.mu.Unlock()
+    return nil
+  }
 
   // Add it to yourself
   n.keys = append(n.keys, key)
+  n.updateTrees(key, false, true)
+  n.version++
+  predIP := n.predecessor.IP
+  n.mu.Unlock()
 
   // Propogate the info back
   keys := make([]string, 1)
   keys[0] = key
 
-  ok, err := n.invokeUpdateKeysInfo(n.predecessor.IP, n.self.ID, keys)
-  if !ok || err != nil {
-    panic(err)
+  ok, err := n.invokeUpdateKeysInfo(predIP, n.self.ID, keys)
+  if err != nil {
+    return fmt.Errorf("telling %s about %s: %v", predIP, key, err)
+  }
+  if !ok {
+    return fmt.Errorf("%s didn't take %s", predIP, key)
+  }
+
+  return nil
+}
+
+// HasKey checks whether this node is responsible for the key
+func (n *RingNode) HasKey(key string) bool {
+
+  n.mu.RLock()
+  defer n.mu.RUnlock()
+
+  return n.hasKey(key)
+}
+
+func (n *RingNode) hasKey(key string) bool {
+
+  for _, k := range n.keys {
+    if k == key {
+      return true
+    }
+  }
+
+  return false
+}
+
+// RemoveKey forgets the key locally (e.g. after the file was deleted or handed over)
+func (n *RingNode) RemoveKey(key string) {
+
+  n.mu.Lock()
+  defer n.mu.Unlock()
+
+  n.removeKey(key)
+}
+
+func (n *RingNode) removeKey(key string) {
+
+  for i, k := range n.keys {
+    if k == key {
+      n.keys = append(n.keys[:i], n.keys[i+1:]...)
+      n.updateTrees(key, false, false)
+      n.version++
+      break
+    }
+  }
+
+  if !n.hasReplicaKey(key) {
+    delete(n.digests, key)
+  }
+  delete(n.givers, key)
+}
+
+// Keys returns a copy of the keys this node is responsible for
+func (n *RingNode) Keys() []string {
+
+  n.mu.RLock()
+  defer n.mu.RUnlock()
+
+  keys := make([]string, len(n.keys))
+  copy(keys, n.keys)
+
+  return keys
+}
+
+// ReplicaKeys returns a copy of the keys this node keeps copies of
+func (n *RingNode) ReplicaKeys() []string {
+
+  n.mu.RLock()
+  defer n.mu.RUnlock()
+
+  keys := make([]string, len(n.replicaKeys))
+  copy(keys, n.replicaKeys)
+
+  return keys
+}
+
+// SaveReplicaKey remembers that this node keeps a copy of someone else's key
+func (n *RingNode) SaveReplicaKey(key string) {
+
+  n.mu.Lock()
+  defer n.mu.Unlock()
+
+  n.saveReplicaKey(key)
+}
+
+func (n *RingNode) saveReplicaKey(key string) {
+
+  if !n.hasReplicaKey(key) {
+    n.replicaKeys = append(n.replicaKeys, key)
+    n.updateTrees(key, true, true)
+    n.version++
+  }
+}
+
+func (n *RingNode) hasReplicaKey(key string) bool {
+
+  for _, k := range n.replicaKeys {
+    if k == key {
+      return true
+    }
+  }
+
+  return false
+}
+
+// RemoveReplicaKey forgets a copy of someone else's key
+func (n *RingNode) RemoveReplicaKey(key string) {
+
+  n.mu.Lock()
+  defer n.mu.Unlock()
+
+  for i, k := range n.replicaKeys {
+    if k == key {
+      n.replicaKeys = append(n.replicaKeys[:i], n.replicaKeys[i+1:]...)
+      n.updateTrees(key, true, false)
+      n.version++
+      break
+    }
+  }
+
+  if !n.hasKey(key) {
+    delete(n.digests, key)
+  }
+}
+
+// SetKeyDigest remembers the hash of the shard behind the key
+func (n *RingNode) SetKeyDigest(key string, digest []byte) {
+
+  n.mu.Lock()
+  defer n.mu.Unlock()
+
+  n.digests[key] = digest
+  n.updateDigest(key)
+  n.version++
+}
+
+// KeyDigest returns the hash of the shard behind the key (nil if unknown)
+func (n *RingNode) KeyDigest(key string) []byte {
+
+  n.mu.RLock()
+  defer n.mu.RUnlock()
+
+  return n.digests[key]
+}
+
+// Range returns the (start, end] interval of ids this node is responsible for
+func (n *RingNode) Range() (ID, ID) {
+
+  n.mu.RLock()
+  defer n.mu.RUnlock()
+
+  return n.predecessor.ID, n.self.ID
+}
+
+// RestoreKeys fills key lists with what was found on disk. Nothing is propogated,
+// call it before Join so the ring learns about the keys in a usual way.
+func (n *RingNode) RestoreKeys(keys []string, replicaKeys []string) {
+
+  n.mu.Lock()
+  defer n.mu.Unlock()
+
+  for _, k := range keys {
+    if !n.hasKey(k) {
+      n.keys = append(n.keys, k)
+      n.updateTrees(k, false, true)
+      n.version++
+    }
+  }
+
+  for _, k := range replicaKeys {
+    n.saveReplicaKey(k)
+  }
+}
+
+// ReconcileKeys gives keys that are out of our range (e.g. restored after a restart) to their owners.
+// Data behind them goes through the TransferChannel like during the usual handoff.
+func (n *RingNode) ReconcileKeys() {
+
+  start, end := n.Range()
+  foreign := make(map[string][]string)
+
+  for _, key := range n.Keys() {
+    id := Hash([]byte(key))
+    if n.inInterval(start, end, id, false, true) {
+      continue
+    }
+
+    ip, err := n.FindSuccessor(id)
+    if err != nil || ip == n.self.IP {
+      continue
+    }
+    foreign[ip] = append(foreign[ip], key)
+  }
+
+  for ip, keys := range foreign {
+    n.mu.Lock()
+    for _, key := range keys {
+      n.removeKey(key)
+    }
+    n.mu.Unlock()
+
+    ok, err := n.invokeUpdateKeys(ip, keys, false)
+    if !ok || err != nil {
+      // Keep them until the next restart rather than lose them
+      n.RestoreKeys(keys, nil)
+      continue
+    }
+
+    n.TransferChannel <- KeyTransfer{IP: ip, Keys: keys}
   }
 }
 
@@ -32,16 +258,31 @@ func (n *RingNode) SaveKey(key string) {
 
 func (n *RingNode) UpdateKeys(ctx context.Context, in *UpdateKeysRequest) (*UpdateReply, error) {
 
-  // Add them to the key list
-  n.keys = append(n.keys, in.GetKeys()...)
+  // Any node may give us keys of our range, clients may not
+  if err := VerifyNode(ctx); err != nil {
+    return &UpdateReply{OK: false}, err
+  }
 
-  // Send them to the NewFilesChannel for higher level software to take care of it
+  // Add them to the key list (a restarted node may already have some of them)
+  n.RestoreKeys(in.GetKeys(), nil)
+  n.recordGivers(ctx, in.GetKeys())
+
+  // Send them to the NewFilesChannel for higher level software to take care of it.
+  // Keys of dead nodes go to the InheritedChannel since nobody is going to hand their data over.
   for _, k := range in.GetKeys() {
-    n.NewFilesChannel <- k
+    if in.GetInherited() {
+      n.InheritedChannel <- k
+    } else {
+      n.NewFilesChannel <- k
+    }
   }
 
   // Backpropogate info about new keys
-  ok, err := n.invokeUpdateKeysInfo(n.predecessor.IP, n.self.ID, in.GetKeys())
+  n.mu.RLock()
+  predIP := n.predecessor.IP
+  n.mu.RUnlock()
+
+  ok, err := n.invokeUpdateKeysInfo(predIP, n.self.ID, in.GetKeys())
   if !ok || err != nil {
     panic(err)
   }
@@ -49,22 +290,21 @@ func (n *RingNode) UpdateKeys(ctx context.Context, in *UpdateKeysRequest) (*Upda
   return &UpdateReply{OK: true}, nil
 }
 
-func (n *RingNode) invokeUpdateKeys(invokeIP string, keys []string) (bool, error) {
+func (n *RingNode) invokeUpdateKeys(invokeIP string, keys []string, inherited bool) (bool, error) {
 
-	conn, err := grpc.Dial(invokeIP, grpc.WithInsecure())
+	cl, release, err := getConn(invokeIP)
 	if err != nil {
 		return false, err
 	}
-	cl := NewRingServiceClient(conn)
+	defer release()
 
 	mes, err := cl.UpdateKeys(
 		context.Background(),
-		&UpdateKeysRequest{Keys: keys},
+		&UpdateKeysRequest{Keys: keys, Inherited: inherited},
 	)
 	if err != nil {
 		return false, err
 	}
-	conn.Close()
 
 	return mes.GetOK(), nil
 }
@@ -73,10 +313,21 @@ func (n *RingNode) invokeUpdateKeys(invokeIP string, keys []string) (bool, error
 
 func (n *RingNode) UpdateKeysInfo(ctx context.Context, in *UpdateKeysInfoRequest) (*UpdateReply, error) {
 
-  id := in.GetID()
+  // Keys are passed on by successors
+  if err := n.verifyNeighbour(ctx); err != nil {
+    return &UpdateReply{OK: false}, err
+  }
+
+  id := IDFromBytes(in.GetID())
   ok := false
 
+  // The info went all the way around the ring
+  if id == n.self.ID {
+    return &UpdateReply{OK: true}, nil
+  }
+
   // Decide whether theese keys are relevant to you
+  n.mu.Lock()
   if n.fingerTable[0].ID == id {
 
     n.succKeys = append(n.succKeys, in.GetKeys()...)
@@ -92,10 +343,12 @@ func (n *RingNode) UpdateKeysInfo(ctx context.Context, in *UpdateKeysInfoRequest
       }
     }
   }
+  predIP := n.predecessor.IP
+  n.mu.Unlock()
 
   // Decide whether we should propogate theese keys forward
   if ok {
-    ok, err := n.invokeUpdateKeysInfo(n.predecessor.IP, id, in.GetKeys())
+    ok, err := n.invokeUpdateKeysInfo(predIP, id, in.GetKeys())
     if !ok || err != nil {
       panic(err)
     }
@@ -104,22 +357,21 @@ func (n *RingNode) UpdateKeysInfo(ctx context.Context, in *UpdateKeysInfoRequest
   return &UpdateReply{OK: true}, nil
 }
 
-func (n *RingNode) invokeUpdateKeysInfo(invokeIP string,  updateForID uint64, keys []string) (bool, error) {
+func (n *RingNode) invokeUpdateKeysInfo(invokeIP string,  updateForID ID, keys []string) (bool, error) {
 
-	conn, err := grpc.Dial(invokeIP, grpc.WithInsecure())
+	cl, release, err := getConn(invokeIP)
 	if err != nil {
 		return false, err
 	}
-	cl := NewRingServiceClient(conn)
+	defer release()
 
 	mes, err := cl.UpdateKeysInfo(
 		context.Background(),
-		&UpdateKeysInfoRequest{Keys: keys, ID: updateForID},
+		&UpdateKeysInfoRequest{Keys: keys, ID: updateForID.Bytes()},
 	)
 	if err != nil {
 		return false, err
 	}
-	conn.Close()
 
 	return mes.GetOK(), nil
 }
@@ -128,16 +380,20 @@ func (n *RingNode) invokeUpdateKeysInfo(invokeIP string,  updateForID uint64, ke
 
 func (n *RingNode) GetKeys(ctx context.Context, in *GetKeysRequest) (*KeyReply, error) {
 
-  return &KeyReply{Keys: n.keys}, nil
+  if in.GetReplicas() {
+    return &KeyReply{Keys: n.ReplicaKeys()}, nil
+  }
+
+  return &KeyReply{Keys: n.Keys()}, nil
 }
 
 func (n *RingNode) invokeGetKeys(invokeIP string) ([]string, error) {
 
-  conn, err := grpc.Dial(invokeIP, grpc.WithInsecure())
+	cl, release, err := getConn(invokeIP)
 	if err != nil {
 		return make([]string,0), err
 	}
-	cl := NewRingServiceClient(conn)
+	defer release()
 
 	mes, err := cl.GetKeys(
 		context.Background(),
@@ -146,7 +402,6 @@ func (n *RingNode) invokeGetKeys(invokeIP string) ([]string, error) {
 	if err != nil {
 		return make([]string,0), err
 	}
-	conn.Close()
 
 	return mes.GetKeys(), nil
 }
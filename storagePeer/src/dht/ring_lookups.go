@@ -1,78 +1,145 @@
 package dht
 
 import (
-  //"errors"
-  "golang.org/x/net/context"
-	"google.golang.org/grpc"
-  "fmt"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
 )
 
 ////////
 // Finding responsible nodes
 ////////
 
-// Find closest predecessing finger from the personal table
-func (n *RingNode) getClosestPreceding(id uint64) (finger, error) {
+// How long a lookup waits for one node before going to the next-best one
+const hopTimeout = 2 * time.Second
 
-	for i := len(n.fingerTable) - 1; i >= 0; i-- {
-		if n.inInterval(n.self.ID, id, n.fingerTable[i].ID, false, false) {
-      // In case dude has fallen just go to the other one
-      _, err := n.invokeGetPred(n.fingerTable[i].IP)
-      if err == nil {
-        return n.fingerTable[i], nil
-      }
+// How many fallback nodes one lookup step returns
+const lookupCandidates = 8
+
+// Lookup gives up after so many steps
+const maxHops = IDBits
+
+// ErrLookupFailed is returned when no node on the way to the id answered
+var ErrLookupFailed = errors.New("lookup failed")
+
+// Known nodes in (self, id), the closest preceding one first. Nobody is pinged here,
+// dead ones are skipped by the lookup itself.
+func (n *RingNode) closestPreceding(id ID, count int) []finger {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	nodes := make([]finger, 0)
+	add := func(f finger) {
+		if f.IP == "" || seen[f.IP] || !n.inInterval(n.self.ID, id, f.ID, false, false) {
+			return
 		}
+		seen[f.IP] = true
+		nodes = append(nodes, f)
 	}
 
-  return n.self, nil
+	for i := len(n.fingerTable) - 1; i >= 0; i-- {
+		add(n.fingerTable[i])
+	}
+	for el := n.succList.Front(); el != nil; el = el.Next() {
+		add(el.Value.(neighbour).node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return distance(nodes[i].ID, id).Cmp(distance(nodes[j].ID, id)) < 0
+	})
 
+	if len(nodes) > count {
+		nodes = nodes[:count]
+	}
+	return nodes
 }
 
-// Going to reuse this function in findPredecessor and during
-// construction of finger table.
-func (n *RingNode) recursivePredFindingStep(id uint64, remoteNode finger, currNode finger) finger {
+// One step of a lookup: the node as it sees itself (tables might be stale), its successor
+// and the nodes it knows closer to id
+func (n *RingNode) lookupStep(node finger, id ID) (finger, finger, []finger, error) {
 
-	if remoteNode.ID == currNode.ID {
-		return currNode
+	if node.IP == n.self.IP {
+		return n.self, n.successor(), n.closestPreceding(id, lookupCandidates), nil
 	}
 
-	next, err := n.invokeFindPred(remoteNode.IP, id)
-	if err != nil {
-    fmt.Println("Couldn't make a recursive step.")
-		panic(err)
-	}
+	return n.invokeLookupStep(node.IP, id)
+}
+
+// Iterative lookup of the predecessor of id, starting from the given nodes. Each step asks one
+// node and puts the closer nodes it knows in front of the queue, so if a node doesn't answer in
+// time the next-best one is asked. Returns predecessor, its successor and IPs of the nodes asked.
+func (n *RingNode) lookupFrom(start []finger, id ID) (finger, finger, []string, error) {
+
+	queue := append([]finger{}, start...)
+	path := make([]string, 0)
+	asked := make(map[string]bool)
 
-	//fmt.Printf("recursive step: id %d remote %s ans %s \n", id, remoteNode.IP, next.IP)
+	for hops := 0; len(queue) > 0 && hops < maxHops; hops++ {
 
-	return n.recursivePredFindingStep(id, next, remoteNode)
+		node := queue[0]
+		queue = queue[1:]
+		if asked[node.IP] {
+			continue
+		}
+		asked[node.IP] = true
+
+		self, succ, next, err := n.lookupStep(node, id)
+		if err != nil {
+			fmt.Printf("Lookup of %s: %s failed, trying the next one\n", id, node.IP)
+			continue
+		}
+		node = self
+		path = append(path, node.IP)
+
+		if n.inInterval(node.ID, succ.ID, id, false, true) {
+			return node, succ, path, nil
+		}
+
+		// Only nodes between this one and id bring us closer
+		closer := make([]finger, 0, len(next))
+		for _, f := range next {
+			if !asked[f.IP] && n.inInterval(node.ID, id, f.ID, false, false) {
+				closer = append(closer, f)
+			}
+		}
+		queue = append(closer, queue...)
+	}
+
+	return finger{}, finger{}, path, fmt.Errorf("%w: %s after %v", ErrLookupFailed, id, path)
 }
 
 // Find predecessor in a ring
-func (n *RingNode) findPredecessor(id uint64) (finger, error) {
+func (n *RingNode) findPredecessor(id ID) (finger, error) {
 
-	nextTarget, err := n.getClosestPreceding(id)
-	if err != nil {
-		return finger{}, err
-	}
+	pred, _, _, err := n.lookupFrom([]finger{n.self}, id)
+	return pred, err
+}
 
-	// Ask the node for the closest ones in its table recursivly
-	return n.recursivePredFindingStep(id, nextTarget, n.self), nil
+// Route is the answer of a lookup: node at IP is responsible for ids in (Start, End]
+type Route struct {
+	Start ID
+	End   ID
+	IP    string
+	Path  []string // Nodes the lookup went through
 }
 
-// FindSuccessor finds successor node for a given id
-func (n *RingNode) FindSuccessor(id uint64) (string, error) {
+// Lookup finds successor node for a given id together with its range and the path the lookup took
+func (n *RingNode) Lookup(id ID) (Route, error) {
 
-	pred, err := n.findPredecessor(id)
-	if err != nil {
-		panic(err)
-	}
+	pred, succ, path, err := n.lookupFrom([]finger{n.self}, id)
+	return Route{Start: pred.ID, End: succ.ID, IP: succ.IP, Path: path}, err
+}
 
-	if pred.IP == n.self.IP {
-		return n.fingerTable[0].IP, nil
-	}
+// FindSuccessor finds successor node for a given id
+func (n *RingNode) FindSuccessor(id ID) (string, error) {
 
-	ans, err := n.invokeGetSucc(pred.IP)
-	return ans.IP, err
+	route, err := n.Lookup(id)
+	return route.IP, err
 }
 
 ////////
@@ -83,12 +150,17 @@ func (n *RingNode) FindSuccessor(id uint64) (string, error) {
 
 // GetNodeSucc gets successor of a node
 func (n *RingNode) GetNodeSucc(ctx context.Context, in *GetNodeSuccRequest) (*NodeReply, error) {
-	return &NodeReply{IP: n.fingerTable[0].IP, ID: n.fingerTable[0].ID}, nil
+	succ := n.successor()
+	return &NodeReply{IP: succ.IP, ID: succ.ID.Bytes()}, nil
 }
 
 func (n *RingNode) invokeGetSucc(IP string) (finger, error) {
 
-	conn, cl := getConn(IP)
+	cl, release, err := getConn(IP)
+	if err != nil {
+		return finger{}, err
+	}
+	defer release()
 
 	mes, err := cl.GetNodeSucc(
 		context.Background(),
@@ -97,18 +169,22 @@ func (n *RingNode) invokeGetSucc(IP string) (finger, error) {
 	if err != nil {
 		return finger{}, err
 	}
-	conn.Close()
 
-	return finger{ID: mes.GetID(), IP: mes.GetIP()}, nil
+	return finger{ID: IDFromBytes(mes.GetID()), IP: mes.GetIP()}, nil
 }
 
 // GetNodePred gets the predecessor of a node
 func (n *RingNode) GetNodePred(ctx context.Context, in *GetNodePredRequest) (*NodeReply, error) {
-	return &NodeReply{IP: n.predecessor.IP, ID: n.predecessor.ID}, nil
+	pred := n.pred()
+	return &NodeReply{IP: pred.IP, ID: pred.ID.Bytes()}, nil
 }
 func (n *RingNode) invokeGetPred(IP string) (finger, error) {
 
-	conn, cl := getConn(IP)
+	cl, release, err := getConn(IP)
+	if err != nil {
+		return finger{}, err
+	}
+	defer release()
 
 	mes, err := cl.GetNodePred(
 		context.Background(),
@@ -117,35 +193,83 @@ func (n *RingNode) invokeGetPred(IP string) (finger, error) {
 	if err != nil {
 		return finger{}, err
 	}
-	conn.Close()
 
-	return finger{ID: mes.GetID(), IP: mes.GetIP()}, nil
+	return finger{ID: IDFromBytes(mes.GetID()), IP: mes.GetIP()}, nil
 }
 
-//// Recursive finding
-
-// FindPred finds predecessor of certain id
-func (n *RingNode) FindPred(ctx context.Context, in *FindPredRequest) (*NodeReply, error) {
-	res, err := n.getClosestPreceding(in.ID)
-	return &NodeReply{IP: res.IP, ID: res.ID}, err
+// GetNodeSelf tells who the node is. ID doesn't depend on the IP, so it has to be asked for.
+func (n *RingNode) GetNodeSelf(ctx context.Context, in *GetNodeSelfRequest) (*NodeReply, error) {
+	return &NodeReply{IP: n.self.IP, ID: n.self.ID.Bytes()}, nil
 }
 
-func (n *RingNode) invokeFindPred(invokeIP string, id uint64) (finger, error) {
+func (n *RingNode) invokeGetSelf(IP string) (finger, error) {
 
-	conn, err := grpc.Dial(invokeIP, grpc.WithInsecure())
+	cl, release, err := getConn(IP)
 	if err != nil {
 		return finger{}, err
 	}
-	cl := NewRingServiceClient(conn)
+	defer release()
 
-	mes, err := cl.FindPred(
+	mes, err := cl.GetNodeSelf(
 		context.Background(),
-		&FindPredRequest{ID: id},
+		&GetNodeSelfRequest{},
 	)
 	if err != nil {
 		return finger{}, err
 	}
-	conn.Close()
 
-	return finger{ID: mes.GetID(), IP: mes.GetIP()}, nil
+	return finger{ID: IDFromBytes(mes.GetID()), IP: mes.GetIP()}, nil
+}
+
+//// Lookups
+
+// FindPred returns the closest preceding node of certain id the node knows
+func (n *RingNode) FindPred(ctx context.Context, in *FindPredRequest) (*NodeReply, error) {
+
+	res := n.self
+	if nodes := n.closestPreceding(IDFromBytes(in.ID), 1); len(nodes) > 0 {
+		res = nodes[0]
+	}
+	return &NodeReply{IP: res.IP, ID: res.ID.Bytes()}, nil
+}
+
+// LookupStep tells the successor of the node and who it knows closer to the id
+func (n *RingNode) LookupStep(ctx context.Context, in *LookupStepRequest) (*LookupStepReply, error) {
+
+	succ := n.successor()
+	reply := &LookupStepReply{
+		Self: &NodeReply{IP: n.self.IP, ID: n.self.ID.Bytes()},
+		Succ: &NodeReply{IP: succ.IP, ID: succ.ID.Bytes()},
+	}
+	for _, f := range n.closestPreceding(IDFromBytes(in.ID), lookupCandidates) {
+		reply.Candidates = append(reply.Candidates, &NodeReply{IP: f.IP, ID: f.ID.Bytes()})
+	}
+
+	return reply, nil
+}
+
+func (n *RingNode) invokeLookupStep(invokeIP string, id ID) (finger, finger, []finger, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), hopTimeout)
+	defer cancel()
+
+	cl, release, err := getConn(invokeIP)
+	if err != nil {
+		return finger{}, finger{}, nil, err
+	}
+	defer release()
+
+	mes, err := cl.LookupStep(ctx, &LookupStepRequest{ID: id.Bytes()})
+	if err != nil {
+		return finger{}, finger{}, nil, err
+	}
+
+	next := make([]finger, 0, len(mes.GetCandidates()))
+	for _, c := range mes.GetCandidates() {
+		next = append(next, finger{ID: IDFromBytes(c.GetID()), IP: c.GetIP()})
+	}
+
+	self := finger{ID: IDFromBytes(mes.GetSelf().GetID()), IP: mes.GetSelf().GetIP()}
+	succ := finger{ID: IDFromBytes(mes.GetSucc().GetID()), IP: mes.GetSucc().GetIP()}
+	return self, succ, next, nil
 }
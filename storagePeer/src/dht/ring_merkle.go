@@ -0,0 +1,467 @@
+package dht
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"math/big"
+	"sort"
+
+	"golang.org/x/net/context"
+)
+
+////////
+// Merkle trees over key ranges, so neighbours only exchange the ranges that differ
+////////
+
+// Tree has 2^merkleDepth leaves, each leaf covers an equal part of the key range
+const merkleDepth = 6
+
+// How many trees a node keeps up to date for the ranges its neighbours ask about
+const maxTrees = 8
+
+type merkleTree struct {
+	// levels[0] is the root, levels[merkleDepth] are the leaves
+	levels  [][][]byte
+	buckets [][]string
+}
+
+// What a tree is built over: keys (or replicas) inside (start, end], with or without digests
+type treeSpec struct {
+	start    ID
+	end      ID
+	replicas bool
+	digests  bool
+}
+
+type cachedTree struct {
+	treeSpec
+	*merkleTree
+}
+
+// Distance from one id to another going clockwise
+func distance(from ID, to ID) *big.Int {
+
+	d := new(big.Int).Sub(to.big(), from.big())
+	return d.Mod(d, idSpace)
+}
+
+// Leaf of the (start, end] range that id falls into. start == end means the whole ring.
+func bucket(start ID, end ID, id ID) uint32 {
+
+	width := distance(start, end)
+	if width.Sign() == 0 {
+		width = idSpace
+	}
+
+	offset := distance(start, id)
+	if offset.Sign() == 0 {
+		offset = new(big.Int).Set(idSpace)
+	}
+	offset.Sub(offset, big.NewInt(1))
+
+	b := offset.Lsh(offset, merkleDepth)
+	b.Div(b, width)
+
+	return uint32(b.Uint64())
+}
+
+// Build a tree over the keys inside (start, end]. Digests of shards are included if withDigests is set.
+func (n *RingNode) buildTree(start ID, end ID, entries map[string][]byte, withDigests bool) *merkleTree {
+
+	t := merkleTree{
+		levels:  make([][][]byte, merkleDepth+1),
+		buckets: make([][]string, 1<<merkleDepth),
+	}
+
+	for k := range entries {
+		id := Hash([]byte(k))
+		if n.inInterval(start, end, id, false, true) {
+			b := bucket(start, end, id)
+			t.buckets[b] = append(t.buckets[b], k)
+		}
+	}
+
+	// Leaves
+	leaves := make([][]byte, len(t.buckets))
+	for i, keys := range t.buckets {
+		sort.Strings(keys)
+		leaves[i] = leafHash(keys, entries, withDigests)
+	}
+	t.levels[merkleDepth] = leaves
+
+	// Everything above them
+	for level := merkleDepth - 1; level >= 0; level-- {
+		below := t.levels[level+1]
+		t.levels[level] = make([][]byte, len(below)/2)
+
+		for i := range t.levels[level] {
+			t.levels[level][i] = nodeHash(below[2*i], below[2*i+1])
+		}
+	}
+
+	return &t
+}
+
+// Hash of a leaf with sorted keys
+func leafHash(keys []string, entries map[string][]byte, withDigests bool) []byte {
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		if withDigests {
+			h.Write(entries[k])
+		}
+		h.Write([]byte{0})
+	}
+
+	return h.Sum(nil)
+}
+
+func nodeHash(left []byte, right []byte) []byte {
+
+	h := sha256.New()
+	h.Write(left)
+	h.Write(right)
+
+	return h.Sum(nil)
+}
+
+// set puts the key into leaf b or takes it out. Returns false if there was nothing to do.
+func (t *merkleTree) set(b uint32, key string, present bool) bool {
+
+	keys := t.buckets[b]
+	i := sort.SearchStrings(keys, key)
+	found := i < len(keys) && keys[i] == key
+
+	switch {
+	case present && !found:
+		keys = append(keys, "")
+		copy(keys[i+1:], keys[i:])
+		keys[i] = key
+	case !present && found:
+		keys = append(keys[:i], keys[i+1:]...)
+	default:
+		return false
+	}
+
+	t.buckets[b] = keys
+	return true
+}
+
+// rehash updates leaf b and the hashes on its way to the root
+func (t *merkleTree) rehash(b uint32, entries map[string][]byte, withDigests bool) {
+
+	t.levels[merkleDepth][b] = leafHash(t.buckets[b], entries, withDigests)
+
+	for level := merkleDepth - 1; level >= 0; level-- {
+		b /= 2
+		below := t.levels[level+1]
+		t.levels[level][b] = nodeHash(below[2*b], below[2*b+1])
+	}
+}
+
+// tree returns the kept tree for spec, building it on the first request. Trees with digests
+// have the same leaves, so they do if only keys are needed. Callers hold n.mu.
+func (n *RingNode) tree(spec treeSpec, anyDigests bool) *merkleTree {
+
+	for i, c := range n.trees {
+		if c.start == spec.start && c.end == spec.end && c.replicas == spec.replicas &&
+			(c.digests == spec.digests || anyDigests) {
+			// Recently used ones go to the back
+			n.trees = append(append(n.trees[:i], n.trees[i+1:]...), c)
+			return c.merkleTree
+		}
+	}
+
+	t := n.buildTree(spec.start, spec.end, n.entries(spec.replicas), spec.digests)
+	n.trees = append(n.trees, cachedTree{treeSpec: spec, merkleTree: t})
+	if len(n.trees) > maxTrees {
+		n.trees = n.trees[1:]
+	}
+
+	return t
+}
+
+// updateTrees puts the key into the kept trees over keys (or replicas) or takes it out of them.
+// Callers hold n.mu.
+func (n *RingNode) updateTrees(key string, replicas bool, present bool) {
+
+	id := Hash([]byte(key))
+	for _, c := range n.trees {
+		if c.replicas != replicas || !n.inInterval(c.start, c.end, id, false, true) {
+			continue
+		}
+
+		b := bucket(c.start, c.end, id)
+		if c.set(b, key, present) {
+			c.rehash(b, n.digests, c.digests)
+		}
+	}
+}
+
+// updateDigest rehashes the leaves of the key in trees that include digests. Callers hold n.mu.
+func (n *RingNode) updateDigest(key string) {
+
+	id := Hash([]byte(key))
+	for _, c := range n.trees {
+		if !c.digests || !n.inInterval(c.start, c.end, id, false, true) {
+			continue
+		}
+
+		b := bucket(c.start, c.end, id)
+		if i := sort.SearchStrings(c.buckets[b], key); i < len(c.buckets[b]) && c.buckets[b][i] == key {
+			c.rehash(b, n.digests, true)
+		}
+	}
+}
+
+// Keys of the node (or the replicas it keeps) together with their shard digests. Callers hold n.mu.
+func (n *RingNode) entries(replicas bool) map[string][]byte {
+
+	keys := n.keys
+	if replicas {
+		keys = n.replicaKeys
+	}
+
+	entries := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		entries[k] = n.digests[k]
+	}
+
+	return entries
+}
+
+// CompareKeys compares local entries inside (start, end] with the keys of ip (or the replicas it keeps).
+// Only the hashes of differing subtrees and the keys of differing leaves are transferred.
+// missing are local keys that ip doesn't have (or has with other digest), extra are keys only ip has.
+func (n *RingNode) CompareKeys(ip string, replicas bool, start ID, end ID, local map[string][]byte, withDigests bool) ([]string, []string, error) {
+
+	tree := n.buildTree(start, end, local, withDigests)
+
+	indices := []uint32{0}
+	for level := 0; level <= merkleDepth; level++ {
+
+		remote, err := n.invokeGetTreeLevel(ip, &TreeLevelRequest{
+			Start: start.Bytes(), End: end.Bytes(), Replicas: replicas, Digests: withDigests,
+			Level: uint32(level), Indices: indices,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		differ := make([]uint32, 0)
+		for j, idx := range indices {
+			if j >= len(remote) || !bytes.Equal(remote[j], tree.levels[level][idx]) {
+				differ = append(differ, idx)
+			}
+		}
+
+		if len(differ) == 0 {
+			return []string{}, []string{}, nil
+		}
+
+		if level == merkleDepth {
+			indices = differ
+			break
+		}
+
+		// Go down into the subtrees that differ
+		indices = make([]uint32, 0, 2*len(differ))
+		for _, idx := range differ {
+			indices = append(indices, 2*idx, 2*idx+1)
+		}
+	}
+
+	remoteKeys, remoteDigests, err := n.invokeGetBucketKeys(ip, &BucketKeysRequest{
+		Start: start.Bytes(), End: end.Bytes(), Replicas: replicas, Buckets: indices,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	remote := make(map[string][]byte, len(remoteKeys))
+	for i, k := range remoteKeys {
+		if i < len(remoteDigests) {
+			remote[k] = remoteDigests[i]
+		} else {
+			remote[k] = nil
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, b := range indices {
+		for _, k := range tree.buckets[b] {
+			digest, ok := remote[k]
+			if !ok || (withDigests && !bytes.Equal(digest, local[k])) {
+				missing = append(missing, k)
+			}
+		}
+	}
+
+	extra := make([]string, 0)
+	for _, k := range remoteKeys {
+		if _, ok := local[k]; !ok {
+			extra = append(extra, k)
+		}
+	}
+
+	return missing, extra, nil
+}
+
+// syncKeys brings our copy of ip's keys up to date
+func (n *RingNode) syncKeys(ip string, known []string) ([]string, error) {
+
+	local := make(map[string][]byte, len(known))
+	for _, k := range known {
+		local[k] = nil
+	}
+
+	// Same start and end stand for the whole ring
+	missing, extra, err := n.CompareKeys(ip, false, ID{}, ID{}, local, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range missing {
+		delete(local, k)
+	}
+
+	keys := make([]string, 0, len(local)+len(extra))
+	for k := range local {
+		keys = append(keys, k)
+	}
+
+	return append(keys, extra...), nil
+}
+
+// fetchKeys gets keys of ip. If one of the neighbours is ip, only the difference is transferred.
+func (n *RingNode) fetchKeys(ip string, neighbours *list.List) ([]string, error) {
+
+	for el := neighbours.Front(); el != nil; el = el.Next() {
+		if val := el.Value.(neighbour); val.node.IP == ip {
+			return n.syncKeys(ip, val.keys)
+		}
+	}
+
+	return n.invokeGetKeys(ip)
+}
+
+// refreshNeighbourKeys keeps our copies of succ keys up to date
+func (n *RingNode) refreshNeighbourKeys() {
+
+	n.mu.RLock()
+	succ, succKeys := n.fingerTable[0], n.succKeys
+	n.mu.RUnlock()
+
+	if succ.IP != n.self.IP {
+		if keys, err := n.syncKeys(succ.IP, succKeys); err == nil {
+			n.mu.Lock()
+			if n.fingerTable[0].ID == succ.ID {
+				n.succKeys = keys
+			}
+			n.mu.Unlock()
+		}
+	}
+
+	for el := n.succSnapshot().Front(); el != nil; el = el.Next() {
+		val := el.Value.(neighbour)
+		if val.node.IP == n.self.IP {
+			continue
+		}
+
+		if keys, err := n.syncKeys(val.node.IP, val.keys); err == nil {
+			n.setNeighbourKeys(val.node.ID, keys)
+		}
+	}
+}
+
+////////
+// RPC calls
+////////
+
+// GetTreeLevel returns hashes of the requested nodes on one level of the tree
+func (n *RingNode) GetTreeLevel(ctx context.Context, in *TreeLevelRequest) (*TreeLevelReply, error) {
+
+	level := in.GetLevel()
+	if level > merkleDepth {
+		level = merkleDepth
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	tree := n.tree(treeSpec{
+		start: IDFromBytes(in.GetStart()), end: IDFromBytes(in.GetEnd()),
+		replicas: in.GetReplicas(), digests: in.GetDigests(),
+	}, false)
+
+	hashes := make([][]byte, 0, len(in.GetIndices()))
+	for _, idx := range in.GetIndices() {
+		if int(idx) < len(tree.levels[level]) {
+			hashes = append(hashes, tree.levels[level][idx])
+		} else {
+			hashes = append(hashes, nil)
+		}
+	}
+
+	return &TreeLevelReply{Hashes: hashes}, nil
+}
+
+func (n *RingNode) invokeGetTreeLevel(invokeIP string, req *TreeLevelRequest) ([][]byte, error) {
+
+	cl, release, err := getConn(invokeIP)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	mes, err := cl.GetTreeLevel(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	return mes.GetHashes(), nil
+}
+
+// GetBucketKeys returns keys (and shard digests) of the requested leaves
+func (n *RingNode) GetBucketKeys(ctx context.Context, in *BucketKeysRequest) (*BucketKeysReply, error) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	tree := n.tree(treeSpec{
+		start: IDFromBytes(in.GetStart()), end: IDFromBytes(in.GetEnd()), replicas: in.GetReplicas(),
+	}, true)
+
+	reply := BucketKeysReply{}
+	for _, b := range in.GetBuckets() {
+		if int(b) >= len(tree.buckets) {
+			continue
+		}
+
+		for _, k := range tree.buckets[b] {
+			reply.Keys = append(reply.Keys, k)
+			reply.Digests = append(reply.Digests, n.digests[k])
+		}
+	}
+
+	return &reply, nil
+}
+
+func (n *RingNode) invokeGetBucketKeys(invokeIP string, req *BucketKeysRequest) ([]string, [][]byte, error) {
+
+	cl, release, err := getConn(invokeIP)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	mes, err := cl.GetBucketKeys(context.Background(), req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mes.GetKeys(), mes.GetDigests(), nil
+}
@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"encoding/json"
 	"math"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
@@ -26,9 +27,9 @@ const TOLERABLE_FAIL_PROB = 0.001 // tolerable probability of failure (epsilon)
 
 // Node structure
 type finger struct {
-	start uint64
+	start ID
 	IP    string
-	ID    uint64
+	ID    ID
 }
 
 // Node and it's contents
@@ -37,9 +38,18 @@ type neighbour struct {
 	keys []string
 }
 
+// KeyTransfer describes keys that were handed over to another node.
+// The data behind them still has to be moved by higher level software.
+type KeyTransfer struct {
+	IP   string
+	Keys []string
+}
+
 // RingNode is a Chord node
 type RingNode struct {
-	maxNodes uint64
+
+	// Guards ring and keys information, never held during remote calls
+	mu sync.RWMutex
 
 	// Ring information
 	self        finger
@@ -50,39 +60,59 @@ type RingNode struct {
 	succListSize uint64
 
 	// Keys information
-	keys            []string
-	succKeys        []string
-	keysStartSize   int
-	NewFilesChannel chan string
+	keys             []string
+	succKeys         []string
+	replicaKeys      []string
+	digests          map[string][]byte
+	trees            []cachedTree // Asked for by neighbours, kept up to date as keys change
+	identities       map[ID]nodeKey // Keys the ids were first claimed with
+	givers           map[string]nodeKey // Nodes our keys came from, they hand the data over
+	version          uint64 // Grows with every change of keys, replicas or digests
+	keysStartSize    int
+	NewFilesChannel  chan string
+	InheritedChannel chan string
+	TransferChannel  chan KeyTransfer
 
 	// Fix routine information
 	stopSignal chan struct{}
+	stopOnce   sync.Once
 	deltaT     time.Duration
 }
 
 // NewRingNode is a RingNode constructor. After constructing an object make sure to enable a gRPC server.
-func NewRingNode(ownIP string, maxNodes uint64, deltaT time.Duration) *RingNode {
+// ID of the node is derived from its IP, use NewRingNodeWithID for nodes that can change address.
+func NewRingNode(ownIP string, deltaT time.Duration) *RingNode {
+
+	return NewRingNodeWithID(ownIP, Hash([]byte(ownIP)), deltaT)
+}
 
-	id := Hash([]byte(ownIP), maxNodes)
+// NewRingNodeWithID constructs a node with a persistent id, IP is only used for routing
+func NewRingNodeWithID(ownIP string, id ID, deltaT time.Duration) *RingNode {
 
-	fingSize := uint64(math.RoundToEven(math.Log2(float64(maxNodes))))
+	// One finger for every bit of the id
+	fingSize := IDBits
 	succListSize := uint64(math.Log(TOLERABLE_FAIL_PROB)/math.Log(FAIL_PROB)) - 1 // this -1 apears since first successor is in the fingertable, it's convinient
 
 	const keysStartSize = 0
 
 	n := RingNode{
-		self:            finger{IP: ownIP, ID: id, start: id},
-		predecessor:     finger{},
-		maxNodes:        maxNodes,
-		fingerTable:     make([]finger, fingSize),
-		succList:        list.New(), // at first it's empty
-		succListSize:    succListSize,
-		stopSignal:      make(chan struct{}),
-		deltaT:          deltaT,
-		keys:            make([]string, keysStartSize),
-		succKeys:        make([]string, keysStartSize),
-		keysStartSize:   keysStartSize,
-		NewFilesChannel: make(chan string, 100),
+		self:             finger{IP: ownIP, ID: id, start: id},
+		predecessor:      finger{},
+		fingerTable:      make([]finger, fingSize),
+		succList:         list.New(), // at first it's empty
+		succListSize:     succListSize,
+		stopSignal:       make(chan struct{}),
+		deltaT:           deltaT,
+		keys:             make([]string, keysStartSize),
+		succKeys:         make([]string, keysStartSize),
+		replicaKeys:      make([]string, keysStartSize),
+		digests:          make(map[string][]byte),
+		identities:       make(map[ID]nodeKey),
+		givers:           make(map[string]nodeKey),
+		keysStartSize:    keysStartSize,
+		NewFilesChannel:  make(chan string, 100),
+		InheritedChannel: make(chan string, 100),
+		TransferChannel:  make(chan KeyTransfer, 100),
 	}
 
 	return &n
@@ -97,17 +127,25 @@ func (n *RingNode) Start(grpcServer *grpc.Server) {
 
 // Gracefull shutdown
 func (n *RingNode) Stop() {
-	close(n.stopSignal)
+	n.Halt()
 	n.notifyAboutDeath(n.self.IP)
 }
 
+// Halt stops the fix routine without telling anybody, neighbours find out when they fix the ring
+func (n *RingNode) Halt() {
+	n.stopOnce.Do(func() { close(n.stopSignal) })
+}
+
 // MarshalJSON serializes node for printing
 func (n *RingNode) MarshalJSON() ([]byte, error) {
 
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
 	type PublicFinger struct {
-		Start uint64
+		Start ID
 		IP    string
-		ID    uint64
+		ID    ID
 	}
 
 	type PublicNeighbour struct {
@@ -116,7 +154,6 @@ func (n *RingNode) MarshalJSON() ([]byte, error) {
 	}
 
 	type PublicRingNode struct {
-		MaxNodes    uint64
 		Self        PublicFinger
 		Predecessor PublicFinger
 		FingerTable []PublicFinger
@@ -135,7 +172,6 @@ func (n *RingNode) MarshalJSON() ([]byte, error) {
 			IP:    n.predecessor.IP,
 			ID:    n.predecessor.ID,
 		},
-		MaxNodes:    n.maxNodes,
 		FingerTable: make([]PublicFinger, len(n.fingerTable)),
 		SuccList:    make([]PublicNeighbour, n.succListSize),
 		Keys:        make([]string, len(n.keys)),
@@ -164,6 +200,137 @@ func (n *RingNode) MarshalJSON() ([]byte, error) {
 	return json.Marshal(p)
 }
 
-func (n *RingNode) RingInfo() (string, uint64) {
-	return n.self.IP, n.maxNodes
+func (n *RingNode) RingInfo() string {
+	return n.self.IP
+}
+
+// ID returns the id of the node on the ring
+func (n *RingNode) ID() ID {
+	return n.self.ID
+}
+
+// Successors returns IPs of the known successors, the closest one goes first
+func (n *RingNode) Successors() []string {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.successors()
+}
+
+func (n *RingNode) successors() []string {
+
+	ips := make([]string, 0, n.succListSize+1)
+	seen := map[string]bool{n.self.IP: true}
+
+	// On small rings succ list wraps around, so skip repeated nodes
+	add := func(ip string) {
+		if !seen[ip] {
+			seen[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+
+	add(n.fingerTable[0].IP)
+	for el := n.succList.Front(); el != nil; el = el.Next() {
+		add(el.Value.(neighbour).node.IP)
+	}
+
+	return ips
+}
+
+// Neighbours returns IPs of every node we know about: predecessor, successors and fingers
+func (n *RingNode) Neighbours() []string {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	ips := make([]string, 0, len(n.fingerTable)+1)
+	seen := map[string]bool{n.self.IP: true}
+
+	if n.predecessor.IP != "" && !seen[n.predecessor.IP] {
+		seen[n.predecessor.IP] = true
+		ips = append(ips, n.predecessor.IP)
+	}
+
+	for _, ip := range n.successors() {
+		seen[ip] = true
+		ips = append(ips, ip)
+	}
+
+	for _, f := range n.fingerTable {
+		if f.IP != "" && !seen[f.IP] {
+			seen[f.IP] = true
+			ips = append(ips, f.IP)
+		}
+	}
+
+	return ips
+}
+
+// succSnapshot copies the succ list, so it can be walked while remote calls are made
+func (n *RingNode) succSnapshot() *list.List {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	succs := list.New()
+	for el := n.succList.Front(); el != nil; el = el.Next() {
+		succs.PushBack(el.Value)
+	}
+
+	return succs
+}
+
+// setNeighbourKeys replaces our copy of the keys of a node from the succ list
+func (n *RingNode) setNeighbourKeys(id ID, keys []string) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for el := n.succList.Front(); el != nil; el = el.Next() {
+		val := el.Value.(neighbour)
+		if val.node.ID == id {
+			val.keys = keys
+			el.Value = val
+		}
+	}
+}
+
+func (n *RingNode) successor() finger {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.fingerTable[0]
+}
+
+func (n *RingNode) pred() finger {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.predecessor
+}
+
+func (n *RingNode) succFront() *list.Element {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.succList.Front()
+}
+
+// Predecessor returns the IP of the node before us on the ring
+func (n *RingNode) Predecessor() string {
+	return n.pred().IP
+}
+
+// Version changes whenever keys, replicas or their digests do, so saved state can tell it's stale
+func (n *RingNode) Version() uint64 {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.version
 }
@@ -1,16 +1,39 @@
 package dht
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"net"
 	"testing"
 	"time"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	"math/rand"
+	"math/big"
+	"sort"
 	"strconv"
 )
 
 
+// Closing the listener stops the whole server, connections from the pool die with it like with a dead node
+type testListener struct {
+	net.Listener
+	srv *grpc.Server
+}
+
+func (l testListener) Close() error {
+	l.srv.Stop()
+	return nil
+}
+
 func startTestServ(node *RingNode) (chan error, net.Listener) {
 
 	lis, err := net.Listen("tcp", node.self.IP)
@@ -32,7 +55,7 @@ func startTestServ(node *RingNode) (chan error, net.Listener) {
 		close(errs)
 	}()
 
-	return errs, lis
+	return errs, testListener{Listener: lis, srv: grpcServer}
 }
 
 ////////
@@ -41,12 +64,11 @@ func startTestServ(node *RingNode) (chan error, net.Listener) {
 
 func _TestOneNode(t *testing.T) {
 
-	var maxNum uint64 = 1000
 
-	loner := NewRingNode("localhost:9000", maxNum, time.Second)
+	loner := NewRingNode("localhost:9000", time.Second)
 	loner.Join("")
 
-	contentID := Hash([]byte("This is a sample string"), maxNum)
+	contentID := Hash([]byte("This is a sample string"))
 
 	pred, err := loner.findPredecessor(contentID)
 	if err != nil {
@@ -66,10 +88,14 @@ func _TestOneNode(t *testing.T) {
 	loner.Stop()
 }
 
+// Small ids are easier to reason about
+func idOf(v uint64) ID {
+	return IDFromBytes(new(big.Int).SetUint64(v).Bytes())
+}
+
 func TestInInterval(t *testing.T) {
 
-	var maxNum uint64 = 1000
-	loner := NewRingNode("localhost:9000", maxNum, time.Second)
+	loner := NewRingNode("localhost:9000", time.Second)
 
 	var tests = []struct {
 		start, end, id uint64
@@ -87,7 +113,7 @@ func TestInInterval(t *testing.T) {
 	for _, tt := range tests {
 		testname := fmt.Sprintf("%d,%d,%d", tt.start, tt.end, tt.id)
 		t.Run(testname, func(t *testing.T) {
-			ans := loner.inInterval(tt.start, tt.end, tt.id, tt.inc_start, tt.inc_end)
+			ans := loner.inInterval(idOf(tt.start), idOf(tt.end), idOf(tt.id), tt.inc_start, tt.inc_end)
 			if ans != tt.want {
 				t.Errorf("got %t, want %t", ans, tt.want)
 			}
@@ -97,18 +123,25 @@ func TestInInterval(t *testing.T) {
 
 func TestFingerIndex(t *testing.T) {
 
-	var maxNum uint64 = 1000
-	loner := NewRingNode("localhost:4000", maxNum, time.Second) // ID: 415
+	loner := NewRingNodeWithID("localhost:4000", idOf(415), time.Second)
+
+	// Just below zero of the ring
+	wrapped := idOf(0)
+	for i := range wrapped {
+		wrapped[i] = 0xff
+	}
+	wrapped[len(wrapped)-2], wrapped[len(wrapped)-1] = 0xfd, 0x9f
 
 	var tests = []struct {
 		i         int64
 		clockWise bool
-		want      uint64
+		want      ID
 	}{
-		{0, true, 416},
-		{10, true, 439},
-		{0, false, 414},
-		{10, false, 391},
+		{0, true, idOf(416)},
+		{10, true, idOf(1439)},
+		{0, false, idOf(414)},
+		{8, false, idOf(159)},
+		{10, false, wrapped},
 	}
 
 	for _, tt := range tests {
@@ -116,13 +149,13 @@ func TestFingerIndex(t *testing.T) {
 		t.Run(testname, func(t *testing.T) {
 			ans := loner.fingerIndex(tt.i, tt.clockWise)
 			if ans != tt.want {
-				t.Errorf("got %d, want %d", ans, tt.want)
+				t.Errorf("got %s, want %s", ans, tt.want)
 			}
 		})
 	}
 }
 
-func findFingerSuccessor(nodes []*RingNode, id uint64) uint64 {
+func findFingerSuccessor(nodes []*RingNode, id ID) ID {
 
 	succ := nodes[0].self.ID
 
@@ -138,7 +171,7 @@ func findFingerSuccessor(nodes []*RingNode, id uint64) uint64 {
 	return succ
 }
 
-func findNext(nodes []*RingNode, id uint64) uint64 {
+func findNext(nodes []*RingNode, id ID) ID {
 	succ := nodes[0].self.ID
 
 	for i := 1; i < len(nodes); i++ {
@@ -150,7 +183,7 @@ func findNext(nodes []*RingNode, id uint64) uint64 {
 	return succ
 }
 
-func findPrev(nodes []*RingNode, id uint64) uint64 {
+func findPrev(nodes []*RingNode, id ID) ID {
 	pred := nodes[0].self.ID
 
 	for i := 1; i < len(nodes); i++ {
@@ -177,7 +210,7 @@ func printNodes(nodes []*RingNode) {
 	}
 }
 
-func generateRing(num uint64, maxNum uint64, deltaT time.Duration, random bool) []*RingNode{
+func generateRing(num uint64, deltaT time.Duration, random bool) []*RingNode{
 
 	var nodes = make([]*RingNode, num)
 	var begin int
@@ -190,7 +223,7 @@ func generateRing(num uint64, maxNum uint64, deltaT time.Duration, random bool)
 
 	for i, _ := range nodes{
 
-		nodes[i] = NewRingNode(fmt.Sprintf("localhost:%s", strconv.Itoa(begin+i)), maxNum, deltaT)
+		nodes[i] = NewRingNode(fmt.Sprintf("localhost:%s", strconv.Itoa(begin+i)), deltaT)
 	}
 
 	return nodes
@@ -211,7 +244,7 @@ func validateFingTable(nodes []*RingNode, t *testing.T) bool {
 					printNodes(nodes)
 					firstTime = false
 				}
-				t.Errorf("On node %s, finger %d: got suc %d must be %d", node.self.IP, fingIdx, fing.ID, findFingerSuccessor(nodes, fing.start))
+				t.Errorf("On node %s, finger %d: got suc %s must be %s", node.self.IP, fingIdx, fing.ID, findFingerSuccessor(nodes, fing.start))
 			}
 		}
 	}
@@ -229,7 +262,7 @@ func validateMainInfo(nodes []*RingNode, t *testing.T) {
 		succ := n.fingerTable[0].ID
 
 		if findNext(nodes, n.self.ID) != succ {
-			t.Errorf("Node %d has succ %d but actual is %d", n.self.ID, succ, findNext(nodes, n.self.ID))
+			t.Errorf("Node %s has succ %s but actual is %s", n.self.ID, succ, findNext(nodes, n.self.ID))
 			if firstTime {
 				printNodes(nodes)
 				firstTime = false
@@ -240,7 +273,7 @@ func validateMainInfo(nodes []*RingNode, t *testing.T) {
 		pred := n.predecessor.ID
 
 		if findPrev(nodes, n.self.ID) != pred {
-			t.Errorf("Node %d has pred %d but actual is %d", n.self.ID, pred, findPrev(nodes, n.self.ID))
+			t.Errorf("Node %s has pred %s but actual is %s", n.self.ID, pred, findPrev(nodes, n.self.ID))
 			if firstTime {
 				printNodes(nodes)
 				firstTime = false
@@ -261,7 +294,7 @@ func validateMainInfo(nodes []*RingNode, t *testing.T) {
 			}
 
 			if findNext(nodes, succ) != inlist {
-				t.Errorf("Node %d has %d in succ list but actual is %d", n.self.ID, inlist, findNext(nodes, n.self.ID))
+				t.Errorf("Node %s has %s in succ list but actual is %s", n.self.ID, inlist, findNext(nodes, n.self.ID))
 				if firstTime {
 					printNodes(nodes)
 					firstTime = false
@@ -274,7 +307,6 @@ func validateMainInfo(nodes []*RingNode, t *testing.T) {
 
 func _TestJoin(t *testing.T) {
 
-	var maxNum uint64 = 123456
 	var start uint64 = 10
 	var maxRingSize uint64 = 11
 	var step uint64 = 10
@@ -286,7 +318,7 @@ func _TestJoin(t *testing.T) {
 
 		fmt.Println("Ring size: ", i)
 
-		nodes := generateRing(i, maxNum, deltaT, false)
+		nodes := generateRing(i, deltaT, false)
 		a := make([](chan error), len(nodes))
 		b := make([](net.Listener), len(nodes))
 
@@ -321,10 +353,10 @@ func killNode(nodes []*RingNode, listeners []net.Listener, i int) {
 
 }
 
-func prepareRing(numNodes uint64, maxNum uint64, deltaT time.Duration, t *testing.T) (nodes []*RingNode, a [](chan error), b [](net.Listener)) {
+func prepareRing(numNodes uint64, deltaT time.Duration, t *testing.T) (nodes []*RingNode, a [](chan error), b [](net.Listener)) {
 
 	// Start everything
-	nodes = generateRing(numNodes, maxNum, deltaT, false)
+	nodes = generateRing(numNodes, deltaT, false)
 	a = make([](chan error), len(nodes))
 	b = make([](net.Listener), len(nodes))
 
@@ -348,7 +380,6 @@ func prepareRing(numNodes uint64, maxNum uint64, deltaT time.Duration, t *testin
 
 func _TestFailures(t *testing.T) {
 
-	var maxNum uint64 = 123456
 	var deltaT time.Duration = time.Second
 
 	var tests = []struct {
@@ -366,7 +397,7 @@ func _TestFailures(t *testing.T) {
 		testname := fmt.Sprintf("%d", i)
 		t.Run(testname, func(t *testing.T) {
 
-			nodes, _, b := prepareRing(tt.numNodes, maxNum, deltaT, t)
+			nodes, _, b := prepareRing(tt.numNodes, deltaT, t)
 
 			// Test
 
@@ -389,7 +420,7 @@ func _TestFailures(t *testing.T) {
 // Test file lists
 ///////
 
-func findNodeIdx(nodes []*RingNode, nodeId uint64) (int){
+func findNodeIdx(nodes []*RingNode, nodeId ID) (int){
 	for i, node := range nodes {
 		if node.self.ID == nodeId {
 			return i
@@ -398,12 +429,12 @@ func findNodeIdx(nodes []*RingNode, nodeId uint64) (int){
 	panic("Haven't found node for some reason.")
 }
 
-func findSuccNode(nodes []*RingNode, id uint64) (int) {
+func findSuccNode(nodes []*RingNode, id ID) (int) {
 	succID := findNext(nodes, id)
 	return findNodeIdx(nodes, succID)
 }
 
-func findPredNode(nodes []*RingNode, id uint64) (int) {
+func findPredNode(nodes []*RingNode, id ID) (int) {
 	predID := findPrev(nodes, id)
 	return findNodeIdx(nodes, predID)
 }
@@ -423,11 +454,11 @@ func checkKeys(keys []string, nodes []*RingNode, t *testing.T) {
 	show := false
 
 	for _, key := range keys {
-		succIdx := findSuccNode(nodes, Hash([]byte(key), nodes[0].maxNodes))
+		succIdx := findSuccNode(nodes, Hash([]byte(key)))
 
 		// Test personal key list
 		if !inSlice(nodes[succIdx].keys, key) {
-			t.Errorf("Node %d doesn't have it's key: %s with id %d", nodes[succIdx].self.ID, key, Hash([]byte(key),nodes[0].maxNodes))
+			t.Errorf("Node %s doesn't have it's key: %s with id %s", nodes[succIdx].self.ID, key, Hash([]byte(key)))
 			show = true
 		}
 
@@ -435,7 +466,7 @@ func checkKeys(keys []string, nodes []*RingNode, t *testing.T) {
 		predIdx := findPredNode(nodes, nodes[succIdx].self.ID)
 
 		if !inSlice(nodes[predIdx].succKeys, key) {
-			t.Errorf("Node %d doesn't have it's succesor key: %s", nodes[predIdx].self.ID, key)
+			t.Errorf("Node %s doesn't have it's succesor key: %s", nodes[predIdx].self.ID, key)
 			show = true
 		}
 
@@ -450,7 +481,7 @@ func checkKeys(keys []string, nodes []*RingNode, t *testing.T) {
 				if j == i {
 					neighb := el.Value.(neighbour)
 					if !inSlice(neighb.keys, key) {
-						t.Errorf("Node %d doesn't have %d key: %s", nodes[predIdx].self.ID, nodes[succIdx].self.ID, key)
+						t.Errorf("Node %s doesn't have %s key: %s", nodes[predIdx].self.ID, nodes[succIdx].self.ID, key)
 						show = true
 					}
 					break
@@ -475,7 +506,7 @@ func insertKeys(nodes []*RingNode, numKeys int) []string{
 
 	//Insert
 	for _, key := range keys {
-		keyHash := Hash([]byte(key), nodes[0].maxNodes)
+		keyHash := Hash([]byte(key))
 
 		placeIP, err := nodes[0].FindSuccessor(keyHash)
 		if err != nil {
@@ -483,8 +514,8 @@ func insertKeys(nodes []*RingNode, numKeys int) []string{
 			panic(err)
 		}
 
-		//fmt.Printf("For key %s %d got succ %d\n", key, keyHash, Hash([]byte(placeIP), nodes[0].maxNodes))
-		nodeIdx := findNodeIdx(nodes, Hash([]byte(placeIP), nodes[0].maxNodes))
+		//fmt.Printf("For key %s %d got succ %d\n", key, keyHash, Hash([]byte(placeIP)))
+		nodeIdx := findNodeIdx(nodes, Hash([]byte(placeIP)))
 		nodes[nodeIdx].SaveKey(key)
 
 		time.Sleep(time.Millisecond * 1)
@@ -499,11 +530,10 @@ func _TestKeyInsert(t *testing.T) {
 
 	// Construct a ring
 
-	var maxNum uint64 = 123456
 	var deltaT time.Duration = time.Second * 10
 	var numNodes uint64 = 15
 
-	nodes, _, b := prepareRing(numNodes, maxNum, deltaT, t)
+	nodes, _, b := prepareRing(numNodes, deltaT, t)
 
 	// Insert some keys
 	keys := insertKeys(nodes, 50)
@@ -520,16 +550,15 @@ func _TestKeyNewNode(t *testing.T) {
 	fmt.Println("Check that keys get split with new node...")
 
 	// Construct a ring
-	var maxNum uint64 = 123456
 	var deltaT time.Duration = time.Second * 10
 	var numNodes uint64 = 15
 
-	nodes, _, b := prepareRing(numNodes, maxNum, deltaT, t)
+	nodes, _, b := prepareRing(numNodes, deltaT, t)
 	keys := insertKeys(nodes, 100)
 	checkKeys(keys, nodes, t)
 
 	// Insert new one
-	newNode := NewRingNode("localhost:9000", maxNum, deltaT)
+	newNode := NewRingNode("localhost:9000", deltaT)
 	_, newB := startTestServ(newNode)
 	newNode.Join(nodes[0].self.IP)
 
@@ -554,13 +583,12 @@ func _TestNodeDeath(t *testing.T) {
 	fmt.Println("Test that dead nodes' keys get distributed...")
 
 	// Construct a ring
-	var maxNum uint64 = 123456
 	var deltaT time.Duration = time.Second*2
 	var numNodes uint64 = 20
 	var deleteNum int = 3
 	var waitTime time.Duration = time.Second*6
 
-	nodes, _, b := prepareRing(numNodes, maxNum, deltaT, t)
+	nodes, _, b := prepareRing(numNodes, deltaT, t)
 	keys := insertKeys(nodes, 100)
 	checkKeys(keys, nodes, t)
 
@@ -579,3 +607,259 @@ func _TestNodeDeath(t *testing.T) {
 		killNode(nodes[:len(nodes)-deleteNum], b, i)
 	}
 }
+
+////////
+// Test Merkle trees
+///////
+
+func TestCompareKeys(t *testing.T) {
+
+
+	remote := NewRingNode("localhost:9100", time.Second)
+	local := NewRingNode("localhost:9101", time.Second)
+	_, lis := startTestServ(remote)
+	defer lis.Close()
+
+	known := make(map[string][]byte)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		remote.keys = append(remote.keys, key)
+		remote.digests[key] = []byte(key)
+		known[key] = []byte(key)
+	}
+
+	// Same sets don't differ
+	missing, extra, err := local.CompareKeys(remote.self.IP, false, ID{}, ID{}, known, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 || len(extra) != 0 {
+		t.Errorf("Equal sets differ: missing %v, extra %v", missing, extra)
+	}
+
+	// Change one of each kind
+	delete(known, "key10")
+	known["key200"] = []byte("key200")
+	known["key20"] = []byte("changed")
+
+	missing, extra, err = local.CompareKeys(remote.self.IP, false, ID{}, ID{}, known, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(missing)
+	if len(missing) != 2 || missing[0] != "key20" || missing[1] != "key200" {
+		t.Errorf("Got missing %v, want [key20 key200]", missing)
+	}
+	if len(extra) != 1 || extra[0] != "key10" {
+		t.Errorf("Got extra %v, want [key10]", extra)
+	}
+
+	// Names only
+	synced, err := local.syncKeys(remote.self.IP, []string{"key1", "key300"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != len(remote.keys) {
+		t.Errorf("Synced %d keys, want %d", len(synced), len(remote.keys))
+	}
+
+	// Only keys inside the range are compared
+	start := Hash([]byte("key5"))
+	end := Hash([]byte("key7"))
+	missing, extra, err = local.CompareKeys(remote.self.IP, false, start, end, map[string][]byte{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range extra {
+		if !local.inInterval(start, end, Hash([]byte(k)), false, true) {
+			t.Errorf("Key %s is outside of the range", k)
+		}
+	}
+}
+
+func TestTreeUpdates(t *testing.T) {
+
+	n := NewRingNode("localhost:9102", time.Second)
+	for i := 0; i < 100; i++ {
+		n.RestoreKeys([]string{fmt.Sprintf("key%d", i)}, nil)
+	}
+
+	start, end := Hash([]byte("key3")), Hash([]byte("key60"))
+	specs := []treeSpec{{digests: true}, {start: start, end: end, digests: true}, {start: start, end: end}}
+	for _, spec := range specs {
+		n.tree(spec, false)
+	}
+
+	// Kept trees follow the keys
+	n.RemoveKey("key10")
+	n.SetKeyDigest("key20", []byte("digest"))
+	n.RestoreKeys([]string{"key100"}, nil)
+	n.SaveReplicaKey("key200")
+
+	for _, spec := range specs {
+		kept := n.tree(spec, false)
+		built := n.buildTree(spec.start, spec.end, n.entries(false), spec.digests)
+		if !bytes.Equal(kept.levels[0][0], built.levels[0][0]) {
+			t.Errorf("Kept tree over (%s, %s] differs from a new one", spec.start, spec.end)
+		}
+	}
+}
+
+// Predecessor that is down doesn't lose the key, it learns about it later
+func TestSaveKeyPredecessorDown(t *testing.T) {
+
+	n := NewRingNode("localhost:9104", time.Second)
+	n.predecessor = finger{IP: "localhost:9105", ID: Hash([]byte("localhost:9105"))}
+
+	if err := n.SaveKey("key"); err == nil {
+		t.Error("Saving a key with the predecessor down didn't fail")
+	}
+	if !n.HasKey("key") {
+		t.Error("Key was lost because the predecessor is down")
+	}
+}
+
+////////
+// Test identity of callers
+///////
+
+// Context of a call made over TLS with a certificate of the given key
+func tlsContext(key string, units ...string) context.Context {
+
+	cert := &x509.Certificate{
+		RawSubjectPublicKeyInfo: []byte(key),
+		Subject:                 pkix.Name{CommonName: key, OrganizationalUnit: units},
+	}
+	info := credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}
+
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+}
+
+func TestGivers(t *testing.T) {
+
+	n := NewRingNode("localhost:9103", time.Second)
+	giver := tlsContext("giver", NodeUnit)
+	other := tlsContext("other", NodeUnit)
+
+	n.RestoreKeys([]string{"key"}, nil)
+	n.recordGivers(giver, []string{"key"})
+
+	if err := n.VerifyGiver(giver, "key"); err != nil {
+		t.Errorf("Node that gave the key was refused: %v", err)
+	}
+	if err := n.VerifyGiver(other, "key"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Another node got %v, want PermissionDenied", err)
+	}
+	if err := n.VerifyGiver(giver, "unknown"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Key nobody gave got %v, want PermissionDenied", err)
+	}
+
+	// Clients aren't nodes
+	if err := VerifyNode(tlsContext("client")); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Client got %v, want PermissionDenied", err)
+	}
+}
+
+////////
+// Test persistent ids
+///////
+
+func TestNodeIdentity(t *testing.T) {
+
+
+	first := NewRingNodeWithID("localhost:9110", idOf(100), time.Minute)
+	second := NewRingNodeWithID("localhost:9111", idOf(600), time.Minute)
+	_, lis1 := startTestServ(first)
+	defer lis1.Close()
+	_, lis2 := startTestServ(second)
+	defer lis2.Close()
+
+	first.Join("")
+	second.Join(first.self.IP)
+
+	// Ids are the ones we gave, not hashes of IPs
+	if first.fingerTable[0].ID != idOf(600) || first.predecessor.ID != idOf(600) {
+		t.Errorf("First node has succ %s and pred %s, want 600", first.fingerTable[0].ID, first.predecessor.ID)
+	}
+	if second.fingerTable[0].ID != idOf(100) || second.predecessor.ID != idOf(100) {
+		t.Errorf("Second node has succ %s and pred %s, want 100", second.fingerTable[0].ID, second.predecessor.ID)
+	}
+
+	// Same node on another address keeps its place
+	first.readdress(finger{ID: idOf(600), IP: "localhost:9112"})
+	if first.fingerTable[0].IP != "localhost:9112" || first.predecessor.IP != "localhost:9112" {
+		t.Errorf("Node wasn't readdressed: succ %s, pred %s", first.fingerTable[0].IP, first.predecessor.IP)
+	}
+	for _, ip := range first.Successors() {
+		if ip == second.self.IP {
+			t.Errorf("Old address %s is still in the succ list", ip)
+		}
+	}
+}
+
+func TestIDCollision(t *testing.T) {
+
+	first := NewRingNodeWithID("localhost:9120", idOf(100), time.Minute)
+	second := NewRingNodeWithID("localhost:9121", idOf(100), time.Minute)
+	_, lis1 := startTestServ(first)
+	defer lis1.Close()
+	_, lis2 := startTestServ(second)
+	defer lis2.Close()
+
+	first.Join("")
+
+	// Same id on another alive node is refused
+	if err := second.Join(first.self.IP); !errors.Is(err, ErrIDTaken) {
+		t.Fatalf("Join with a taken id returned %v, want ErrIDTaken", err)
+	}
+	if first.fingerTable[0].IP != first.self.IP || first.predecessor.IP != first.self.IP {
+		t.Errorf("Refused node got into the ring: succ %s, pred %s", first.fingerTable[0].IP, first.predecessor.IP)
+	}
+
+	// Salted id is fine
+	if err := second.JoinWithSalt(first.self.IP, 3); err != nil {
+		t.Fatal(err)
+	}
+	if second.self.ID == idOf(100) {
+		t.Error("Id wasn't changed")
+	}
+	if first.fingerTable[0].IP != second.self.IP || first.predecessor.IP != second.self.IP {
+		t.Errorf("Salted node isn't in the ring: succ %s, pred %s", first.fingerTable[0].IP, first.predecessor.IP)
+	}
+}
+
+func TestLookupDeadFinger(t *testing.T) {
+
+	nodes := []*RingNode{
+		NewRingNodeWithID("localhost:9130", idOf(100), time.Minute),
+		NewRingNodeWithID("localhost:9131", idOf(600), time.Minute),
+		NewRingNodeWithID("localhost:9132", idOf(1000), time.Minute),
+	}
+	for i, node := range nodes {
+		_, lis := startTestServ(node)
+		defer lis.Close()
+
+		existingIP := ""
+		if i > 0 {
+			existingIP = nodes[0].self.IP
+		}
+		if err := node.Join(existingIP); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nobody listens there, but it looks like the best hop towards 650
+	nodes[0].fingerTable[5] = finger{IP: "localhost:9139", ID: idOf(620)}
+
+	route, err := nodes[0].Lookup(idOf(650))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.IP != nodes[2].self.IP || route.Start != idOf(600) || route.End != idOf(1000) {
+		t.Errorf("Lookup found %s owning (%s, %s]", route.IP, route.Start, route.End)
+	}
+	path := route.Path
+	if len(path) != 2 || path[0] != nodes[0].self.IP || path[1] != nodes[1].self.IP {
+		t.Errorf("Lookup went through %v", path)
+	}
+}
@@ -2,7 +2,6 @@ package dht
 
 import (
 	"golang.org/x/net/context"
-	"google.golang.org/grpc"
 	"fmt"
 )
 
@@ -11,6 +10,38 @@ import (
 ////////
 
 
+/////////////////// Addresses
+
+// readdress updates the IP of every node we know with the same id. Ids are persistent, IPs might change.
+func (n *RingNode) readdress(node finger) {
+
+	if node.ID == n.self.ID {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.predecessor.ID == node.ID && n.predecessor.IP != "" {
+		n.predecessor.IP = node.IP
+	}
+
+	for i := range n.fingerTable {
+		if n.fingerTable[i].ID == node.ID && n.fingerTable[i].IP != "" {
+			n.fingerTable[i].IP = node.IP
+		}
+	}
+
+	for el := n.succList.Front(); el != nil; el = el.Next() {
+		val := el.Value.(neighbour)
+		if val.node.ID == node.ID {
+			val.node.IP = node.IP
+			el.Value = val
+		}
+	}
+}
+
+
 /////////////////// Predecessor
 
 
@@ -18,49 +49,68 @@ import (
 func (n *RingNode) UpdatePredecessor(ctx context.Context, in *UpdatePredRequest) (*UpdateReply, error) {
 
 	ip := in.IP
-	id := Hash([]byte(ip), n.maxNodes)
+	id := IDFromBytes(in.ID)
+
+	// Node says it's at ip, its certificate has to agree
+	if err := n.verifyCaller(ctx, finger{ID: id, IP: ip}); err != nil {
+		return &UpdateReply{OK: false}, err
+	}
+	n.readdress(finger{ID: id, IP: ip})
 
 	// Check if you actually need to insert him.
 	//fmt.Printf("Curr pred: %d, self: %d, id: %d, IP: %s", n.predecessor.ID, n.self.ID, id, ip)
-	isBetween := n.inInterval(n.predecessor.ID, n.self.ID, id, true, false)
+	oldPred := n.pred()
+	isBetween := n.inInterval(oldPred.ID, n.self.ID, id, true, false)
 	var isNotOkay bool = false
 
-	if isBetween {
-		n.predecessor = finger{ID: id, IP: ip}
-	} else {
+	if !isBetween {
 		// This request might be made because our good friend passed away
-		_, err := n.invokeGetSucc(n.predecessor.IP)
+		_, err := n.invokeGetSucc(oldPred.IP)
 		isNotOkay = err != nil
-		if isNotOkay {
-			n.predecessor = finger{ID: id, IP: ip}
-		}
+	}
+
+	n.mu.Lock()
+	if isBetween || isNotOkay {
+		n.predecessor = finger{ID: id, IP: ip}
 	}
 
 	fmt.Printf("%s has a hew predecessor %s\n", n.self.IP, in.GetIP())
 
 	// Send your new predecessor new keys that he is responsible for
 
+	// Separate keys
+	sendKeys := make([]string, 0)
 	if isBetween {
 
-		// Separate keys
-		sendKeys := make([]string, 0)
 		leftKeys := make([]string, 0)
 
 		for _, key := range n.keys {
-			if n.inInterval(n.predecessor.ID, n.self.ID, Hash([]byte(key), n.maxNodes), false, true) {
+			if n.inInterval(n.predecessor.ID, n.self.ID, Hash([]byte(key)), false, true) {
 				// This key is to be left here
 				leftKeys = append(leftKeys, key)
 			} else {
 				sendKeys = append(sendKeys, key)
+				n.updateTrees(key, false, false)
+				n.version++
 			}
 		}
 
-		// Do what you need to
 		n.keys = leftKeys
-		ok, err := n.invokeUpdateKeys(n.predecessor.IP, sendKeys)
+	}
+	n.mu.Unlock()
+
+	if isBetween {
+
+		// Do what you need to
+		ok, err := n.invokeUpdateKeys(ip, sendKeys, false)
 		if !ok || err != nil {
 			panic(err)
 		}
+
+		// Data behind the keys is still here, let higher level software move it
+		if len(sendKeys) > 0 {
+			n.TransferChannel <- KeyTransfer{IP: ip, Keys: sendKeys}
+		}
 	}
 
 	return &UpdateReply{OK: (isNotOkay || isBetween)}, nil
@@ -68,20 +118,19 @@ func (n *RingNode) UpdatePredecessor(ctx context.Context, in *UpdatePredRequest)
 
 func (n *RingNode) invokeUpdatePredecessor(invokeIP string) (bool, error) {
 
-	conn, err := grpc.Dial(invokeIP, grpc.WithInsecure())
+	cl, release, err := getConn(invokeIP)
 	if err != nil {
 		return false, err
 	}
-	cl := NewRingServiceClient(conn)
+	defer release()
 
 	mes, err := cl.UpdatePredecessor(
 		context.Background(),
-		&UpdatePredRequest{IP: n.self.IP},
+		&UpdatePredRequest{IP: n.self.IP, ID: n.self.ID.Bytes()},
 	)
 	if err != nil {
 		return false, err
 	}
-	conn.Close()
 
 	return mes.GetOK(), nil
 }
@@ -93,26 +142,38 @@ func (n *RingNode) invokeUpdatePredecessor(invokeIP string) (bool, error) {
 // UpdateSpecificFinger updates i'th finger of a node
 func (n *RingNode) UpdateSpecificFinger(ctx context.Context, in *UpdateSpecificFingerRequest) (*UpdateReply, error) {
 
-	s := finger{ID: in.GetID(), IP: in.GetIP()}
+	s := finger{ID: IDFromBytes(in.GetID()), IP: in.GetIP()}
 	i := in.GetFingID()
 
+	// Changes are passed on by predecessors, only the node itself can tell its address
+	self, err := n.verifyRelay(ctx, s)
+	if err != nil {
+		return &UpdateReply{OK: false}, err
+	}
+	if self {
+		n.readdress(s)
+	}
+
 	if i == 0 {
 		// Use update succ for this
 		return &UpdateReply{OK: false}, nil
 	}
 
 	//fmt.Printf("Asking %d to change %dth finger from %d to %d\n", n.self.ID, i, n.fingerTable[i].ID, s.ID)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	if n.inInterval(n.self.ID, n.fingerTable[i].ID, s.ID, true, false) {
 
 		n.fingerTable[i].ID = s.ID
 		n.fingerTable[i].IP = s.IP
 
 		// n.predecessor has already included itself in fingertable buring construction (if necessary)
-		if n.predecessor.IP != s.IP {
+		if predIP := n.predecessor.IP; predIP != s.IP {
 			// Propogate change
 			// TODO: check results and don't just forget about this func
 			go func() {
-				_, err := n.invokeUpdateSpecificFinger(n.predecessor.IP, i, s)
+				_, err := n.invokeUpdateSpecificFinger(predIP, i, s)
 				if err != nil {
 					panic(err)
 				}
@@ -125,20 +186,19 @@ func (n *RingNode) UpdateSpecificFinger(ctx context.Context, in *UpdateSpecificF
 
 func (n *RingNode) invokeUpdateSpecificFinger(invokeIP string, fingIndex int64, node finger) (bool, error) {
 
-	conn, err := grpc.Dial(invokeIP, grpc.WithInsecure())
+	cl, release, err := getConn(invokeIP)
 	if err != nil {
 		return false, err
 	}
-	cl := NewRingServiceClient(conn)
+	defer release()
 
 	mes, err := cl.UpdateSpecificFinger(
 		context.Background(),
-		&UpdateSpecificFingerRequest{FingID: fingIndex, ID: node.ID, IP: node.IP},
+		&UpdateSpecificFingerRequest{FingID: fingIndex, ID: node.ID.Bytes(), IP: node.IP},
 	)
 	if err != nil {
 		return false, err
 	}
-	conn.Close()
 
 	return mes.GetOK(), nil
 }
@@ -146,7 +206,7 @@ func (n *RingNode) invokeUpdateSpecificFinger(invokeIP string, fingIndex int64,
 /////////////////// Successor
 
 // Insert node into succlist and make sure that it's <= succListSize
-// Returns true if element was inserted
+// Returns true if element was inserted. Callers hold n.mu.
 func (n *RingNode) insertToSuccList(newEl neighbour) bool {
 
 	// Finding our place
@@ -179,31 +239,42 @@ func (n *RingNode) insertToSuccList(newEl neighbour) bool {
 func (n *RingNode) UpdateSucc(ctx context.Context, in *UpdateSuccRequest) (*UpdateReply, error) {
 
 	ip := in.IP
-	id := Hash([]byte(ip), n.maxNodes)
+	id := IDFromBytes(in.ID)
 
-	//fmt.Printf("update succ: %d is updated with %d\n", n.self.ID, id)
+	if err := n.verifyCaller(ctx, finger{ID: id, IP: ip}); err != nil {
+		return &UpdateReply{OK: false}, err
+	}
 
-	oldSuc := n.fingerTable[0]
-	oldSucKeys := n.succKeys
+	//fmt.Printf("update succ: %d is updated with %d\n", n.self.ID, id)
 
-	// Set him and download his files
-	n.fingerTable[0].ID = id; n.fingerTable[0].IP = ip
+	// Download his files first, nothing is changed while we wait
+	n.readdress(finger{ID: id, IP: ip})
 	succKeys, err := n.invokeGetKeys(ip)
 	if err != nil {
 		panic(err)
 	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	oldSuc := n.fingerTable[0]
+	oldSucKeys := n.succKeys
+
+	// Set him
+	n.fingerTable[0].ID = id; n.fingerTable[0].IP = ip
 	n.succKeys = succKeys
 
-	// Check if it's second node joining
-	if oldSuc.ID != n.self.ID {
+	// Check if it's second node joining. Same id means that our successor just moved to another IP.
+	if oldSuc.ID != n.self.ID && oldSuc.ID != id {
 
 		if !n.insertToSuccList(neighbour{node: oldSuc, keys: oldSucKeys}) {
 			panic("Couldn't insert old suc")
 		}
 
 		// Propogate change
+		predIP := n.predecessor.IP
 		go func() {
-			_, err := n.invokeUpdateSuccList(n.predecessor.IP, finger{IP: ip, ID: id})
+			_, err := n.invokeUpdateSuccList(predIP, finger{IP: ip, ID: id})
 			if err != nil {
 				panic(err)
 			}
@@ -215,20 +286,19 @@ func (n *RingNode) UpdateSucc(ctx context.Context, in *UpdateSuccRequest) (*Upda
 
 func (n* RingNode) invokeUpdateSucc(invokeIP string, node finger) (bool, error) {
 
-	conn, err := grpc.Dial(invokeIP, grpc.WithInsecure())
+	cl, release, err := getConn(invokeIP)
 	if err != nil {
 		return false, err
 	}
-	cl := NewRingServiceClient(conn)
+	defer release()
 
 	mes, err := cl.UpdateSucc(
 		context.Background(),
-		&UpdateSuccRequest{IP: node.IP},
+		&UpdateSuccRequest{IP: node.IP, ID: node.ID.Bytes()},
 	)
 	if err != nil {
 		return false, err
 	}
-	conn.Close()
 
 	return mes.GetOK(), nil
 }
@@ -238,22 +308,34 @@ func (n* RingNode) invokeUpdateSucc(invokeIP string, node finger) (bool, error)
 func (n *RingNode) UpdateSuccList(ctx context.Context, in *UpdateSuccListRequest) (*UpdateReply, error) {
 
 	ip := in.IP
-	id := Hash([]byte(ip), n.maxNodes)
+	id := IDFromBytes(in.ID)
+
+	self, err := n.verifyRelay(ctx, finger{ID: id, IP: ip})
+	if err != nil {
+		return &UpdateReply{OK: false}, err
+	}
+	if self {
+		n.readdress(finger{ID: id, IP: ip})
+	}
 
 	//fmt.Printf("update succ list: %d is updated with %d, size %d\n", n.self.ID, id, n.succList.Len())
 
 	// Don't add yourself to a succ list!
 	if id != n.self.ID {
 
-		keys, err := n.invokeGetKeys(ip)
+		keys, err := n.fetchKeys(ip, n.succSnapshot())
 		if err != nil {
 			panic(err)
 		}
 
+		n.mu.Lock()
+		defer n.mu.Unlock()
+
 		if n.insertToSuccList(neighbour{node: finger{IP: ip, ID: id}, keys: keys}) {
 			// Propogate only changes you made yourself
+			predIP := n.predecessor.IP
 			go func() {
-				_, err := n.invokeUpdateSuccList(n.predecessor.IP, finger{IP: ip, ID: id})
+				_, err := n.invokeUpdateSuccList(predIP, finger{IP: ip, ID: id})
 				if err != nil {
 					panic(err)
 				}
@@ -266,20 +348,19 @@ func (n *RingNode) UpdateSuccList(ctx context.Context, in *UpdateSuccListRequest
 
 func (n *RingNode) invokeUpdateSuccList(invokeIP string, node finger) (bool, error) {
 
-	conn, err := grpc.Dial(invokeIP, grpc.WithInsecure())
+	cl, release, err := getConn(invokeIP)
 	if err != nil {
 		return false, err
 	}
-	cl := NewRingServiceClient(conn)
+	defer release()
 
 	mes, err := cl.UpdateSuccList(
 		context.Background(),
-		&UpdateSuccListRequest{IP: node.IP},
+		&UpdateSuccListRequest{IP: node.IP, ID: node.ID.Bytes()},
 	)
 	if err != nil {
 		return false, err
 	}
-	conn.Close()
 
 	return mes.GetOK(), nil
 }
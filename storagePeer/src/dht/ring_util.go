@@ -1,89 +1,142 @@
 package dht
 
 import (
+  "bytes"
+  "crypto/rand"
   "crypto/sha256"
 	"encoding/hex"
+  "fmt"
   "math/big"
-  "math"
-  "google.golang.org/grpc"
-  //"fmt"
+  "storagePeer/src/pool"
 )
 
 ////////
-// Utility functions for all parts of the module
+// Identifiers
 ////////
 
-// Hash is a hash function used for node and file ids.
-func Hash(data []byte, maxNum uint64) uint64 {
+// IDBits is the size of the identifier space. Ids are SHA-256 hashes, so nobody has to agree on the ring size.
+const IDBits = 256
 
-	hash := sha256.Sum256(data)
-  //fmt.Println("Hashing: ", string(data))
+// ID is a position on the ring
+type ID [IDBits / 8]byte
 
-	gen := new(big.Int)
-	gen.SetString(hex.EncodeToString(hash[:]), 16)
+// Size of the identifier space
+var idSpace = new(big.Int).Lsh(big.NewInt(1), IDBits)
 
-  //fmt.Println("Big: ", gen)
+func (id ID) String() string {
+	return hex.EncodeToString(id[:])
+}
 
-	base := new(big.Int)
-	base.SetUint64(maxNum)
+// Bytes returns the id for protobuf messages
+func (id ID) Bytes() []byte {
+	return id[:]
+}
 
-	base.Mod(gen, base)
+// MarshalText keeps ids readable in JSON
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *ID) UnmarshalText(text []byte) error {
+
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	if len(b) != len(id) {
+		return fmt.Errorf("id has %d bytes, want %d", len(b), len(id))
+	}
 
-  //fmt.Println("Id: ", base.Uint64())
-	return base.Uint64()
+	copy(id[:], b)
+	return nil
 }
 
-// Calculate i'th finger index from the current node
-func (n *RingNode) fingerIndex(i int64, clockWise bool) uint64 {
+// IDFromBytes reads an id from protobuf messages. Shorter values are treated as big-endian numbers.
+func IDFromBytes(b []byte) ID {
 
-	var ans uint64
+	var id ID
+	if len(b) > len(id) {
+		b = b[len(b)-len(id):]
+	}
+	copy(id[len(id)-len(b):], b)
 
-	if clockWise {
+	return id
+}
+
+func (id ID) big() *big.Int {
+	return new(big.Int).SetBytes(id[:])
+}
+
+// Takes the number modulo size of the identifier space
+func idFromBig(v *big.Int) ID {
+	return IDFromBytes(new(big.Int).Mod(v, idSpace).Bytes())
+}
 
-		ans = (n.self.ID + uint64(math.Pow(2, float64(i)))) % n.maxNodes
-	} else {
+////////
+// Utility functions for all parts of the module
+////////
 
-		temp := (int64(n.self.ID) - int64(math.Pow(2, float64(i)))) % int64(n.maxNodes)
+// Hash is a hash function used for node and file ids.
+func Hash(data []byte) ID {
+	return sha256.Sum256(data)
+}
 
-		if temp < 0 {
-			temp += int64(n.maxNodes)
-		}
+// NewNodeID generates a random id for a node that is going to keep it across restarts
+func NewNodeID() ID {
 
-		ans = uint64(temp)
+	var id ID
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
 	}
 
-	return ans
+	return id
+}
+
+// Calculate i'th finger index from the current node
+func (n *RingNode) fingerIndex(i int64, clockWise bool) ID {
+
+	step := new(big.Int).Lsh(big.NewInt(1), uint(i))
+
+	if clockWise {
+		return idFromBig(step.Add(n.self.ID.big(), step))
+	}
+	return idFromBig(step.Sub(n.self.ID.big(), step))
 }
 
 // Check whether id is located inside (start, end) interval.
-func (n *RingNode) inInterval(start uint64, end uint64, id uint64, include_start bool, include_end bool) bool {
+func (n *RingNode) inInterval(start ID, end ID, id ID, include_start bool, include_end bool) bool {
+	return inInterval(start, end, id, include_start, include_end)
+}
 
-	start %= n.maxNodes
-	end %= n.maxNodes
-	id %= n.maxNodes
+func inInterval(start ID, end ID, id ID, include_start bool, include_end bool) bool {
 
+  afterStart := bytes.Compare(id[:], start[:])
+  beforeEnd := bytes.Compare(id[:], end[:])
 
-  first  := (include_start && id >= start) || (!include_start && id > start)
-  second := (include_end && id <= end) || (!include_end && id < end)
+  first  := afterStart > 0 || (include_start && afterStart == 0)
+  second := beforeEnd < 0 || (include_end && beforeEnd == 0)
 
 	if start == end {
 		return true
-	} else if start < end {
+	} else if bytes.Compare(start[:], end[:]) < 0 {
 		return first && second
 	}
   // This is a situation where zero of the ring is being crossed
-	return (first && id < n.maxNodes) || (second && id < end)
+	return first || second
 }
 
-// Make a connection with other node
-func getConn(ip string) (*grpc.ClientConn, RingServiceClient) {
+// InRange checks whether id belongs to the (start, end] range. Same start and end stand for the whole ring.
+func InRange(start ID, end ID, id ID) bool {
+	return inInterval(start, end, id, false, true)
+}
+
+// Get a connection with other node from the shared pool, release it when done
+func getConn(ip string) (RingServiceClient, func(), error) {
 
-	conn, err := grpc.Dial(ip, grpc.WithInsecure())
+	conn, release, err := pool.Get(ip)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
-	cl := NewRingServiceClient(conn)
-
-	return conn, cl
 
+	return NewRingServiceClient(conn), release, nil
 }
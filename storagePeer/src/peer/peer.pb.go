@@ -122,6 +122,8 @@ type WriteRequest struct {
 	Name        string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
 	Data        []byte `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
 	Certificate string `protobuf:"bytes,3,opt,name=Certificate,proto3" json:"Certificate,omitempty"`
+	Size        int64  `protobuf:"varint,4,opt,name=Size,proto3" json:"Size,omitempty"`
+	Overflow    bool   `protobuf:"varint,5,opt,name=Overflow,proto3" json:"Overflow,omitempty"` // Owner was full, the node keeps the shard for it
 }
 
 func (x *WriteRequest) Reset() {
@@ -177,6 +179,20 @@ func (x *WriteRequest) GetCertificate() string {
 	return ""
 }
 
+func (x *WriteRequest) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *WriteRequest) GetOverflow() bool {
+	if x != nil {
+		return x.Overflow
+	}
+	return false
+}
+
 type WriteReply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -232,6 +248,7 @@ type ReadRequest struct {
 	Name        string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
 	ChunkSize   int64  `protobuf:"varint,2,opt,name=ChunkSize,proto3" json:"ChunkSize,omitempty"`
 	Certificate string `protobuf:"bytes,3,opt,name=Certificate,proto3" json:"Certificate,omitempty"`
+	Overflow    bool   `protobuf:"varint,4,opt,name=Overflow,proto3" json:"Overflow,omitempty"` // Looking for a shard the owner passed on, don't redirect
 }
 
 func (x *ReadRequest) Reset() {
@@ -287,6 +304,13 @@ func (x *ReadRequest) GetCertificate() string {
 	return ""
 }
 
+func (x *ReadRequest) GetOverflow() bool {
+	if x != nil {
+		return x.Overflow
+	}
+	return false
+}
+
 type ReadReply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -357,6 +381,7 @@ type DeleteRequest struct {
 
 	Fname       string `protobuf:"bytes,1,opt,name=fname,proto3" json:"fname,omitempty"`
 	Certificate string `protobuf:"bytes,3,opt,name=Certificate,proto3" json:"Certificate,omitempty"`
+	Overflow    bool   `protobuf:"varint,4,opt,name=Overflow,proto3" json:"Overflow,omitempty"`
 }
 
 func (x *DeleteRequest) Reset() {
@@ -405,6 +430,13 @@ func (x *DeleteRequest) GetCertificate() string {
 	return ""
 }
 
+func (x *DeleteRequest) GetOverflow() bool {
+	if x != nil {
+		return x.Overflow
+	}
+	return false
+}
+
 type DeleteReply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -457,7 +489,8 @@ type FindSuccRequest struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Id uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Id    []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Fresh bool   `protobuf:"varint,2,opt,name=fresh,proto3" json:"fresh,omitempty"` // Don't answer from the cache
 }
 
 func (x *FindSuccRequest) Reset() {
@@ -492,11 +525,18 @@ func (*FindSuccRequest) Descriptor() ([]byte, []int) {
 	return file_peer_proto_rawDescGZIP(), []int{8}
 }
 
-func (x *FindSuccRequest) GetId() uint64 {
+func (x *FindSuccRequest) GetId() []byte {
 	if x != nil {
 		return x.Id
 	}
-	return 0
+	return nil
+}
+
+func (x *FindSuccRequest) GetFresh() bool {
+	if x != nil {
+		return x.Fresh
+	}
+	return false
 }
 
 type FindSuccReply struct {
@@ -504,7 +544,11 @@ type FindSuccReply struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Ip string `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Ip         string   `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Successors []string `protobuf:"bytes,2,rep,name=successors,proto3" json:"successors,omitempty"`
+	Path       []string `protobuf:"bytes,3,rep,name=path,proto3" json:"path,omitempty"`   // Nodes the lookup went through
+	Start      []byte   `protobuf:"bytes,4,opt,name=start,proto3" json:"start,omitempty"` // ip is responsible for (start, end]
+	End        []byte   `protobuf:"bytes,5,opt,name=end,proto3" json:"end,omitempty"`
 }
 
 func (x *FindSuccReply) Reset() {
@@ -516,34 +560,454 @@ func (x *FindSuccReply) Reset() {
 	}
 }
 
-func (x *FindSuccReply) String() string {
-	return protoimpl.X.MessageStringOf(x)
+func (x *FindSuccReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FindSuccReply) ProtoMessage() {}
+
+func (x *FindSuccReply) ProtoReflect() protoreflect.Message {
+	mi := &file_peer_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FindSuccReply.ProtoReflect.Descriptor instead.
+func (*FindSuccReply) Descriptor() ([]byte, []int) {
+	return file_peer_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *FindSuccReply) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *FindSuccReply) GetSuccessors() []string {
+	if x != nil {
+		return x.Successors
+	}
+	return nil
+}
+
+func (x *FindSuccReply) GetPath() []string {
+	if x != nil {
+		return x.Path
+	}
+	return nil
+}
+
+func (x *FindSuccReply) GetStart() []byte {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *FindSuccReply) GetEnd() []byte {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+type HandoffRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name   string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Data   []byte `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
+	Offset int64  `protobuf:"varint,3,opt,name=Offset,proto3" json:"Offset,omitempty"`
+	Size   int64  `protobuf:"varint,4,opt,name=Size,proto3" json:"Size,omitempty"`
+}
+
+func (x *HandoffRequest) Reset() {
+	*x = HandoffRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_peer_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HandoffRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandoffRequest) ProtoMessage() {}
+
+func (x *HandoffRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peer_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandoffRequest.ProtoReflect.Descriptor instead.
+func (*HandoffRequest) Descriptor() ([]byte, []int) {
+	return file_peer_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *HandoffRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *HandoffRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *HandoffRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *HandoffRequest) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type HandoffReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Received int64 `protobuf:"varint,1,opt,name=Received,proto3" json:"Received,omitempty"`
+	Complete bool  `protobuf:"varint,2,opt,name=Complete,proto3" json:"Complete,omitempty"`
+}
+
+func (x *HandoffReply) Reset() {
+	*x = HandoffReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_peer_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HandoffReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandoffReply) ProtoMessage() {}
+
+func (x *HandoffReply) ProtoReflect() protoreflect.Message {
+	mi := &file_peer_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandoffReply.ProtoReflect.Descriptor instead.
+func (*HandoffReply) Descriptor() ([]byte, []int) {
+	return file_peer_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *HandoffReply) GetReceived() int64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *HandoffReply) GetComplete() bool {
+	if x != nil {
+		return x.Complete
+	}
+	return false
+}
+
+type HandoffOffsetRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+}
+
+func (x *HandoffOffsetRequest) Reset() {
+	*x = HandoffOffsetRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_peer_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HandoffOffsetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandoffOffsetRequest) ProtoMessage() {}
+
+func (x *HandoffOffsetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peer_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandoffOffsetRequest.ProtoReflect.Descriptor instead.
+func (*HandoffOffsetRequest) Descriptor() ([]byte, []int) {
+	return file_peer_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *HandoffOffsetRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type HandoffOffsetReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Offset int64 `protobuf:"varint,1,opt,name=Offset,proto3" json:"Offset,omitempty"`
+}
+
+func (x *HandoffOffsetReply) Reset() {
+	*x = HandoffOffsetReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_peer_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HandoffOffsetReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandoffOffsetReply) ProtoMessage() {}
+
+func (x *HandoffOffsetReply) ProtoReflect() protoreflect.Message {
+	mi := &file_peer_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandoffOffsetReply.ProtoReflect.Descriptor instead.
+func (*HandoffOffsetReply) Descriptor() ([]byte, []int) {
+	return file_peer_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *HandoffOffsetReply) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type DropReplicaRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+}
+
+func (x *DropReplicaRequest) Reset() {
+	*x = DropReplicaRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_peer_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DropReplicaRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DropReplicaRequest) ProtoMessage() {}
+
+func (x *DropReplicaRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peer_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DropReplicaRequest.ProtoReflect.Descriptor instead.
+func (*DropReplicaRequest) Descriptor() ([]byte, []int) {
+	return file_peer_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *DropReplicaRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type StatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *StatsRequest) Reset() {
+	*x = StatsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_peer_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsRequest) ProtoMessage() {}
+
+func (x *StatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peer_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
+func (*StatsRequest) Descriptor() ([]byte, []int) {
+	return file_peer_proto_rawDescGZIP(), []int{15}
+}
+
+type StatsReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Keys            int64    `protobuf:"varint,1,opt,name=Keys,proto3" json:"Keys,omitempty"`
+	Replicas        int64    `protobuf:"varint,2,opt,name=Replicas,proto3" json:"Replicas,omitempty"`
+	UnderReplicated int64    `protobuf:"varint,3,opt,name=UnderReplicated,proto3" json:"UnderReplicated,omitempty"`
+	Capacity        int64    `protobuf:"varint,4,opt,name=Capacity,proto3" json:"Capacity,omitempty"`
+	Used            int64    `protobuf:"varint,5,opt,name=Used,proto3" json:"Used,omitempty"`
+	Successors      []string `protobuf:"bytes,6,rep,name=Successors,proto3" json:"Successors,omitempty"`
+}
+
+func (x *StatsReply) Reset() {
+	*x = StatsReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_peer_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatsReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsReply) ProtoMessage() {}
+
+func (x *StatsReply) ProtoReflect() protoreflect.Message {
+	mi := &file_peer_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsReply.ProtoReflect.Descriptor instead.
+func (*StatsReply) Descriptor() ([]byte, []int) {
+	return file_peer_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *StatsReply) GetKeys() int64 {
+	if x != nil {
+		return x.Keys
+	}
+	return 0
+}
+
+func (x *StatsReply) GetReplicas() int64 {
+	if x != nil {
+		return x.Replicas
+	}
+	return 0
+}
+
+func (x *StatsReply) GetUnderReplicated() int64 {
+	if x != nil {
+		return x.UnderReplicated
+	}
+	return 0
 }
 
-func (*FindSuccReply) ProtoMessage() {}
-
-func (x *FindSuccReply) ProtoReflect() protoreflect.Message {
-	mi := &file_peer_proto_msgTypes[9]
-	if protoimpl.UnsafeEnabled && x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+func (x *StatsReply) GetCapacity() int64 {
+	if x != nil {
+		return x.Capacity
 	}
-	return mi.MessageOf(x)
+	return 0
 }
 
-// Deprecated: Use FindSuccReply.ProtoReflect.Descriptor instead.
-func (*FindSuccReply) Descriptor() ([]byte, []int) {
-	return file_peer_proto_rawDescGZIP(), []int{9}
+func (x *StatsReply) GetUsed() int64 {
+	if x != nil {
+		return x.Used
+	}
+	return 0
 }
 
-func (x *FindSuccReply) GetIp() string {
+func (x *StatsReply) GetSuccessors() []string {
 	if x != nil {
-		return x.Ip
+		return x.Successors
 	}
-	return ""
+	return nil
 }
 
 var File_peer_proto protoreflect.FileDescriptor
@@ -552,56 +1016,120 @@ var file_peer_proto_rawDesc = []byte{
 	0x0a, 0x0a, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x04, 0x70, 0x65,
 	0x65, 0x72, 0x22, 0x1d, 0x0a, 0x0b, 0x50, 0x69, 0x6e, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
 	0x65, 0x12, 0x0e, 0x0a, 0x02, 0x4f, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x02, 0x4f,
-	0x6b, 0x22, 0x07, 0x0a, 0x05, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x58, 0x0a, 0x0c, 0x57, 0x72,
-	0x69, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61,
-	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x12,
-	0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44, 0x61,
-	0x74, 0x61, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74,
-	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69,
-	0x63, 0x61, 0x74, 0x65, 0x22, 0x26, 0x0a, 0x0a, 0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x65, 0x70,
-	0x6c, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x57, 0x72, 0x69, 0x74, 0x74, 0x65, 0x6e, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x03, 0x52, 0x07, 0x57, 0x72, 0x69, 0x74, 0x74, 0x65, 0x6e, 0x22, 0x61, 0x0a, 0x0b,
-	0x52, 0x65, 0x61, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x4e,
+	0x6b, 0x22, 0x07, 0x0a, 0x05, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x88, 0x01, 0x0a, 0x0c, 0x57,
+	0x72, 0x69, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x4e,
 	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12,
-	0x1c, 0x0a, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x03, 0x52, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x20, 0x0a,
-	0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x22,
-	0x4b, 0x0a, 0x09, 0x52, 0x65, 0x61, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x12, 0x0a, 0x04,
-	0x44, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44, 0x61, 0x74, 0x61,
-	0x12, 0x12, 0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04,
-	0x53, 0x69, 0x7a, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x45, 0x78, 0x69, 0x73, 0x74, 0x73, 0x18, 0x03,
-	0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x45, 0x78, 0x69, 0x73, 0x74, 0x73, 0x22, 0x47, 0x0a, 0x0d,
-	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a,
-	0x05, 0x66, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x66, 0x6e,
-	0x61, 0x6d, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61,
+	0x12, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44,
+	0x61, 0x74, 0x61, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61,
 	0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66,
-	0x69, 0x63, 0x61, 0x74, 0x65, 0x22, 0x25, 0x0a, 0x0b, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x52,
-	0x65, 0x70, 0x6c, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x65, 0x78, 0x69, 0x73, 0x74, 0x73, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x65, 0x78, 0x69, 0x73, 0x74, 0x73, 0x22, 0x21, 0x0a, 0x0f,
-	0x46, 0x69, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
-	0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x69, 0x64, 0x22,
-	0x1f, 0x0a, 0x0d, 0x46, 0x69, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x52, 0x65, 0x70, 0x6c, 0x79,
-	0x12, 0x0e, 0x0a, 0x02, 0x69, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x70,
-	0x32, 0x99, 0x02, 0x0a, 0x0b, 0x50, 0x65, 0x65, 0x72, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x12, 0x2e, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x11, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e,
-	0x50, 0x69, 0x6e, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x1a, 0x11, 0x2e, 0x70, 0x65,
-	0x65, 0x72, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x00,
-	0x12, 0x31, 0x0a, 0x05, 0x57, 0x72, 0x69, 0x74, 0x65, 0x12, 0x12, 0x2e, 0x70, 0x65, 0x65, 0x72,
-	0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e,
-	0x70, 0x65, 0x65, 0x72, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
-	0x00, 0x28, 0x01, 0x12, 0x2e, 0x0a, 0x04, 0x52, 0x65, 0x61, 0x64, 0x12, 0x11, 0x2e, 0x70, 0x65,
-	0x65, 0x72, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0f,
-	0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
-	0x00, 0x30, 0x01, 0x12, 0x32, 0x0a, 0x06, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x12, 0x13, 0x2e,
-	0x70, 0x65, 0x65, 0x72, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x1a, 0x11, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65,
-	0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x43, 0x0a, 0x13, 0x46, 0x69, 0x6e, 0x64, 0x53,
-	0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x49, 0x6e, 0x52, 0x69, 0x6e, 0x67, 0x12, 0x15,
-	0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x46, 0x69, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x46, 0x69, 0x6e,
-	0x64, 0x53, 0x75, 0x63, 0x63, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x62, 0x06, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x33,
+	0x69, 0x63, 0x61, 0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x4f, 0x76, 0x65,
+	0x72, 0x66, 0x6c, 0x6f, 0x77, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x4f, 0x76, 0x65,
+	0x72, 0x66, 0x6c, 0x6f, 0x77, 0x22, 0x26, 0x0a, 0x0a, 0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x65,
+	0x70, 0x6c, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x57, 0x72, 0x69, 0x74, 0x74, 0x65, 0x6e, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x57, 0x72, 0x69, 0x74, 0x74, 0x65, 0x6e, 0x22, 0x7d, 0x0a,
+	0x0b, 0x52, 0x65, 0x61, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04,
+	0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65,
+	0x12, 0x1c, 0x0a, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x20,
+	0x0a, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x4f, 0x76, 0x65, 0x72, 0x66, 0x6c, 0x6f, 0x77, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x08, 0x4f, 0x76, 0x65, 0x72, 0x66, 0x6c, 0x6f, 0x77, 0x22, 0x4b, 0x0a, 0x09,
+	0x52, 0x65, 0x61, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x44, 0x61, 0x74,
+	0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44, 0x61, 0x74, 0x61, 0x12, 0x12, 0x0a,
+	0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x53, 0x69, 0x7a,
+	0x65, 0x12, 0x16, 0x0a, 0x06, 0x45, 0x78, 0x69, 0x73, 0x74, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x06, 0x45, 0x78, 0x69, 0x73, 0x74, 0x73, 0x22, 0x63, 0x0a, 0x0d, 0x44, 0x65, 0x6c,
+	0x65, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6e,
+	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x66, 0x6e, 0x61, 0x6d, 0x65,
+	0x12, 0x20, 0x0a, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61,
+	0x74, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x4f, 0x76, 0x65, 0x72, 0x66, 0x6c, 0x6f, 0x77, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x4f, 0x76, 0x65, 0x72, 0x66, 0x6c, 0x6f, 0x77, 0x22, 0x25,
+	0x0a, 0x0b, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x16, 0x0a,
+	0x06, 0x65, 0x78, 0x69, 0x73, 0x74, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x65,
+	0x78, 0x69, 0x73, 0x74, 0x73, 0x22, 0x37, 0x0a, 0x0f, 0x46, 0x69, 0x6e, 0x64, 0x53, 0x75, 0x63,
+	0x63, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x72, 0x65, 0x73,
+	0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x66, 0x72, 0x65, 0x73, 0x68, 0x22, 0x7b,
+	0x0a, 0x0d, 0x46, 0x69, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12,
+	0x0e, 0x0a, 0x02, 0x69, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x70, 0x12,
+	0x1e, 0x0a, 0x0a, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x73, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x73, 0x12,
+	0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04, 0x70,
+	0x61, 0x74, 0x68, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x65, 0x6e, 0x64,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x65, 0x6e, 0x64, 0x22, 0x64, 0x0a, 0x0e, 0x48,
+	0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a,
+	0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x04, 0x44, 0x61, 0x74, 0x61, 0x12, 0x16, 0x0a, 0x06, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x12, 0x0a,
+	0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x53, 0x69, 0x7a,
+	0x65, 0x22, 0x46, 0x0a, 0x0c, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x08, 0x52, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x12, 0x1a, 0x0a,
+	0x08, 0x43, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x08, 0x43, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x22, 0x2a, 0x0a, 0x14, 0x48, 0x61, 0x6e,
+	0x64, 0x6f, 0x66, 0x66, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x4e, 0x61, 0x6d, 0x65, 0x22, 0x2c, 0x0a, 0x12, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66,
+	0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x4f,
+	0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x4f, 0x66, 0x66,
+	0x73, 0x65, 0x74, 0x22, 0x28, 0x0a, 0x12, 0x44, 0x72, 0x6f, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x69,
+	0x63, 0x61, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x22, 0x0e, 0x0a,
+	0x0c, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xb6, 0x01,
+	0x0a, 0x0a, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x12, 0x0a, 0x04,
+	0x4b, 0x65, 0x79, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x4b, 0x65, 0x79, 0x73,
+	0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x73, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x08, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x73, 0x12, 0x28, 0x0a, 0x0f,
+	0x55, 0x6e, 0x64, 0x65, 0x72, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x64, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x55, 0x6e, 0x64, 0x65, 0x72, 0x52, 0x65, 0x70, 0x6c,
+	0x69, 0x63, 0x61, 0x74, 0x65, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x61, 0x70, 0x61, 0x63, 0x69,
+	0x74, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x43, 0x61, 0x70, 0x61, 0x63, 0x69,
+	0x74, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x55, 0x73, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x04, 0x55, 0x73, 0x65, 0x64, 0x12, 0x1e, 0x0a, 0x0a, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73,
+	0x73, 0x6f, 0x72, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x53, 0x75, 0x63, 0x63,
+	0x65, 0x73, 0x73, 0x6f, 0x72, 0x73, 0x32, 0xc5, 0x04, 0x0a, 0x0b, 0x50, 0x65, 0x65, 0x72, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x2e, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x11,
+	0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x1a, 0x11, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x4d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x22, 0x00, 0x12, 0x31, 0x0a, 0x05, 0x57, 0x72, 0x69, 0x74, 0x65, 0x12,
+	0x12, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x12, 0x2e, 0x0a, 0x04, 0x52, 0x65, 0x61,
+	0x64, 0x12, 0x11, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x52, 0x65, 0x61, 0x64,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x30, 0x01, 0x12, 0x32, 0x0a, 0x06, 0x44, 0x65, 0x6c,
+	0x65, 0x74, 0x65, 0x12, 0x13, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x11, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e,
+	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x43, 0x0a,
+	0x13, 0x46, 0x69, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x49, 0x6e,
+	0x52, 0x69, 0x6e, 0x67, 0x12, 0x15, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x46, 0x69, 0x6e, 0x64,
+	0x53, 0x75, 0x63, 0x63, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13, 0x2e, 0x70, 0x65,
+	0x65, 0x72, 0x2e, 0x46, 0x69, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x52, 0x65, 0x70, 0x6c, 0x79,
+	0x22, 0x00, 0x12, 0x37, 0x0a, 0x07, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x12, 0x14, 0x2e,
+	0x70, 0x65, 0x65, 0x72, 0x2e, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x48, 0x61, 0x6e, 0x64, 0x6f,
+	0x66, 0x66, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x12, 0x47, 0x0a, 0x0d, 0x48,
+	0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x1a, 0x2e, 0x70,
+	0x65, 0x65, 0x72, 0x2e, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x4f, 0x66, 0x66, 0x73, 0x65,
+	0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e,
+	0x48, 0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x52, 0x65, 0x70,
+	0x6c, 0x79, 0x22, 0x00, 0x12, 0x39, 0x0a, 0x09, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74,
+	0x65, 0x12, 0x14, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x48,
+	0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x12,
+	0x3c, 0x0a, 0x0b, 0x44, 0x72, 0x6f, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x12, 0x18,
+	0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x44, 0x72, 0x6f, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63,
+	0x61, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x11, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e,
+	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x2f, 0x0a,
+	0x05, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x12, 0x2e, 0x70, 0x65, 0x65, 0x72, 0x2e, 0x53, 0x74,
+	0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x70, 0x65, 0x65,
+	0x72, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -616,35 +1144,52 @@ func file_peer_proto_rawDescGZIP() []byte {
 	return file_peer_proto_rawDescData
 }
 
-var file_peer_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_peer_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
 var file_peer_proto_goTypes = []interface{}{
-	(*PingMessage)(nil),     // 0: peer.PingMessage
-	(*Empty)(nil),           // 1: peer.Empty
-	(*WriteRequest)(nil),    // 2: peer.WriteRequest
-	(*WriteReply)(nil),      // 3: peer.WriteReply
-	(*ReadRequest)(nil),     // 4: peer.ReadRequest
-	(*ReadReply)(nil),       // 5: peer.ReadReply
-	(*DeleteRequest)(nil),   // 6: peer.DeleteRequest
-	(*DeleteReply)(nil),     // 7: peer.DeleteReply
-	(*FindSuccRequest)(nil), // 8: peer.FindSuccRequest
-	(*FindSuccReply)(nil),   // 9: peer.FindSuccReply
+	(*PingMessage)(nil),          // 0: peer.PingMessage
+	(*Empty)(nil),                // 1: peer.Empty
+	(*WriteRequest)(nil),         // 2: peer.WriteRequest
+	(*WriteReply)(nil),           // 3: peer.WriteReply
+	(*ReadRequest)(nil),          // 4: peer.ReadRequest
+	(*ReadReply)(nil),            // 5: peer.ReadReply
+	(*DeleteRequest)(nil),        // 6: peer.DeleteRequest
+	(*DeleteReply)(nil),          // 7: peer.DeleteReply
+	(*FindSuccRequest)(nil),      // 8: peer.FindSuccRequest
+	(*FindSuccReply)(nil),        // 9: peer.FindSuccReply
+	(*HandoffRequest)(nil),       // 10: peer.HandoffRequest
+	(*HandoffReply)(nil),         // 11: peer.HandoffReply
+	(*HandoffOffsetRequest)(nil), // 12: peer.HandoffOffsetRequest
+	(*HandoffOffsetReply)(nil),   // 13: peer.HandoffOffsetReply
+	(*DropReplicaRequest)(nil),   // 14: peer.DropReplicaRequest
+	(*StatsRequest)(nil),         // 15: peer.StatsRequest
+	(*StatsReply)(nil),           // 16: peer.StatsReply
 }
 var file_peer_proto_depIdxs = []int32{
-	0, // 0: peer.PeerService.Ping:input_type -> peer.PingMessage
-	2, // 1: peer.PeerService.Write:input_type -> peer.WriteRequest
-	4, // 2: peer.PeerService.Read:input_type -> peer.ReadRequest
-	6, // 3: peer.PeerService.Delete:input_type -> peer.DeleteRequest
-	8, // 4: peer.PeerService.FindSuccessorInRing:input_type -> peer.FindSuccRequest
-	0, // 5: peer.PeerService.Ping:output_type -> peer.PingMessage
-	3, // 6: peer.PeerService.Write:output_type -> peer.WriteReply
-	5, // 7: peer.PeerService.Read:output_type -> peer.ReadReply
-	7, // 8: peer.PeerService.Delete:output_type -> peer.DeleteReply
-	9, // 9: peer.PeerService.FindSuccessorInRing:output_type -> peer.FindSuccReply
-	5, // [5:10] is the sub-list for method output_type
-	0, // [0:5] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: peer.PeerService.Ping:input_type -> peer.PingMessage
+	2,  // 1: peer.PeerService.Write:input_type -> peer.WriteRequest
+	4,  // 2: peer.PeerService.Read:input_type -> peer.ReadRequest
+	6,  // 3: peer.PeerService.Delete:input_type -> peer.DeleteRequest
+	8,  // 4: peer.PeerService.FindSuccessorInRing:input_type -> peer.FindSuccRequest
+	10, // 5: peer.PeerService.Handoff:input_type -> peer.HandoffRequest
+	12, // 6: peer.PeerService.HandoffOffset:input_type -> peer.HandoffOffsetRequest
+	10, // 7: peer.PeerService.Replicate:input_type -> peer.HandoffRequest
+	14, // 8: peer.PeerService.DropReplica:input_type -> peer.DropReplicaRequest
+	15, // 9: peer.PeerService.Stats:input_type -> peer.StatsRequest
+	0,  // 10: peer.PeerService.Ping:output_type -> peer.PingMessage
+	3,  // 11: peer.PeerService.Write:output_type -> peer.WriteReply
+	5,  // 12: peer.PeerService.Read:output_type -> peer.ReadReply
+	7,  // 13: peer.PeerService.Delete:output_type -> peer.DeleteReply
+	9,  // 14: peer.PeerService.FindSuccessorInRing:output_type -> peer.FindSuccReply
+	11, // 15: peer.PeerService.Handoff:output_type -> peer.HandoffReply
+	13, // 16: peer.PeerService.HandoffOffset:output_type -> peer.HandoffOffsetReply
+	11, // 17: peer.PeerService.Replicate:output_type -> peer.HandoffReply
+	7,  // 18: peer.PeerService.DropReplica:output_type -> peer.DeleteReply
+	16, // 19: peer.PeerService.Stats:output_type -> peer.StatsReply
+	10, // [10:20] is the sub-list for method output_type
+	0,  // [0:10] is the sub-list for method input_type
+	0,  // [0:0] is the sub-list for extension type_name
+	0,  // [0:0] is the sub-list for extension extendee
+	0,  // [0:0] is the sub-list for field type_name
 }
 
 func init() { file_peer_proto_init() }
@@ -773,6 +1318,90 @@ func file_peer_proto_init() {
 				return nil
 			}
 		}
+		file_peer_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HandoffRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_peer_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HandoffReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_peer_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HandoffOffsetRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_peer_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HandoffOffsetReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_peer_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DropReplicaRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_peer_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_peer_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatsReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -780,7 +1409,7 @@ func file_peer_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_peer_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   10,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -811,6 +1440,14 @@ type PeerServiceClient interface {
 	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (PeerService_ReadClient, error)
 	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteReply, error)
 	FindSuccessorInRing(ctx context.Context, in *FindSuccRequest, opts ...grpc.CallOption) (*FindSuccReply, error)
+	// Node to node transfer of shards that changed owner
+	Handoff(ctx context.Context, opts ...grpc.CallOption) (PeerService_HandoffClient, error)
+	HandoffOffset(ctx context.Context, in *HandoffOffsetRequest, opts ...grpc.CallOption) (*HandoffOffsetReply, error)
+	// Copies of shards kept by the successors of the owner
+	Replicate(ctx context.Context, opts ...grpc.CallOption) (PeerService_ReplicateClient, error)
+	DropReplica(ctx context.Context, in *DropReplicaRequest, opts ...grpc.CallOption) (*DeleteReply, error)
+	// Health of the node's shards
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsReply, error)
 }
 
 type peerServiceClient struct {
@@ -914,6 +1551,101 @@ func (c *peerServiceClient) FindSuccessorInRing(ctx context.Context, in *FindSuc
 	return out, nil
 }
 
+func (c *peerServiceClient) Handoff(ctx context.Context, opts ...grpc.CallOption) (PeerService_HandoffClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PeerService_serviceDesc.Streams[2], "/peer.PeerService/Handoff", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &peerServiceHandoffClient{stream}
+	return x, nil
+}
+
+type PeerService_HandoffClient interface {
+	Send(*HandoffRequest) error
+	CloseAndRecv() (*HandoffReply, error)
+	grpc.ClientStream
+}
+
+type peerServiceHandoffClient struct {
+	grpc.ClientStream
+}
+
+func (x *peerServiceHandoffClient) Send(m *HandoffRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *peerServiceHandoffClient) CloseAndRecv() (*HandoffReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(HandoffReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *peerServiceClient) HandoffOffset(ctx context.Context, in *HandoffOffsetRequest, opts ...grpc.CallOption) (*HandoffOffsetReply, error) {
+	out := new(HandoffOffsetReply)
+	err := c.cc.Invoke(ctx, "/peer.PeerService/HandoffOffset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) Replicate(ctx context.Context, opts ...grpc.CallOption) (PeerService_ReplicateClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PeerService_serviceDesc.Streams[3], "/peer.PeerService/Replicate", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &peerServiceReplicateClient{stream}
+	return x, nil
+}
+
+type PeerService_ReplicateClient interface {
+	Send(*HandoffRequest) error
+	CloseAndRecv() (*HandoffReply, error)
+	grpc.ClientStream
+}
+
+type peerServiceReplicateClient struct {
+	grpc.ClientStream
+}
+
+func (x *peerServiceReplicateClient) Send(m *HandoffRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *peerServiceReplicateClient) CloseAndRecv() (*HandoffReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(HandoffReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *peerServiceClient) DropReplica(ctx context.Context, in *DropReplicaRequest, opts ...grpc.CallOption) (*DeleteReply, error) {
+	out := new(DeleteReply)
+	err := c.cc.Invoke(ctx, "/peer.PeerService/DropReplica", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsReply, error) {
+	out := new(StatsReply)
+	err := c.cc.Invoke(ctx, "/peer.PeerService/Stats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PeerServiceServer is the server API for PeerService service.
 type PeerServiceServer interface {
 	Ping(context.Context, *PingMessage) (*PingMessage, error)
@@ -921,6 +1653,14 @@ type PeerServiceServer interface {
 	Read(*ReadRequest, PeerService_ReadServer) error
 	Delete(context.Context, *DeleteRequest) (*DeleteReply, error)
 	FindSuccessorInRing(context.Context, *FindSuccRequest) (*FindSuccReply, error)
+	// Node to node transfer of shards that changed owner
+	Handoff(PeerService_HandoffServer) error
+	HandoffOffset(context.Context, *HandoffOffsetRequest) (*HandoffOffsetReply, error)
+	// Copies of shards kept by the successors of the owner
+	Replicate(PeerService_ReplicateServer) error
+	DropReplica(context.Context, *DropReplicaRequest) (*DeleteReply, error)
+	// Health of the node's shards
+	Stats(context.Context, *StatsRequest) (*StatsReply, error)
 }
 
 // UnimplementedPeerServiceServer can be embedded to have forward compatible implementations.
@@ -942,6 +1682,21 @@ func (*UnimplementedPeerServiceServer) Delete(context.Context, *DeleteRequest) (
 func (*UnimplementedPeerServiceServer) FindSuccessorInRing(context.Context, *FindSuccRequest) (*FindSuccReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method FindSuccessorInRing not implemented")
 }
+func (*UnimplementedPeerServiceServer) Handoff(PeerService_HandoffServer) error {
+	return status.Errorf(codes.Unimplemented, "method Handoff not implemented")
+}
+func (*UnimplementedPeerServiceServer) HandoffOffset(context.Context, *HandoffOffsetRequest) (*HandoffOffsetReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandoffOffset not implemented")
+}
+func (*UnimplementedPeerServiceServer) Replicate(PeerService_ReplicateServer) error {
+	return status.Errorf(codes.Unimplemented, "method Replicate not implemented")
+}
+func (*UnimplementedPeerServiceServer) DropReplica(context.Context, *DropReplicaRequest) (*DeleteReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DropReplica not implemented")
+}
+func (*UnimplementedPeerServiceServer) Stats(context.Context, *StatsRequest) (*StatsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
 
 func RegisterPeerServiceServer(s *grpc.Server, srv PeerServiceServer) {
 	s.RegisterService(&_PeerService_serviceDesc, srv)
@@ -1048,6 +1803,112 @@ func _PeerService_FindSuccessorInRing_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PeerService_Handoff_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PeerServiceServer).Handoff(&peerServiceHandoffServer{stream})
+}
+
+type PeerService_HandoffServer interface {
+	SendAndClose(*HandoffReply) error
+	Recv() (*HandoffRequest, error)
+	grpc.ServerStream
+}
+
+type peerServiceHandoffServer struct {
+	grpc.ServerStream
+}
+
+func (x *peerServiceHandoffServer) SendAndClose(m *HandoffReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *peerServiceHandoffServer) Recv() (*HandoffRequest, error) {
+	m := new(HandoffRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PeerService_HandoffOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HandoffOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).HandoffOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.PeerService/HandoffOffset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).HandoffOffset(ctx, req.(*HandoffOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_Replicate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PeerServiceServer).Replicate(&peerServiceReplicateServer{stream})
+}
+
+type PeerService_ReplicateServer interface {
+	SendAndClose(*HandoffReply) error
+	Recv() (*HandoffRequest, error)
+	grpc.ServerStream
+}
+
+type peerServiceReplicateServer struct {
+	grpc.ServerStream
+}
+
+func (x *peerServiceReplicateServer) SendAndClose(m *HandoffReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *peerServiceReplicateServer) Recv() (*HandoffRequest, error) {
+	m := new(HandoffRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PeerService_DropReplica_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DropReplicaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).DropReplica(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.PeerService/DropReplica",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).DropReplica(ctx, req.(*DropReplicaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/peer.PeerService/Stats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _PeerService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "peer.PeerService",
 	HandlerType: (*PeerServiceServer)(nil),
@@ -1064,6 +1925,18 @@ var _PeerService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "FindSuccessorInRing",
 			Handler:    _PeerService_FindSuccessorInRing_Handler,
 		},
+		{
+			MethodName: "HandoffOffset",
+			Handler:    _PeerService_HandoffOffset_Handler,
+		},
+		{
+			MethodName: "DropReplica",
+			Handler:    _PeerService_DropReplica_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _PeerService_Stats_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -1076,6 +1949,16 @@ var _PeerService_serviceDesc = grpc.ServiceDesc{
 			Handler:       _PeerService_Read_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Handoff",
+			Handler:       _PeerService_Handoff_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Replicate",
+			Handler:       _PeerService_Replicate_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "peer.proto",
 }
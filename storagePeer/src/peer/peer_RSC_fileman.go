@@ -17,7 +17,17 @@ func getShardName(fname string, number int) string {
 }
 
 // UploadFileRSC - like UploadFile but with Reed-Solomon erasure coding
-func UploadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte, certificate string) error {
+func UploadFileRSC(ringIP string, fname string, fcontent []byte, certificate string) error {
+	return UploadFileWithOptions(ringIP, fname, fcontent, certificate, Options{})
+}
+
+// DownloadFileRSC downloads file using Reed Solomon Codes
+func DownloadFileRSC(ringIP string, fname string, fcontent []byte, certificate string) (int, error) {
+	return DownloadFileWithOptions(ringIP, fname, fcontent, certificate, Options{})
+}
+
+// uploadRSC erasure codes the content and uploads the shards
+func uploadRSC(ringIP string, fname string, fcontent []byte, certificate string) error {
 	enc, err := reedsolomon.New(dataRSC, parityRSC)
 	if err != nil {
 		return err
@@ -46,7 +56,7 @@ func UploadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte,
 	}
 
 	for i, s := range data {
-		err := uploadFile(ringIP, getShardName(fname, i), ringsz, s, certificate)
+		err := uploadFile(ringIP, getShardName(fname, i), s, certificate)
 		if err != nil {
 			return err
 		}
@@ -55,8 +65,8 @@ func UploadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte,
 	return nil
 }
 
-// DownloadFileRSC downloads file using Reed Solomon Codes
-func DownloadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte, certificate string) (int, error) {
+// downloadRSC downloads the shards and puts the content together
+func downloadRSC(ringIP string, fname string, fcontent []byte, certificate string) (int, error) {
 	enc, _ := reedsolomon.New(dataRSC, parityRSC)
 
 	shards := make([][]byte, dataRSC+parityRSC)
@@ -68,10 +78,13 @@ func DownloadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte
 
 	for {
 		if shardnum > parityRSC {
+			if !anyShard(ringIP, fname, shardnum, certificate) {
+				return 0, os.ErrNotExist
+			}
 			return 0, fmt.Errorf("Too many corrupt files, can't recover")
 		}
 
-		empty, err := downloadFile(ringIP, getShardName(fname, shardnum), ringsz, firstShard, certificate)
+		empty, err := downloadFile(ringIP, getShardName(fname, shardnum), firstShard, certificate)
 		if !os.IsNotExist(err) {
 			shardlen = maxshardlen - empty
 			if (shardnum+1)*shardlen > len(fcontent) {
@@ -97,7 +110,7 @@ func DownloadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte
 			shards[shardnum] = make([]byte, shardlen)
 		}
 
-		empty, err := downloadFile(ringIP, fmt.Sprintf("%s_rep%d", fname, shardnum), ringsz, shards[shardnum], certificate)
+		empty, err := downloadFile(ringIP, fmt.Sprintf("%s_rep%d", fname, shardnum), shards[shardnum], certificate)
 		if os.IsNotExist(err) {
 			shards[shardnum] = nil
 			nilshards[shardnum] = true
@@ -123,9 +136,51 @@ func DownloadFileRSC(ringIP string, fname string, ringsz uint64, fcontent []byte
 	return totalEmpty, nil
 }
 
-func DeleteFileRSC(ringIP string, fname string, ringsz uint64, certificate string) error {
+// anyShard tells if any of the shards from the first one is there, files without any don't exist
+func anyShard(ringIP string, fname string, first int, certificate string) bool {
+
+	for i := first; i < dataRSC+parityRSC; i++ {
+		if _, err := downloadFile(ringIP, getShardName(fname, i), nil, certificate); !os.IsNotExist(err) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func DeleteFileRSC(ringIP string, fname string, certificate string) error {
+	return DeleteFileWithOptions(ringIP, fname, certificate, Options{})
+}
+
+// DeleteFileWithOptions deletes the file uploaded with the options. Files uploaded before
+// namespaces keep their plain names, nodes don't let tokens of users delete them.
+func DeleteFileWithOptions(ringIP string, fname string, certificate string, opts Options) error {
+
+	fname, err := opts.storedName(fname, certificate)
+	if err != nil {
+		return err
+	}
+
+	// Blocks of the file are known only from its manifest. Without it they would stay referenced
+	// forever, so the file stays too unless it never had one.
+	m, err := downloadManifest(ringIP, fname, certificate)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// File without a manifest can't be read anymore, so it goes first
+	err = deleteFile(ringIP, manifestName(fname), certificate)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if m.BlockSize > 0 {
+		owner, _ := splitNamespace(fname)
+		return releaseBlocks(ringIP, owner, m.Blocks, certificate)
+	}
+
 	for i := 0; i < dataRSC+parityRSC; i++ {
-		err := deleteFile(ringIP, getShardName(fname, i), ringsz, certificate)
+		err := deleteFile(ringIP, getShardName(fname, i), certificate)
 		if err != nil && !os.IsNotExist(err) {
 			return err
 		}
@@ -0,0 +1,150 @@
+// Maintaining the replication factor of our shards
+package peer
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// Stats tells how healthy the shards of this node are
+func (p *Peer) Stats(ctx context.Context, r *StatsRequest) (*StatsReply, error) {
+
+	return &StatsReply{
+		Keys:            int64(len(p.ring.Keys())),
+		Replicas:        int64(len(p.ring.ReplicaKeys())),
+		UnderReplicated: atomic.LoadInt64(&p.underReplicated),
+		Capacity:        p.store.capacity,
+		Used:            p.store.usage(),
+		Successors:      p.ring.Successors(),
+	}, nil
+}
+
+// fileDigest hashes the content of a shard
+func fileDigest(fname string) ([]byte, error) {
+
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// ownEntries returns our keys with the digests of their shards
+func (p *Peer) ownEntries() map[string][]byte {
+
+	keys := p.ring.Keys()
+	entries := make(map[string][]byte, len(keys))
+
+	for _, key := range keys {
+		digest := p.ring.KeyDigest(key)
+		if digest == nil {
+			// Shard came from somewhere without a digest, calculate it once
+			if d, err := fileDigest(p.path(key)); err == nil {
+				digest = d
+				p.ring.SetKeyDigest(key, d)
+			}
+		}
+		entries[key] = digest
+	}
+
+	return entries
+}
+
+// antiEntropy compares Merkle trees of our keys with the trees of the replicas on our successors.
+// Missing or outdated copies are sent again, copies on nodes that are too far from us are removed.
+// Returns number of keys with less than p.replicas copies.
+func (p *Peer) antiEntropy() int64 {
+
+	start, end := p.ring.Range()
+	entries := p.ownEntries()
+	copies := make(map[string]int, len(entries))
+	empty := make(map[string][]byte)
+
+	holders := 0
+	for _, ip := range p.ring.Successors() {
+
+		// Nodes further than p.replicas (and our own positions) shouldn't have anything from our range
+		holder := !p.siblings[ip] && holders < p.replicas
+		if holder {
+			holders++
+		}
+
+		local := entries
+		if !holder {
+			local = empty
+		}
+
+		missing, extra, err := p.ring.CompareKeys(ip, true, start, end, local, true)
+		if err != nil {
+			// Fix routine of the ring will take care of it
+			continue
+		}
+
+		// Over-replicated (or deleted) keys
+		for _, key := range extra {
+			if err := dropReplicaOn(ip, key); err != nil {
+				fmt.Println(err.Error())
+			}
+		}
+
+		if !holder {
+			continue
+		}
+
+		// Under-replicated keys: send the copy again
+		failed := make(map[string]bool)
+		for _, key := range missing {
+			if err := replicateFile(ip, p.path(key), key); err != nil {
+				fmt.Println(err.Error())
+				failed[key] = true
+			}
+		}
+
+		for key := range entries {
+			if !failed[key] {
+				copies[key]++
+			}
+		}
+	}
+
+	// We don't need a copy of what we own ourselves
+	for _, key := range p.ring.ReplicaKeys() {
+		if _, owned := entries[key]; owned {
+			p.ring.RemoveReplicaKey(key)
+			untrack := p.track(p.path(replicaName(key)), p.path(refsName(replicaName(key))))
+			os.Remove(p.path(refsName(replicaName(key))))
+			os.Remove(p.path(replicaName(key)))
+			untrack()
+		}
+	}
+
+	var under int64
+	for key := range entries {
+		if copies[key] < p.replicas {
+			under++
+		}
+	}
+
+	return under
+}
+
+func (p *Peer) antiEntropyRoutine() {
+
+	for p.sleep() {
+		under := p.antiEntropy()
+		if under != atomic.SwapInt64(&p.underReplicated, under) {
+			fmt.Printf("%s has %d under-replicated keys\n", p.ownIP, under)
+		}
+	}
+}
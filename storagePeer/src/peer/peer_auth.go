@@ -0,0 +1,218 @@
+// Answers of the auth server kept by the node, so reads don't wait for it
+package peer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultAuthGrace is how long reads go on after the auth server stopped answering
+const DefaultAuthGrace = 10 * time.Minute
+
+// How often the revocation list is pulled
+const revocationRefresh = time.Minute
+
+// Auth server that is slower than this counts as down
+const authTimeout = 5 * time.Second
+
+// Where nodes ask if a token is still good
+const authURL = SERVER_IP + "/auth/node/action"
+
+// tokenAuth checks tokens with the auth server and remembers its answers
+type tokenAuth struct {
+	url         string
+	revocations string // File or URL with ids of revoked tokens (empty for none)
+	grace       time.Duration
+	client      *http.Client
+
+	mu       sync.Mutex
+	valid    map[string]int64 // Tokens the server confirmed, until they expire (Unix seconds)
+	revoked  map[string]bool
+	lastSeen time.Time // Last answer of the server, grace period counts from it
+	used     map[string]tokenUsage
+}
+
+func newTokenAuth(url string, revocations string, grace time.Duration) *tokenAuth {
+
+	if grace == 0 {
+		grace = DefaultAuthGrace
+	}
+
+	return &tokenAuth{
+		url:         url,
+		revocations: revocations,
+		grace:       grace,
+		client:      &http.Client{Timeout: authTimeout},
+		valid:       make(map[string]int64),
+		revoked:     make(map[string]bool),
+		used:        make(map[string]tokenUsage),
+	}
+}
+
+// tokenID is the id of the token, tokens without one are told apart by their hash
+func tokenID(tokenString string, claims *FileClaim) string {
+
+	if claims.Id != "" {
+		return claims.Id
+	}
+
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+// notRevoked checks the token against the revocation list only, the server isn't asked
+func (a *tokenAuth) notRevoked(tokenString string, claims *FileClaim) error {
+
+	if a == nil {
+		return nil
+	}
+
+	id := tokenID(tokenString, claims)
+
+	a.mu.Lock()
+	revoked := a.revoked[id]
+	a.mu.Unlock()
+
+	if revoked {
+		return status.Errorf(codes.PermissionDenied, "Certificate %s is revoked", id)
+	}
+
+	return nil
+}
+
+// check asks the server about tokens it hasn't confirmed yet. When it's down, reads are allowed
+// for the grace period, other actions are not.
+func (a *tokenAuth) check(tokenString string, claims *FileClaim, action int8) error {
+
+	if a == nil {
+		return status.Error(codes.Unavailable, "node can't check tokens with the auth server")
+	}
+	if err := a.notRevoked(tokenString, claims); err != nil {
+		return err
+	}
+
+	id := tokenID(tokenString, claims)
+
+	a.mu.Lock()
+	_, confirmed := a.valid[id]
+	a.mu.Unlock()
+
+	if confirmed {
+		return nil
+	}
+
+	resp, err := a.ask(tokenString)
+	if err != nil {
+		a.mu.Lock()
+		down := time.Since(a.lastSeen)
+		a.mu.Unlock()
+
+		if action == READACT && down <= a.grace {
+			fmt.Printf("Auth server is down, trusting certificate %s: %v\n", id, err)
+			return nil
+		}
+
+		return status.Errorf(codes.Unavailable, "auth server is down: %v", err)
+	}
+
+	a.mu.Lock()
+	a.lastSeen = time.Now()
+	if resp.Valid {
+		a.valid[id] = claims.ExpiresAt
+	}
+	a.mu.Unlock()
+
+	if !resp.Valid {
+		return status.Errorf(codes.PermissionDenied, "Certificate invalidated by server, msg=%s", resp.Message)
+	}
+
+	return nil
+}
+
+// ask sends the token to the auth server, errors mean that there was no answer
+func (a *tokenAuth) ask(tokenString string) (FileValidationResponse, error) {
+
+	responseParsed := FileValidationResponse{}
+
+	responseRaw, err := a.client.Post(a.url, "text/plain", strings.NewReader(tokenString))
+	if err != nil {
+		return responseParsed, err
+	}
+	defer responseRaw.Body.Close()
+
+	if responseRaw.StatusCode != http.StatusOK {
+		return responseParsed, fmt.Errorf("%s answered %s", a.url, responseRaw.Status)
+	}
+
+	err = json.NewDecoder(responseRaw.Body).Decode(&responseParsed)
+	return responseParsed, err
+}
+
+////////
+// Revocations
+////////
+
+// reloadRevocations reads the list of revoked token ids, a JSON array
+func (a *tokenAuth) reloadRevocations() error {
+
+	data, err := readSource(context.Background(), a.revocations)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	if err = json.Unmarshal(data, &ids); err != nil {
+		return err
+	}
+
+	revoked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		revoked[id] = true
+	}
+
+	a.mu.Lock()
+	a.revoked = revoked
+	a.mu.Unlock()
+
+	a.forgetExpired()
+	return nil
+}
+
+// forgetExpired drops tokens that expired or were revoked since
+func (a *tokenAuth) forgetExpired() {
+
+	now := time.Now().Unix()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for id, expires := range a.valid {
+		if a.revoked[id] || expires < now {
+			delete(a.valid, id)
+		}
+	}
+	a.forgetUsage()
+}
+
+func (a *tokenAuth) revocationRoutine() {
+
+	for {
+		if a.revocations == "" {
+			a.forgetExpired()
+		} else if err := a.reloadRevocations(); err != nil {
+			fmt.Println(err.Error())
+		}
+
+		time.Sleep(revocationRefresh)
+	}
+}
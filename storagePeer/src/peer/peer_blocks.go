@@ -0,0 +1,271 @@
+// Content addressed blocks, files with the same data share what is stored on the ring
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Blocks live in their own directory of the namespace, tokens have to cover it
+const blockDir = ".blocks/"
+
+// Bytes of the stored file kept under one hash
+const blockSize = 1 << 20
+
+// Count of files referring to a block shard is kept next to it
+const refsSuffix = ".refs"
+
+// Counts of all block shards of the node change under it
+var refsMu sync.Mutex
+
+// blockKey is the name of the block with the hash in the namespace of owner
+func blockKey(owner string, hash string) string {
+	return nsKey(owner, blockDir+hash)
+}
+
+// isBlock tells shards of blocks from shards of files
+func isBlock(shardname string) bool {
+	_, name := splitNamespace(shardname)
+	return strings.HasPrefix(name, blockDir)
+}
+
+func refsName(fname string) string {
+	return fname + refsSuffix
+}
+
+// isRefs tells counts from shards, they travel with the shard but aren't keys
+func isRefs(fname string) bool {
+	return strings.HasSuffix(fname, refsSuffix)
+}
+
+////////
+// Client side
+////////
+
+// uploadBlocks erasure codes the content block by block under the hashes of the blocks
+func uploadBlocks(ringIP string, owner string, content []byte, certificate string, m *manifest) error {
+
+	m.BlockSize = blockSize
+	m.Blocks = make([]string, 0, (len(content)+blockSize-1)/blockSize)
+
+	for off := 0; off < len(content); off += blockSize {
+		end := off + blockSize
+		if end > len(content) {
+			end = len(content)
+		}
+
+		sum := sha256.Sum256(content[off:end])
+		hash := hex.EncodeToString(sum[:])
+		if err := uploadRSC(ringIP, blockKey(owner, hash), content[off:end], certificate); err != nil {
+			return err
+		}
+
+		m.Blocks = append(m.Blocks, hash)
+	}
+
+	return nil
+}
+
+// downloadBlocks puts the stored content of the file together from its blocks
+func downloadBlocks(ringIP string, owner string, m manifest, certificate string) ([]byte, error) {
+
+	if int64(len(m.Blocks)) != (m.Stored+int64(m.BlockSize)-1)/int64(m.BlockSize) {
+		return nil, fmt.Errorf("manifest has %d blocks for %d bytes", len(m.Blocks), m.Stored)
+	}
+
+	content := make([]byte, 0, m.Stored)
+	for _, hash := range m.Blocks {
+		sum, err := hex.DecodeString(hash)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("%q is not a block", hash)
+		}
+
+		size := int64(m.BlockSize)
+		if left := m.Stored - int64(len(content)); left < size {
+			size = left
+		}
+
+		// Every shard has to fit, parity ones too
+		shardLen := (size + dataRSC - 1) / dataRSC
+		buf := make([]byte, (dataRSC+parityRSC)*shardLen)
+		if _, err := downloadRSC(ringIP, blockKey(owner, hash), buf, certificate); err != nil {
+			return nil, err
+		}
+
+		// Name of the block is all we need to know it's the right one
+		if got := sha256.Sum256(buf[:size]); !bytes.Equal(got[:], sum) {
+			return nil, fmt.Errorf("block %s is damaged", hash)
+		}
+		content = append(content, buf[:size]...)
+	}
+
+	return content, nil
+}
+
+// releaseBlocks drops the references of a file to its blocks, nodes remove blocks nobody refers to
+func releaseBlocks(ringIP string, owner string, hashes []string, certificate string) error {
+
+	var last error
+	for _, hash := range hashes {
+		for i := 0; i < dataRSC+parityRSC; i++ {
+			err := deleteFile(ringIP, getShardName(blockKey(owner, hash), i), certificate)
+			if err != nil && !os.IsNotExist(err) {
+				last = err
+			}
+		}
+	}
+
+	return last
+}
+
+////////
+// Node side
+////////
+
+// readRefs is how many files refer to the block shard, 0 when it wasn't counted yet
+func readRefs(fpath string) (int64, error) {
+
+	data, err := ioutil.ReadFile(refsName(fpath))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+func writeRefs(fpath string, n int64) error {
+
+	tmp := refsName(fpath) + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.FormatInt(n, 10)), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, refsName(fpath))
+}
+
+// addRef counts one more file referring to the block shard
+func (p *Peer) addRef(fname string) error {
+
+	refsMu.Lock()
+	defer refsMu.Unlock()
+
+	// Shard might have been released while the data was on its way
+	if _, err := os.Stat(p.path(fname)); err != nil {
+		return status.Errorf(codes.Aborted, "%s was removed, write it again", fname)
+	}
+
+	n, err := readRefs(p.path(fname))
+	if err != nil {
+		return err
+	}
+
+	defer p.track(p.path(refsName(fname)))()
+	return writeRefs(p.path(fname), n+1)
+}
+
+// release drops a reference to the block shard and removes it with the last one.
+// Returns how many references are left.
+func (p *Peer) release(fname string) (int64, error) {
+
+	refsMu.Lock()
+	defer refsMu.Unlock()
+
+	n, err := readRefs(p.path(fname))
+	if err != nil {
+		return 0, err
+	}
+
+	defer p.track(p.path(fname), p.path(refsName(fname)))()
+	if n > 1 {
+		return n - 1, writeRefs(p.path(fname), n-1)
+	}
+
+	os.Remove(p.path(refsName(fname)))
+	return 0, os.Remove(p.path(fname))
+}
+
+// referBlock takes the data of a block shard we already have and only counts the reference
+func (p *Peer) referBlock(stream PeerService_WriteServer, info *WriteRequest, claims *FileClaim, limit int64) error {
+
+	written := int64(len(info.Data))
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		written += int64(len(chunk.Data))
+		if written > limit {
+			return p.errOverLimit(info.Name, limit, info.Certificate, claims)
+		}
+	}
+
+	if err := p.addRef(info.Name); err != nil {
+		return err
+	}
+	go p.replicateRefs(info.Name)
+
+	return stream.SendAndClose(&WriteReply{Written: written})
+}
+
+// sendRefs sends the count of local shard fpath to targetIP together with its replica
+func sendRefs(targetIP string, fpath string, fname string) error {
+
+	if _, err := os.Stat(refsName(fpath)); os.IsNotExist(err) {
+		return nil
+	}
+
+	cl, release, err := Connect(targetIP)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	rstream, err := cl.Replicate(context.Background())
+	if err != nil {
+		return err
+	}
+
+	_, err = sendShard(rstream, refsName(fpath), refsName(fname), 0)
+	return err
+}
+
+// replicateRefs updates the counts of the copies of the block shard, the data is the same
+func (p *Peer) replicateRefs(fname string) {
+
+	for _, ip := range p.replicaHolders() {
+		if err := sendRefs(ip, p.path(fname), fname); err != nil {
+			fmt.Println(err.Error())
+			fmt.Printf("Couldn't update references of %s on %s\n", fname, ip)
+		}
+	}
+}
+
+// moveRefs renames the count together with its shard
+func moveRefs(from string, to string) error {
+
+	err := os.Rename(refsName(from), refsName(to))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,161 @@
+// Capability tokens, one token for many files and actions
+package peer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Confirmation binds a token to the certificate of the client, as in RFC 8705
+type Confirmation struct {
+	// SHA-256 of the certificate in DER, base64url without padding
+	X5t string `json:"x5t#S256"`
+}
+
+// Bytes written under a token on this node
+type tokenUsage struct {
+	bytes   int64
+	expires int64 // Unix seconds, the token is useless after that
+}
+
+// capability tells capability tokens from the single file ones
+func (c *FileClaim) capability() bool {
+	return len(c.Acts) > 0 || len(c.Scopes) > 0
+}
+
+func (c *FileClaim) allows(action int8) bool {
+
+	if !c.capability() {
+		return c.Act == action
+	}
+
+	for _, act := range c.Acts {
+		if act == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// covers checks the file against the scopes, or the name of single file tokens
+func (c *FileClaim) covers(basename string) bool {
+
+	// Scope must not be left through the parent directory
+	if path.Clean(basename) != basename || path.IsAbs(basename) || basename == ".." || strings.HasPrefix(basename, "../") {
+		return false
+	}
+
+	if !c.capability() {
+		return nameAllowed(c.Name, basename)
+	}
+
+	for _, scope := range c.Scopes {
+		if strings.HasSuffix(scope, "/") {
+			if nameAllowed(scope, basename) {
+				return true
+			}
+			continue
+		}
+
+		if ok, err := path.Match(scope, basename); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// boundTo checks that the client showed the certificate the token is bound to
+func (c *FileClaim) boundTo(ctx context.Context) error {
+
+	if c.Cnf == nil {
+		return nil
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			sum := sha256.Sum256(info.State.PeerCertificates[0].Raw)
+			if base64.RawURLEncoding.EncodeToString(sum[:]) == c.Cnf.X5t {
+				return nil
+			}
+		}
+	}
+
+	return status.Error(codes.PermissionDenied, "Certificate is bound to another client")
+}
+
+////////
+// Quotas
+////////
+
+// quotaLeft is how many bytes the token may still write here
+func (a *tokenAuth) quotaLeft(id string, quota int64) int64 {
+
+	if a == nil {
+		return 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if left := quota - a.used[id].bytes; left > 0 {
+		return left
+	}
+
+	return 0
+}
+
+// errQuota tells the writer that the token has only left bytes of its quota on the node.
+// It's not ResourceExhausted, the successors count the quota of the token too.
+func errQuota(id string, shardname string, left int64) error {
+	return status.Errorf(codes.PermissionDenied, "Certificate %s has only %d bytes of its quota left for %s", id, left, shardname)
+}
+
+// errOverLimit tells the writer which limit of the token the shard went over
+func (p *Peer) errOverLimit(shardname string, limit int64, tokenString string, claims *FileClaim) error {
+
+	if claims.Quota > 0 {
+		id := tokenID(tokenString, claims)
+		if left := p.auth.quotaLeft(id, claims.Quota); left <= limit {
+			return errQuota(id, shardname, left)
+		}
+	}
+
+	return errTooBig(shardname, limit)
+}
+
+// charge counts bytes written under the token. Writes running at the same time
+// might go over the quota together by at most one shard each.
+func (a *tokenAuth) charge(id string, expires int64, n int64) {
+
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u := a.used[id]
+	a.used[id] = tokenUsage{bytes: u.bytes + n, expires: expires}
+}
+
+// forgetUsage drops what expired tokens wrote, a.mu has to be held
+func (a *tokenAuth) forgetUsage() {
+
+	now := time.Now().Unix()
+	for id, u := range a.used {
+		if u.expires < now {
+			delete(a.used, id)
+		}
+	}
+}
@@ -1,14 +1,16 @@
 package peer
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"math"
 	"os"
 	"regexp"
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type FileClaim struct {
@@ -21,6 +23,19 @@ type FileClaim struct {
 	//Action - 0=read; 1=write; 2=delete
 	Act int8 `json:"act"`
 
+	//Capability tokens cover many files and actions at once, Name and Act are unused then
+	//Actions - same values as Act
+	Acts []int8 `json:"acts,omitempty"`
+
+	//Scopes - namespaces ending with "/" or glob patterns
+	Scopes []string `json:"scopes,omitempty"`
+
+	//Quota - bytes the token may write on one node, 0 for no limit
+	Quota int64 `json:"quota,omitempty"`
+
+	//Confirmation - certificate of the client the token is bound to
+	Cnf *Confirmation `json:"cnf,omitempty"`
+
 	jwt.StandardClaims
 }
 
@@ -35,95 +50,159 @@ type FileValidationResponse struct {
 	Valid bool `json:"status"`
 
 	//Validation message
-	Message string `json:message`
+	Message string `json:"message"`
 }
 
+// getBaseName strips the shard number and the chunk of the C++ client, "file_rep3" and "file_ab_rep3"
+// are shards of "file", "file_manifest" and "file_ab_manifest" are its manifests
 func getBaseName(fname string) (string, error) {
-	pattern, err := regexp.Compile("((_[[:lower:]]*)?(_rep[[:digit:]]+))?$")
+	return stripSuffix(fname, "(_[[:lower:]]*)?(_rep[[:digit:]]+|"+manifestSuffix+")$")
+}
+
+// getChunkName strips only the shard number, "file_ab_rep3" is a shard of "file_ab"
+func getChunkName(fname string) (string, error) {
+	return stripSuffix(fname, "(_rep[[:digit:]]+|"+manifestSuffix+")$")
+}
+
+func stripSuffix(fname string, suffix string) (string, error) {
+	pattern, err := regexp.Compile(suffix)
 	if err != nil {
 		return "", err
 	}
 
-	indices := pattern.FindAllStringIndex(fname, -1)
+	indices := pattern.FindStringIndex(fname)
 	if indices == nil {
 		return fname, nil
 	}
 
-	suff_begin := indices[len(indices)-1][0]
-	return fname[:suff_begin], nil
+	return fname[:indices[0]], nil
 }
 
-// DecodeCertificate decodes the tokenString without validating the signature
-func decodeCertificate(tokenString string) (int64, string, int8, error) {
-	var claims_class jwt.Claims = &FileClaim{}
-	parser := jwt.Parser{SkipClaimsValidation: true}
-	token, _, err := parser.ParseUnverified(tokenString, claims_class)
-
-	if err != nil {
-		return -1, "", -1, err
+// nameAllowed checks the name in the certificate against the file. Name ending with "*" covers
+// every file starting with it, name ending with "/" covers the files of that namespace.
+func nameAllowed(certName string, basename string) bool {
+
+	switch {
+	case certName == "" || certName == "*":
+		// Certificate for everything is as good as no certificate
+		return false
+	case strings.HasSuffix(certName, "*"):
+		return strings.HasPrefix(basename, strings.TrimSuffix(certName, "*"))
+	case strings.HasSuffix(certName, "/"):
+		return strings.HasPrefix(basename, certName) && len(basename) > len(certName)
 	}
 
-	claims := token.Claims.(*FileClaim)
-
-	return claims.Size, claims.Name, claims.Act, nil
+	return certName == basename
 }
 
-func validateCertificate(tokenString string) error {
+// shardLimit is how many bytes a certificate for a file of size bytes allows for the shard.
+// Erasure coded shards are a dataRSC'th of the file, rounded up. Size is of the plain file,
+// encrypted one may take its tags on top.
+func shardLimit(shardname string, basename string, size int64) int64 {
 
-	responseRaw, err := http.Post("http://172.104.136.183/auth/node/action", "text/plain", strings.NewReader(tokenString))
-	if err != nil {
-		return err
+	if strings.HasSuffix(shardname, manifestSuffix) && shardname != basename {
+		// Manifests of chunks are manifests as well
+		return maxManifestSize
 	}
 
-	responseParsed := FileValidationResponse{}
-	jsonDec := json.NewDecoder(responseRaw.Body)
-	jsonDec.Decode(&responseParsed)
-
-	if !responseParsed.Valid {
-		return fmt.Errorf("Certificate invalidated by server, msg=%s", responseParsed.Message)
+	size = EncryptedSize(size)
+	if shardname == basename {
+		return size
 	}
 
-	return nil
+	return (size + dataRSC - 1) / dataRSC
 }
 
-func ValidateFile(shardname string, tokenString string, action int8) error {
+// errTooBig tells the writer that the shard outgrew its certificate
+func errTooBig(shardname string, limit int64) error {
+	return status.Errorf(codes.ResourceExhausted, "Certificate allows only %d bytes for %s", limit, shardname)
+}
+
+// ValidateFile checks the token of a request against the keys of the node.
+// Returns the claims and how many bytes the token allows for the shard.
+func (p *Peer) ValidateFile(ctx context.Context, shardname string, fpath string, tokenString string, action int8) (*FileClaim, int64, error) {
+
+	// Counts of blocks are kept by the nodes themselves
+	if isRefs(shardname) {
+		return nil, 0, status.Errorf(codes.InvalidArgument, "%s is not a shard", shardname)
+	}
 
-	_, err := getBaseName(shardname)
+	basename, err := getBaseName(shardname)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	fsize_cert, _, action_cert, err := decodeCertificate(tokenString)
+	claims, err := p.keys.verify(ctx, tokenString)
 	if err != nil {
-		return err
+		return nil, 0, status.Errorf(codes.Unauthenticated, "invalid certificate: %v", err)
+	}
+
+	// Files whose names end like chunks ("my_file") are covered by their own tokens too
+	if chunk, err := getChunkName(shardname); err == nil && chunk != basename {
+		if _, name := splitNamespace(chunk); claims.covers(name) {
+			basename = chunk
+		}
+	}
+
+	// Users see only their own namespace, names in the token are relative to it.
+	// Plain names don't tell whose file it is, so tokens of users only read them.
+	owner, name := splitNamespace(basename)
+	legacy := p.legacyNames && owner == "" && action == READACT
+	if !validOwner(claims.Subject) || (owner != claims.Subject && !legacy) {
+		return nil, 0, status.Errorf(codes.PermissionDenied, "%s is out of the namespace of the certificate", basename)
+	}
+
+	// Deleting needs the manifest, it tells which blocks the file refers to
+	deleting := action == READACT && strings.HasSuffix(shardname, manifestSuffix) && claims.allows(DELEACT)
+	if !claims.allows(action) && !deleting {
+		return nil, 0, status.Errorf(codes.PermissionDenied, "Certificate doesn't allow action %d", action)
+	}
+	if !claims.covers(name) {
+		return nil, 0, status.Errorf(codes.PermissionDenied, "Certificate doesn't cover %s", name)
+	}
+	if err := claims.boundTo(ctx); err != nil {
+		return nil, 0, err
 	}
 
-	if action_cert != action {
-		return fmt.Errorf("Actions in certificate and request don't match: %d != %d", action_cert, action)
+	// Capability tokens might not limit the size of files
+	limit := int64(math.MaxInt64)
+	if !claims.capability() || claims.Size > 0 {
+		limit = shardLimit(shardname, basename, claims.Size)
 	}
-	/*if basename_cert != basename {
-		return fmt.Errorf("Certificate name doesn't match request name: %s != %s", basename_cert, basename)
-	}*/
 
-	// No need to check filesize when writing (server does it for us)
+	// Shard isn't there yet, writer counts the bytes instead. The server is asked only
+	// about reads and deletes, but revoked tokens don't write either.
 	if action == WRITACT {
-		return nil
+		if err := p.auth.notRevoked(tokenString, claims); err != nil {
+			return nil, 0, err
+		}
+		if claims.Quota > 0 {
+			id := tokenID(tokenString, claims)
+			left := p.auth.quotaLeft(id, claims.Quota)
+			if left == 0 {
+				return nil, 0, errQuota(id, shardname, 0)
+			}
+			if left < limit {
+				limit = left
+			}
+		}
+		return claims, limit, nil
 	}
 
 	// Check file size
-	fi, err := os.Stat(shardname)
+	fi, err := os.Stat(fpath)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
 	fsize := fi.Size()
-	if fsize > fsize_cert {
-		return fmt.Errorf("Certificate file size doesn't match: %d != %d", fsize_cert, fsize)
+	if fsize > limit {
+		return nil, 0, fmt.Errorf("Certificate file size doesn't match: %d != %d", limit, fsize)
 	}
 
-	if err := validateCertificate(tokenString); err != nil {
-		return err
+	if err := p.auth.check(tokenString, claims, action); err != nil {
+		return nil, 0, err
 	}
 
-	return nil
+	return claims, limit, nil
 }
@@ -0,0 +1,148 @@
+// Client side compression, stripes of the file are compressed before erasure coding
+package peer
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithms files can be compressed with
+const (
+	CompressZstd = "zstd"
+	CompressS2   = "s2"
+)
+
+// Coders are safe to share, EncodeAll and DecodeAll don't keep state between calls
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(stripeSize))
+)
+
+func compressStripe(algorithm string, stripe []byte) ([]byte, error) {
+
+	switch algorithm {
+	case CompressZstd:
+		return zstdEncoder.EncodeAll(stripe, nil), nil
+	case CompressS2:
+		return s2.Encode(nil, stripe), nil
+	}
+
+	return nil, fmt.Errorf("unknown compression %s", algorithm)
+}
+
+func decompressStripe(algorithm string, packed []byte, size int) ([]byte, error) {
+
+	var stripe []byte
+	var err error
+
+	switch algorithm {
+	case CompressZstd:
+		stripe, err = zstdDecoder.DecodeAll(packed, make([]byte, 0, size))
+	case CompressS2:
+		// Length is in the header, don't allocate what the stripe can't be
+		var n int
+		if n, err = s2.DecodedLen(packed); err == nil && n != size {
+			return nil, fmt.Errorf("stripe has %d bytes, %d expected", n, size)
+		}
+		if err == nil {
+			stripe, err = s2.Decode(nil, packed)
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression %s", algorithm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if len(stripe) != size {
+		return nil, fmt.Errorf("stripe has %d bytes, %d expected", len(stripe), size)
+	}
+
+	return stripe, nil
+}
+
+// compress compresses the content stripe by stripe. Stripes that don't shrink are kept
+// as they are, when none shrinks the content is left alone and the manifest says nothing.
+func compress(algorithm string, m *manifest, content []byte) ([]byte, error) {
+
+	packed := make([]byte, 0, len(content))
+	frames := make([]int, 0, (len(content)+stripeSize-1)/stripeSize)
+	shrunk := false
+
+	for i := 0; i*stripeSize < len(content); i++ {
+		end := (i + 1) * stripeSize
+		if end > len(content) {
+			end = len(content)
+		}
+		stripe := content[i*stripeSize : end]
+
+		c, err := compressStripe(algorithm, stripe)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(c) >= len(stripe) {
+			packed = append(packed, stripe...)
+			frames = append(frames, 0)
+			continue
+		}
+
+		packed = append(packed, c...)
+		frames = append(frames, len(c))
+		shrunk = true
+	}
+
+	if !shrunk {
+		return content, nil
+	}
+
+	m.Compression = algorithm
+	m.Frame = stripeSize
+	m.Frames = frames
+
+	return packed, nil
+}
+
+// decompress undoes compress, m.Size bytes come out or an error
+func decompress(m manifest, packed []byte) ([]byte, error) {
+
+	if m.Frame <= 0 || int64(len(m.Frames)) != (m.Size+int64(m.Frame)-1)/int64(m.Frame) {
+		return nil, fmt.Errorf("manifest has wrong frames for %s", m.Compression)
+	}
+
+	content := make([]byte, 0, m.Size)
+	for i, n := range m.Frames {
+		size := m.Frame
+		if left := m.Size - int64(len(content)); left < int64(size) {
+			size = int(left)
+		}
+
+		// Raw stripes are stored whole
+		raw := n == 0
+		if raw {
+			n = size
+		}
+		if n < 0 || n > len(packed) {
+			return nil, fmt.Errorf("stripe %d is cut short", i)
+		}
+
+		if raw {
+			content = append(content, packed[:n]...)
+		} else {
+			stripe, err := decompressStripe(m.Compression, packed[:n], size)
+			if err != nil {
+				return nil, fmt.Errorf("stripe %d is damaged: %v", i, err)
+			}
+			content = append(content, stripe...)
+		}
+		packed = packed[n:]
+	}
+
+	if len(packed) != 0 {
+		return nil, fmt.Errorf("%d bytes after the last stripe", len(packed))
+	}
+
+	return content, nil
+}
@@ -0,0 +1,177 @@
+// Client side encryption, nodes only ever see ciphertext
+package peer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Cipher of the files, the only one so far
+const cipherAESGCM = "AES-256-GCM"
+
+// Bytes of the file sealed together, each stripe gets its own tag
+const stripeSize = 64 << 10
+
+// Tag of AES-GCM
+const sealOverhead = 16
+
+// Secrets shorter than this are too easy to guess
+const minSecretSize = 16
+
+// Key is the secret of the user, keys of files are derived from it
+type Key struct {
+	secret []byte
+}
+
+// NewKey makes a key from the secret of the user
+func NewKey(secret []byte) (*Key, error) {
+
+	if len(secret) < minSecretSize {
+		return nil, fmt.Errorf("secret has to be at least %d bytes", minSecretSize)
+	}
+
+	return &Key{secret: append([]byte(nil), secret...)}, nil
+}
+
+// EncryptedSize is how many bytes a file of size bytes takes once encrypted, nodes allow
+// that much for certificates of size bytes
+func EncryptedSize(size int64) int64 {
+	return size + (size+stripeSize-1)/stripeSize*sealOverhead
+}
+
+// HiddenName is the name the file is stored under when names are hidden. It tells nothing
+// about the name without the key, certificates for the file have to be issued for it.
+func HiddenName(k *Key, fname string) string {
+	return hex.EncodeToString(k.derive("file name", []byte(fname)))
+}
+
+// derive makes a key for one purpose from the secret
+func (k *Key) derive(purpose string, salt []byte) []byte {
+
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(purpose))
+	mac.Write(salt)
+
+	return mac.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// manifestData binds the wrapped key to the file and to what the manifest says about it
+func manifestData(fname string, m *manifest) []byte {
+
+	data := fmt.Sprintf("%s|%s|%d|%d|%d", fname, m.Cipher, m.Stripe, m.Size, m.Stored)
+	if m.Compression != "" {
+		data += fmt.Sprintf("|%s|%d|%v", m.Compression, m.Frame, m.Frames)
+	}
+
+	return []byte(data)
+}
+
+// stripeNonce is the number of the stripe, every file has its own key so they never repeat
+func stripeNonce(aead cipher.AEAD, i int) []byte {
+
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(i))
+
+	return nonce
+}
+
+// seal encrypts the content with a new file key and wraps it into the manifest
+func (k *Key) seal(fname string, m *manifest, content []byte) ([]byte, error) {
+
+	fileKey := make([]byte, 32)
+	salt := make([]byte, 16)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, EncryptedSize(int64(len(content))))
+	for i := 0; i*stripeSize < len(content); i++ {
+		end := (i + 1) * stripeSize
+		if end > len(content) {
+			end = len(content)
+		}
+		sealed = aead.Seal(sealed, stripeNonce(aead, i), content[i*stripeSize:end], nil)
+	}
+
+	m.Cipher = cipherAESGCM
+	m.Stripe = stripeSize
+	m.Salt = salt
+	m.Stored = int64(len(sealed))
+
+	wrap, err := newGCM(k.derive("file key", salt))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, wrap.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	m.WrappedKey = wrap.Seal(nonce, nonce, fileKey, manifestData(fname, m))
+
+	return sealed, nil
+}
+
+// open unwraps the file key and decrypts the content
+func (k *Key) open(fname string, m manifest, sealed []byte) ([]byte, error) {
+
+	if m.Cipher != cipherAESGCM || m.Stripe <= 0 {
+		return nil, fmt.Errorf("unknown cipher %s", m.Cipher)
+	}
+
+	wrap, err := newGCM(k.derive("file key", m.Salt))
+	if err != nil {
+		return nil, err
+	}
+	if len(m.WrappedKey) < wrap.NonceSize() {
+		return nil, errors.New("manifest has no file key")
+	}
+	nonce, wrapped := m.WrappedKey[:wrap.NonceSize()], m.WrappedKey[wrap.NonceSize():]
+	fileKey, err := wrap.Open(nil, nonce, wrapped, manifestData(fname, &m))
+	if err != nil {
+		return nil, errors.New("wrong key or damaged manifest")
+	}
+
+	aead, err := newGCM(fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, 0, len(sealed))
+	stripe := m.Stripe + aead.Overhead()
+	for i := 0; i*stripe < len(sealed); i++ {
+		end := (i + 1) * stripe
+		if end > len(sealed) {
+			end = len(sealed)
+		}
+		if content, err = aead.Open(content, stripeNonce(aead, i), sealed[i*stripe:end], nil); err != nil {
+			return nil, fmt.Errorf("stripe %d of %s is damaged", i, fname)
+		}
+	}
+
+	return content, nil
+}
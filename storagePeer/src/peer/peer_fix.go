@@ -8,24 +8,25 @@ import (
   "encoding/json"
 )
 
-func (p *Peer) fixRoutine() error {
-	const MAX_FILESIZE = 4096 * 1600 / 8
-	filecont := make([]byte, MAX_FILESIZE)
-	selfIP, ringsz := p.ring.RingInfo()
-
-	for {
-		newFile := <-p.ring.NewFilesChannel
-		readCertificate := "miha.day.sertificat.pochitat"
-		empty, err := DownloadFileRSC(selfIP, newFile, ringsz, filecont, readCertificate)
-		if err != nil {
-			return err
+func (p *Peer) fixRoutine() {
+
+	// Previous owner pushes the data itself (see handoffKeys), so just keep track of new keys
+	go func() {
+		for newFile := range p.ring.NewFilesChannel {
+			fmt.Printf("%s is now responsible for %s\n", p.ownIP, newFile)
 		}
+	}()
 
-		writeCertificate := "miha.day.sertificat.popisat"
-		err = UploadFileRSC(selfIP, newFile, ringsz, filecont[:MAX_FILESIZE-empty], writeCertificate)
-		if err != nil {
-			return err
+	// Nobody will push the data of dead nodes, use our replicas instead
+	go func() {
+		for key := range p.ring.InheritedChannel {
+			p.promoteReplica(key)
 		}
+	}()
+
+	// Move the data behind the keys we gave away
+	for transfer := range p.ring.TransferChannel {
+		p.handoffKeys(transfer.IP, transfer.Keys)
 	}
 }
 
@@ -0,0 +1,307 @@
+// Moving shards to the node that became responsible for them
+package peer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const handoffChunkSize = 64 * 1024
+const handoffAttempts = 5
+
+// Incoming shard is kept here until all of its bytes arrive
+func handoffPartName(fname string) string {
+	return fname + ".handoff"
+}
+
+////////
+// Node to node shard streams (used by handoff and replication)
+////////
+
+type shardReceiver interface {
+	Recv() (*HandoffRequest, error)
+}
+
+type shardSender interface {
+	Send(*HandoffRequest) error
+	CloseAndRecv() (*HandoffReply, error)
+}
+
+// receiveShard appends the data of the stream (starting with info) to f and returns how many bytes were written
+func receiveShard(stream shardReceiver, info *HandoffRequest, f *os.File) (int64, error) {
+
+	writer := bufio.NewWriter(f)
+
+	n, err := writer.Write(info.Data)
+	if err != nil {
+		return 0, err
+	}
+	received := int64(n)
+
+	for {
+		chunk, readErr := stream.Recv()
+
+		if readErr == io.EOF {
+			break
+		}
+
+		if readErr != nil {
+			// Keep what we've got so the next attempt can resume
+			writer.Flush()
+			return received, readErr
+		}
+
+		n, err := writer.Write(chunk.Data)
+		if err != nil {
+			return received, err
+		}
+		received += int64(n)
+	}
+
+	return received, writer.Flush()
+}
+
+// sendShard streams local file fname (from offset) under the name shardName
+func sendShard(stream shardSender, fname string, shardName string, offset int64) (*HandoffReply, error) {
+
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if err = stream.Send(&HandoffRequest{Name: shardName, Offset: offset, Size: fi.Size()}); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(f)
+	b := make([]byte, handoffChunkSize)
+
+	for {
+		n, readErr := reader.Read(b)
+
+		if n > 0 {
+			if err := stream.Send(&HandoffRequest{Data: b[:n]}); err != nil {
+				return nil, err
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	reply, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+
+	if !reply.Complete {
+		return reply, fmt.Errorf("transfer of %s stopped at %d of %d bytes", shardName, reply.Received, fi.Size())
+	}
+
+	return reply, nil
+}
+
+////////
+// Receiving side
+////////
+
+// HandoffOffset tells the previous owner how much of the shard we already have
+func (p *Peer) HandoffOffset(ctx context.Context, r *HandoffOffsetRequest) (*HandoffOffsetReply, error) {
+
+	if !validKey(r.Name) {
+		return nil, status.Errorf(codes.InvalidArgument, "%q is not a shard name", r.Name)
+	}
+	if err := p.ring.VerifyGiver(ctx, strings.TrimSuffix(r.Name, refsSuffix)); err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(p.path(handoffPartName(r.Name)))
+	if os.IsNotExist(err) {
+		return &HandoffOffsetReply{Offset: 0}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &HandoffOffsetReply{Offset: fi.Size()}, nil
+}
+
+// Handoff receives a shard from its previous owner. The first message describes the shard,
+// data is appended to whatever was received during previous attempts.
+func (p *Peer) Handoff(stream PeerService_HandoffServer) error {
+
+	info, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	// Ring has to give us the key before the data arrives, counts of blocks come after their shards.
+	// Only the node that gave it to us has the data.
+	key := strings.TrimSuffix(info.Name, refsSuffix)
+	if !validKey(info.Name) {
+		return status.Errorf(codes.InvalidArgument, "%q is not a shard name", info.Name)
+	}
+	if !p.ring.HasKey(key) {
+		return status.Errorf(codes.FailedPrecondition, "%s is not in the key list of %s", info.Name, p.ownIP)
+	}
+	if err := p.ring.VerifyGiver(stream.Context(), key); err != nil {
+		return err
+	}
+
+	partName := p.path(handoffPartName(info.Name))
+	defer p.track(partName, p.path(info.Name))()
+
+	var have int64
+	if fi, err := os.Stat(partName); err == nil {
+		have = fi.Size()
+	}
+	if info.Offset != have {
+		return status.Errorf(codes.Aborted, "handoff of %s has to resume from %d, not %d", info.Name, have, info.Offset)
+	}
+
+	// Received part is already counted, complete shard replaces the one we had
+	need := info.Size - have - fileSize(p.path(info.Name))
+	if !p.store.fits(need) {
+		return p.errFull(need)
+	}
+
+	if err := makeParent(partName); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(partName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	n, err := receiveShard(stream, info, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	received := info.Offset + n
+	complete := received == info.Size
+	if complete {
+		if err = os.Rename(partName, p.path(info.Name)); err != nil {
+			return err
+		}
+		if isRefs(info.Name) {
+			return stream.SendAndClose(&HandoffReply{Received: received, Complete: complete})
+		}
+
+		if digest, err := fileDigest(p.path(info.Name)); err == nil {
+			p.ring.SetKeyDigest(info.Name, digest)
+		}
+
+		// We are the owner now, so our successors have to keep the copies
+		go p.replicate(info.Name)
+	}
+
+	return stream.SendAndClose(&HandoffReply{Received: received, Complete: complete})
+}
+
+////////
+// Sending side
+////////
+
+// handoffFile streams local file fpath as shard fname to targetIP starting from what target already has
+func handoffFile(targetIP string, fpath string, fname string) error {
+
+	cl, release, err := Connect(targetIP)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	offsetReply, err := cl.HandoffOffset(context.Background(), &HandoffOffsetRequest{Name: fname})
+	if err != nil {
+		return err
+	}
+
+	hstream, err := cl.Handoff(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if _, err = sendShard(hstream, fpath, fname, offsetReply.Offset); err != nil || isRefs(fname) {
+		return err
+	}
+
+	// Count is small, it goes whole after the shard
+	if _, err := os.Stat(refsName(fpath)); os.IsNotExist(err) {
+		return nil
+	}
+	return handoffFile(targetIP, refsName(fpath), refsName(fname))
+}
+
+// handoffKeys moves the data behind keys that were given to another node
+func (p *Peer) handoffKeys(targetIP string, keys []string) {
+
+	for _, key := range keys {
+
+		// Nothing to move if we never had the data
+		if _, err := os.Stat(p.path(key)); os.IsNotExist(err) {
+			continue
+		}
+
+		var err error
+		for i := 0; i < handoffAttempts; i++ {
+			if err = handoffFile(targetIP, p.path(key), key); err == nil {
+				break
+			}
+
+			fmt.Println(err.Error())
+			fmt.Printf("Couldn't hand off %s to %s, attempt %d\n", key, targetIP, i+1)
+			time.Sleep(time.Second * 1)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		// Target confirmed that it has everything. If the new owner is our predecessor, we are
+		// its first successor and keep the copy as a replica. Other owners have their own successors.
+		untrack := p.track(p.path(key), p.path(replicaName(key)), p.path(refsName(key)), p.path(refsName(replicaName(key))))
+		if p.replicas > 0 && targetIP == p.ring.Predecessor() {
+			if err = makeParent(p.path(replicaName(key))); err == nil {
+				err = os.Rename(p.path(key), p.path(replicaName(key)))
+			}
+			if err == nil {
+				err = moveRefs(p.path(key), p.path(replicaName(key)))
+			}
+			p.ring.SaveReplicaKey(key)
+		} else {
+			os.Remove(p.path(refsName(key)))
+			err = os.Remove(p.path(key))
+		}
+		untrack()
+
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Public keys that sign tokens, so nodes check them without asking the server
+package peer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// How often keys are reloaded, so rotated ones are picked up
+const jwksRefresh = 5 * time.Minute
+
+// Token with an unknown key makes us reload the keys, but not more often than this
+const jwksMinReload = 30 * time.Second
+
+// Keys may be reloaded while a request waits, the server can't hold it for long
+const jwksTimeout = 5 * time.Second
+
+var jwksClient = &http.Client{Timeout: jwksTimeout}
+
+// Algorithms tokens can be signed with
+var tokenMethods = []string{"RS256", "EdDSA"}
+
+////////
+// EdDSA
+////////
+
+type signingMethodEdDSA struct{}
+
+// SigningMethodEdDSA signs tokens with Ed25519 keys, jwt-go doesn't have it
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Verify(signingString string, signature string, key interface{}) error {
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(priv, []byte(signingString))), nil
+}
+
+////////
+// JWKS
+////////
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"` // RSA
+	E   string `json:"e"`
+	Crv string `json:"crv"` // Ed25519
+	X   string `json:"x"`
+}
+
+// keySet keeps the keys from a JWKS file or endpoint by their id
+type keySet struct {
+	source   string
+	keys     atomic.Value // map[string]interface{}
+	loadedAt int64        // Unix nanoseconds
+}
+
+// newKeySet loads the keys from source, a file path or an http(s) URL
+func newKeySet(source string) (*keySet, error) {
+
+	ks := &keySet{source: source}
+	if err := ks.reload(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+func (ks *keySet) reload(ctx context.Context) error {
+
+	atomic.StoreInt64(&ks.loadedAt, time.Now().UnixNano())
+
+	data, err := readSource(ctx, ks.source)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("key %q in %s: %v", k.Kid, ks.source, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	ks.keys.Store(keys)
+	return nil
+}
+
+// readSource reads a file or, for http(s) URLs, the answer of the server
+func readSource(ctx context.Context, source string) ([]byte, error) {
+
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", source, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (ks *keySet) refreshRoutine() {
+
+	for {
+		time.Sleep(jwksRefresh)
+
+		if err := ks.reload(context.Background()); err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+
+	switch {
+	case k.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("wrong size of Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s %s", k.Kty, k.Crv)
+}
+
+// key finds the key that signed the token. Unknown key id might mean that keys were rotated,
+// they are reloaded within the request ctx.
+func (ks *keySet) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := ks.keys.Load().(map[string]interface{})[kid]
+	if !ok && time.Since(time.Unix(0, atomic.LoadInt64(&ks.loadedAt))) > jwksMinReload {
+		if err := ks.reload(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = ks.keys.Load().(map[string]interface{})[kid]
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	return key, nil
+}
+
+// verify checks signature, expiry and start of the token
+func (ks *keySet) verify(ctx context.Context, tokenString string) (*FileClaim, error) {
+
+	if ks == nil {
+		return nil, errors.New("node has no keys to verify tokens")
+	}
+
+	claims := &FileClaim{}
+	parser := jwt.Parser{ValidMethods: tokenMethods}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		return ks.key(ctx, token)
+	}
+	if _, err := parser.ParseWithClaims(tokenString, claims, keyFunc); err != nil {
+		return nil, err
+	}
+
+	// Valid forever is too long
+	if claims.ExpiresAt == 0 {
+		return nil, errors.New("token has no expiry")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,243 @@
+// Manifests describe how the client turned the file into what is stored on the ring
+package peer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Manifest is kept next to the shards of the file
+const manifestSuffix = "_manifest"
+
+// Any certificate allows this much for the manifest, whatever the size of the file
+const maxManifestSize = 1 << 20
+
+// ErrEncrypted is returned when the file is downloaded without the key it was encrypted with
+var ErrEncrypted = errors.New("file is encrypted, key is needed")
+
+// Options of the client side processing of files. Zero options store the file as it is.
+type Options struct {
+	Key      *Key   // Encrypts the content before erasure coding
+	HideName bool   // Stores the file under HiddenName, needs Key
+	Compress string // CompressZstd or CompressS2, compresses before encryption
+
+	// Stores the file in blocks named by their hashes, so files with the same blocks share them.
+	// Tokens have to cover the blocks of the namespace too, encrypted files share nothing.
+	Dedup bool
+}
+
+// storedName is the key of the file on the ring
+func (o Options) storedName(fname string, certificate string) (string, error) {
+
+	fname, err := o.plainName(fname)
+	if err != nil {
+		return "", err
+	}
+
+	// Same names of different users are different files
+	return nsKey(tokenOwner(certificate), fname), nil
+}
+
+// plainName is the key of the file outside of namespaces, files stored before them have it
+func (o Options) plainName(fname string) (string, error) {
+
+	if o.HideName {
+		if o.Key == nil {
+			return "", errors.New("hiding names needs a key")
+		}
+		fname = HiddenName(o.Key, fname)
+	}
+
+	return fname, nil
+}
+
+type manifest struct {
+	Size   int64 `json:"size"`   // Bytes of the file
+	Stored int64 `json:"stored"` // Bytes that were erasure coded
+
+	// Encryption, empty for plain files
+	Cipher     string `json:"cipher,omitempty"`
+	Stripe     int    `json:"stripe,omitempty"` // Bytes of the file sealed together
+	Salt       []byte `json:"salt,omitempty"`   // Salt of the key that wraps the file key
+	WrappedKey []byte `json:"key,omitempty"`
+
+	// Compression, empty when the file didn't shrink
+	Compression string `json:"compression,omitempty"`
+	Frame       int    `json:"frame,omitempty"`  // Bytes of the file compressed together
+	Frames      []int  `json:"frames,omitempty"` // Compressed size of each, 0 for raw ones
+
+	// Deduplication, files without blocks are erasure coded under their own name
+	BlockSize int      `json:"block,omitempty"`
+	Blocks    []string `json:"blocks,omitempty"` // Hashes of the stored bytes, block by block
+}
+
+func manifestName(fname string) string {
+	return fname + manifestSuffix
+}
+
+// UploadFileWithOptions processes the file as the options say, erasure codes it and uploads
+// the shards and the manifest
+func UploadFileWithOptions(ringIP string, fname string, fcontent []byte, certificate string, opts Options) error {
+
+	fname, err := opts.storedName(fname, certificate)
+	if err != nil {
+		return err
+	}
+
+	m := manifest{Size: int64(len(fcontent))}
+	data := fcontent
+
+	if opts.Compress != "" {
+		if data, err = compress(opts.Compress, &m, data); err != nil {
+			return err
+		}
+	}
+
+	if opts.Key != nil {
+		if data, err = opts.Key.seal(fname, &m, data); err != nil {
+			return err
+		}
+	}
+	m.Stored = int64(len(data))
+
+	if opts.Dedup {
+		return uploadDedup(ringIP, fname, data, certificate, m)
+	}
+
+	if err = uploadRSC(ringIP, fname, data, certificate); err != nil {
+		return err
+	}
+
+	return uploadManifest(ringIP, fname, m, certificate)
+}
+
+// uploadDedup stores the content in blocks and lets go of the blocks of the file it replaces
+func uploadDedup(ringIP string, fname string, data []byte, certificate string, m manifest) error {
+
+	// Tokens that can't read the old manifest leave its blocks referenced, which wastes space but loses nothing
+	old, err := downloadManifest(ringIP, fname, certificate)
+	if err != nil {
+		old = manifest{}
+	}
+
+	owner := tokenOwner(certificate)
+	if err = uploadBlocks(ringIP, owner, data, certificate, &m); err != nil {
+		return err
+	}
+	if err = uploadManifest(ringIP, fname, m, certificate); err != nil {
+		return err
+	}
+
+	// New blocks are referenced already, so the shared ones stay
+	if err = releaseBlocks(ringIP, owner, old.Blocks, certificate); err != nil {
+		fmt.Println(err.Error())
+	}
+
+	return nil
+}
+
+func uploadManifest(ringIP string, fname string, m manifest, certificate string) error {
+
+	// Manifest goes last, so the file can't be read before all of it is there
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return uploadFile(ringIP, manifestName(fname), raw, certificate)
+}
+
+// DownloadFileWithOptions downloads the file into fcontent and undoes what was done to it
+// on upload. Files uploaded before manifests are read as they are, files uploaded before
+// namespaces are looked for under their plain names.
+func DownloadFileWithOptions(ringIP string, fname string, fcontent []byte, certificate string, opts Options) (int, error) {
+
+	stored, err := opts.storedName(fname, certificate)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := downloadStored(ringIP, stored, fcontent, certificate, opts)
+	if plain, _ := opts.plainName(fname); os.IsNotExist(err) && plain != stored {
+		return downloadStored(ringIP, plain, fcontent, certificate, opts)
+	}
+
+	return n, err
+}
+
+// downloadStored downloads the file stored under the key fname
+func downloadStored(ringIP string, fname string, fcontent []byte, certificate string, opts Options) (int, error) {
+
+	m, err := downloadManifest(ringIP, fname, certificate)
+	if os.IsNotExist(err) {
+		return downloadRSC(ringIP, fname, fcontent, certificate)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if m.Size > int64(len(fcontent)) {
+		return 0, fmt.Errorf("Not enough space in buffer")
+	}
+	if m.Stored < 0 || m.Stored > EncryptedSize(m.Size) {
+		return 0, fmt.Errorf("manifest of %s is damaged", fname)
+	}
+
+	var data []byte
+	if m.BlockSize > 0 {
+		// Blocks are in the namespace of the file, plain names have theirs outside of namespaces
+		owner, _ := splitNamespace(fname)
+		if data, err = downloadBlocks(ringIP, owner, m, certificate); err != nil {
+			return 0, err
+		}
+	} else {
+		// Every shard has to fit, parity ones too
+		shardLen := (m.Stored + dataRSC - 1) / dataRSC
+		buf := make([]byte, (dataRSC+parityRSC)*shardLen)
+		if _, err = downloadRSC(ringIP, fname, buf, certificate); err != nil {
+			return 0, err
+		}
+		data = buf[:m.Stored]
+	}
+
+	if m.Cipher != "" {
+		if opts.Key == nil {
+			return 0, ErrEncrypted
+		}
+		if data, err = opts.Key.open(fname, m, data); err != nil {
+			return 0, err
+		}
+	}
+
+	if m.Compression != "" {
+		if data, err = decompress(m, data); err != nil {
+			return 0, fmt.Errorf("%s: %v", fname, err)
+		}
+	}
+
+	if int64(len(data)) != m.Size {
+		return 0, fmt.Errorf("%s has %d bytes, manifest says %d", fname, len(data), m.Size)
+	}
+
+	copy(fcontent, data)
+	return 0, nil
+}
+
+func downloadManifest(ringIP string, fname string, certificate string) (manifest, error) {
+
+	m := manifest{}
+
+	buf := make([]byte, maxManifestSize)
+	empty, err := downloadFile(ringIP, manifestName(fname), buf, certificate)
+	if err != nil {
+		return m, err
+	}
+	if empty < 0 {
+		return m, fmt.Errorf("manifest of %s is too big", fname)
+	}
+
+	err = json.Unmarshal(buf[:len(buf)-empty], &m)
+	return m, err
+}
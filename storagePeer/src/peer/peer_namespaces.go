@@ -0,0 +1,53 @@
+// Namespaces of users, so their files don't collide on the ring. Files stored before namespaces
+// keep their plain names, clients look there when the node runs with LegacyNames.
+package peer
+
+import (
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Keys of namespaced files look like "@owner/name"
+const nsPrefix = "@"
+
+// nsKey is the key of the file of owner, files of tokens without an owner keep their names
+func nsKey(owner string, fname string) string {
+
+	if owner == "" {
+		return fname
+	}
+
+	return nsPrefix + owner + "/" + fname
+}
+
+// splitNamespace returns the owner of the key and the name of the file in its namespace
+func splitNamespace(key string) (string, string) {
+
+	if !strings.HasPrefix(key, nsPrefix) {
+		return "", key
+	}
+
+	i := strings.Index(key, "/")
+	if i <= len(nsPrefix) {
+		return "", key
+	}
+
+	return key[len(nsPrefix):i], key[i+1:]
+}
+
+// validOwner tells if the owner can be a namespace, the key has to split back into it
+func validOwner(owner string) bool {
+	return !strings.Contains(owner, "/")
+}
+
+// tokenOwner reads the owner from the token of the client, nodes check the signature
+func tokenOwner(certificate string) string {
+
+	claims := &FileClaim{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(certificate, claims); err != nil {
+		return ""
+	}
+
+	return claims.Subject
+}
@@ -0,0 +1,80 @@
+// Storage quota of the node, shared by all of its positions on the ring
+package peer
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type storage struct {
+	capacity int64 // 0 means no limit
+	used     int64
+}
+
+// fits checks that size more bytes can be stored
+func (s *storage) fits(size int64) bool {
+	return s.capacity == 0 || atomic.LoadInt64(&s.used)+size <= s.capacity
+}
+
+func (s *storage) add(delta int64) {
+	atomic.AddInt64(&s.used, delta)
+}
+
+func (s *storage) usage() int64 {
+	return atomic.LoadInt64(&s.used)
+}
+
+// errFull is returned to writers over the quota, so they can go to the next successor
+func (p *Peer) errFull(size int64) error {
+	return status.Errorf(codes.ResourceExhausted, "%s is full: %d of %d bytes used, %d more requested",
+		p.ownIP, p.store.usage(), p.store.capacity, size)
+}
+
+// fileSize returns the size of a file, 0 if there is none
+func fileSize(fpath string) int64 {
+
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return 0
+	}
+
+	return fi.Size()
+}
+
+// track remembers sizes of the files, the returned func accounts for their change since then
+func (p *Peer) track(fpaths ...string) func() {
+
+	var before int64
+	for _, fpath := range fpaths {
+		before += fileSize(fpath)
+	}
+
+	return func() {
+		var after int64
+		for _, fpath := range fpaths {
+			after += fileSize(fpath)
+		}
+		p.store.add(after - before)
+	}
+}
+
+// dirSize sums sizes of all files in the data directory
+func dirSize(dir string) (int64, error) {
+
+	var size int64
+	err := filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
@@ -0,0 +1,119 @@
+// Nodes answer for their own range only and send clients to the owner of the rest
+package peer
+
+import (
+	"context"
+	"fmt"
+	"storagePeer/src/dht"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Trailer key with the address of the node responsible for the key
+const ownerKey = "owner"
+
+// How many redirects a client follows before it asks the ring again
+const maxRedirects = 3
+
+// responsible checks that the key falls in (predecessor, self]
+func (p *Peer) responsible(key string) bool {
+
+	start, end := p.ring.Range()
+	return dht.InRange(start, end, dht.Hash([]byte(key)))
+}
+
+// overflow checks that we may keep the key for its owner: we are one of the nodes that follow the
+// owner and the owner itself says it has no room for size more bytes. Reads and deletes pass
+// a negative size, the owner doesn't have to be full for them.
+func (p *Peer) overflow(ctx context.Context, key string, size int64) bool {
+
+	r, _, err := p.ownerRoute(ctx, dht.Hash([]byte(key)))
+	if err != nil || !r.known || r.targets[0] == p.ownIP {
+		return false
+	}
+
+	follows := false
+	for _, ip := range r.targets[1:] {
+		follows = follows || ip == p.ownIP
+	}
+	if !follows || size < 0 {
+		return follows
+	}
+
+	// Clients can't be trusted with that, ask the owner
+	cl, release, err := Connect(r.targets[0])
+	if err != nil {
+		return false
+	}
+	defer release()
+
+	stats, err := cl.Stats(ctx, &StatsRequest{})
+	return err == nil && stats.Capacity > 0 && stats.Used+size > stats.Capacity
+}
+
+// redirect refuses the request, the owner of the key goes to the trailer if we can find it
+func (p *Peer) redirect(key string, setTrailer func(metadata.MD)) error {
+
+	msg := fmt.Sprintf("%s isn't responsible for %s", p.ownIP, key)
+
+	route, err := p.ring.Lookup(dht.Hash([]byte(key)))
+	if err != nil || route.IP == p.ownIP {
+		// Client has to ask the ring itself
+		return status.Error(codes.FailedPrecondition, msg)
+	}
+
+	setTrailer(metadata.Pairs(ownerKey, route.IP))
+	return status.Errorf(codes.FailedPrecondition, "%s, %s is", msg, route.IP)
+}
+
+////////
+// Client side
+////////
+
+type redirectError struct {
+	owner string
+	st    *status.Status
+}
+
+func (e *redirectError) Error() string {
+	return e.st.Err().Error()
+}
+
+// GRPCStatus keeps status.Code working on redirects
+func (e *redirectError) GRPCStatus() *status.Status {
+	return e.st
+}
+
+// redirectOf turns a refusal with the owner in the trailer into a redirect
+func redirectOf(err error, trailer metadata.MD) error {
+
+	owners := trailer.Get(ownerKey)
+	if status.Code(err) != codes.FailedPrecondition || len(owners) == 0 {
+		return err
+	}
+
+	return &redirectError{owner: owners[0], st: status.Convert(err)}
+}
+
+// follow runs op on targetIP and on the nodes it redirects us to. Route to the node
+// that redirected is wrong, so it is dropped from the cache.
+func follow(ringIP string, id dht.ID, targetIP string, op func(ip string) error) error {
+
+	err := op(targetIP)
+	for i := 0; i < maxRedirects; i++ {
+		r, ok := err.(*redirectError)
+		if !ok {
+			return err
+		}
+
+		fmt.Printf("%s redirects to %s\n", targetIP, r.owner)
+		routes.invalidate(ringIP, id)
+
+		targetIP = r.owner
+		err = op(targetIP)
+	}
+
+	return err
+}
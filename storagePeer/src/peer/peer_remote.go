@@ -5,27 +5,62 @@ import (
 	"bufio"
 	"context"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"storagePeer/src/dht"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
+// Shards are written next to their place and take it only when they are complete
+const writeSuffix = ".write"
+
 // Ping generates response to a Ping request
 func (p *Peer) Ping(ctx context.Context, in *PingMessage) (*PingMessage, error) {
 	log.Printf("Receive message %t", in.Ok)
 	return &PingMessage{Ok: true}, nil
 }
 
-// FindSuccessorInRing finds id's successor in p's ring
+// FindSuccessorInRing finds id's successor in p's ring together with the nodes that follow it
 func (p *Peer) FindSuccessorInRing(ctx context.Context, r *FindSuccRequest) (*FindSuccReply, error) {
-	ip, err := p.ring.FindSuccessor(r.Id)
-	return &FindSuccReply{Ip: ip}, err
+
+	id := dht.IDFromBytes(r.Id)
+	if r.Fresh {
+		p.routes.invalidate("", id)
+	}
+
+	route, path, err := p.ownerRoute(ctx, id)
+	if err != nil {
+		return &FindSuccReply{Ip: route.targets[0], Path: path}, err
+	}
+
+	// Owner that doesn't answer isn't worth remembering, for us or the client
+	if !route.known {
+		return &FindSuccReply{Ip: route.targets[0], Path: path}, nil
+	}
+
+	// Writes go to the successors when the owner is full
+	return &FindSuccReply{
+		Ip:         route.targets[0],
+		Successors: route.targets[1:],
+		Start:      route.start.Bytes(),
+		End:        route.end.Bytes(),
+		Path:       path,
+	}, nil
 }
 
 // Read reads the content of a specified file
 func (p *Peer) Read(r *ReadRequest, stream PeerService_ReadServer) error {
 
-	f, err := os.Open(r.Name)
+	f, err := os.Open(p.path(r.Name))
 	if os.IsNotExist(err) {
+		// We might just not know about it yet
+		if !p.responsible(r.Name) && !(r.Overflow && p.overflow(stream.Context(), r.Name, -1)) {
+			return p.redirect(r.Name, stream.SetTrailer)
+		}
 		return stream.Send(&ReadReply{Exists: false})
 	}
 	if err != nil {
@@ -33,7 +68,7 @@ func (p *Peer) Read(r *ReadRequest, stream PeerService_ReadServer) error {
 	}
 	defer f.Close()
 
-	if err = ValidateFile(r.Name, r.Certificate, READACT); err != nil {
+	if _, _, err = p.ValidateFile(stream.Context(), r.Name, p.path(r.Name), r.Certificate, READACT); err != nil {
 		return err
 	}
 
@@ -72,17 +107,56 @@ func (p *Peer) Write(stream PeerService_WriteServer) error {
 		return err
 	}
 
-	f, err := os.Create(writeInfo.Name)
-	defer f.Close()
+	// Shards of full owners are kept by the nodes that follow them
+	responsible := p.responsible(writeInfo.Name)
+	if !writeInfo.Overflow && !responsible {
+		return p.redirect(writeInfo.Name, stream.SetTrailer)
+	}
 
+	// Nothing is touched before the token is checked
+	claims, limit, err := p.ValidateFile(stream.Context(), writeInfo.Name, p.path(writeInfo.Name), writeInfo.Certificate, WRITACT)
 	if err != nil {
 		return err
 	}
+	if writeInfo.Size > limit || int64(len(writeInfo.Data)) > limit {
+		return p.errOverLimit(writeInfo.Name, limit, writeInfo.Certificate, claims)
+	}
+
+	// Block with the same name has the same data, it only gets one more reference
+	block := isBlock(writeInfo.Name)
+	if _, err := os.Stat(p.path(writeInfo.Name)); block && err == nil {
+		return p.referBlock(stream, writeInfo, claims, limit)
+	}
+
+	// Rewriting a shard frees what it took before
+	old := fileSize(p.path(writeInfo.Name))
+	if !p.store.fits(writeInfo.Size - old) {
+		return p.errFull(writeInfo.Size - old)
+	}
+
+	// Owner has to be full for real before we take its shard
+	size := writeInfo.Size
+	if size < int64(len(writeInfo.Data)) {
+		size = int64(len(writeInfo.Data))
+	}
+	if !responsible && !p.overflow(stream.Context(), writeInfo.Name, size) {
+		return p.redirect(writeInfo.Name, stream.SetTrailer)
+	}
+	defer p.track(p.path(writeInfo.Name))()
 
-	if err = ValidateFile(writeInfo.Name, writeInfo.Certificate, WRITACT); err != nil {
+	fpath := p.path(writeInfo.Name)
+	if err = makeParent(fpath); err != nil {
 		return err
 	}
 
+	// Shard we had stays untouched until the new one is received
+	f, err := ioutil.TempFile(filepath.Dir(fpath), filepath.Base(fpath)+".*"+writeSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
 	writer := bufio.NewWriter(f)
 
 	n, err := writer.Write(writeInfo.Data)
@@ -100,6 +174,31 @@ func (p *Peer) Write(stream PeerService_WriteServer) error {
 			if err = writer.Flush(); err != nil {
 				return err
 			}
+			if err = f.Close(); err != nil {
+				return err
+			}
+			if err = os.Rename(f.Name(), fpath); err != nil {
+				return err
+			}
+
+			if block {
+				if err = p.addRef(writeInfo.Name); err != nil {
+					return err
+				}
+			}
+
+			if claims.Quota > 0 {
+				p.auth.charge(tokenID(writeInfo.Certificate, claims), claims.ExpiresAt, written)
+			}
+
+			// Now the ring knows that we store it. Predecessor that is down learns it later.
+			if err := p.ring.SaveKey(writeInfo.Name); err != nil {
+				log.Println(err)
+			}
+			if digest, err := fileDigest(p.path(writeInfo.Name)); err == nil {
+				p.ring.SetKeyDigest(writeInfo.Name, digest)
+			}
+			go p.replicate(writeInfo.Name)
 
 			return stream.SendAndClose(&WriteReply{Written: int64(written)})
 		}
@@ -108,6 +207,16 @@ func (p *Peer) Write(stream PeerService_WriteServer) error {
 			return readErr
 		}
 
+		// Token allows only so much, whatever size was announced
+		if written+int64(len(toWrite.Data)) > limit {
+			return p.errOverLimit(writeInfo.Name, limit, writeInfo.Certificate, claims)
+		}
+
+		// Size might not be announced, so keep an eye on the quota
+		if !p.store.fits(written + int64(len(toWrite.Data)) - old) {
+			return p.errFull(written + int64(len(toWrite.Data)) - old)
+		}
+
 		n, err := writer.Write(toWrite.Data)
 
 		if err != nil {
@@ -120,7 +229,11 @@ func (p *Peer) Write(stream PeerService_WriteServer) error {
 
 func (p *Peer) Delete(ctx context.Context, r *DeleteRequest) (*DeleteReply, error) {
 
-	err := ValidateFile(r.Fname, r.Certificate, DELEACT)
+	if _, err := os.Stat(p.path(r.Fname)); os.IsNotExist(err) && !p.responsible(r.Fname) && !(r.Overflow && p.overflow(ctx, r.Fname, -1)) {
+		return &DeleteReply{}, p.redirect(r.Fname, func(md metadata.MD) { grpc.SetTrailer(ctx, md) })
+	}
+
+	_, _, err := p.ValidateFile(ctx, r.Fname, p.path(r.Fname), r.Certificate, DELEACT)
 	if os.IsNotExist(err) {
 		return &DeleteReply{Exists: false}, nil
 	}
@@ -129,7 +242,23 @@ func (p *Peer) Delete(ctx context.Context, r *DeleteRequest) (*DeleteReply, erro
 		return &DeleteReply{}, err
 	}
 
-	err = os.Remove(r.Fname)
+	// Blocks stay while other files refer to them
+	if isBlock(r.Fname) {
+		left, err := p.release(r.Fname)
+		if os.IsNotExist(err) {
+			return &DeleteReply{Exists: false}, nil
+		}
+		if err != nil {
+			return &DeleteReply{}, err
+		}
+		if left > 0 {
+			go p.replicateRefs(r.Fname)
+			return &DeleteReply{Exists: true}, nil
+		}
+	} else {
+		defer p.track(p.path(r.Fname))()
+		err = os.Remove(p.path(r.Fname))
+	}
 	if os.IsNotExist(err) {
 		return &DeleteReply{Exists: false}, nil
 	}
@@ -137,5 +266,8 @@ func (p *Peer) Delete(ctx context.Context, r *DeleteRequest) (*DeleteReply, erro
 		return &DeleteReply{}, err
 	}
 
+	p.ring.RemoveKey(r.Fname)
+	go p.dropReplicas(r.Fname)
+
 	return &DeleteReply{Exists: true}, err
 }
@@ -0,0 +1,240 @@
+// Keeping copies of shards on the successors of their owner
+package peer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"storagePeer/src/dht"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Replicas are kept apart from the shards we own
+const replicaDir = "replicas"
+
+func replicaName(fname string) string {
+	return filepath.Join(replicaDir, fname)
+}
+
+// validKey checks that the name of a shard is a clean relative path, so it stays in the data directory
+func validKey(name string) bool {
+	return name != "" && !filepath.IsAbs(name) && filepath.Clean(name) == name &&
+		name != ".." && !strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
+
+// verifyKeeper checks that the caller keeps the shard: its owner or one of the nodes that follow
+// the owner and take shards when it's full. Nobody else sends or drops our copies.
+func (p *Peer) verifyKeeper(ctx context.Context, key string) error {
+
+	if !validKey(key) {
+		return status.Errorf(codes.InvalidArgument, "%q is not a shard name", key)
+	}
+
+	cert, err := dht.CallerCert(ctx)
+	if err != nil || cert == nil {
+		return err
+	}
+
+	r, _, err := p.ownerRoute(ctx, dht.Hash([]byte(key)))
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "owner of %s not found: %v", key, err)
+	}
+
+	for _, ip := range r.targets {
+		if dht.CallerIs(ctx, ip) == nil {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%s doesn't keep %s", cert.Subject.CommonName, key)
+}
+
+////////
+// Receiving side
+////////
+
+// Replicate stores a copy of a shard for its owner
+func (p *Peer) Replicate(stream PeerService_ReplicateServer) error {
+
+	info, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	// Counts of blocks come from the keeper of the block
+	if err := p.verifyKeeper(stream.Context(), strings.TrimSuffix(info.Name, refsSuffix)); err != nil {
+		return err
+	}
+
+	// Copy replaces the one we had, only the difference has to fit
+	need := info.Size - fileSize(p.path(replicaName(info.Name)))
+	if !p.store.fits(need) {
+		return p.errFull(need)
+	}
+
+	partName := p.path(handoffPartName(replicaName(info.Name)))
+	defer p.track(partName, p.path(replicaName(info.Name)))()
+
+	if err = makeParent(partName); err != nil {
+		return err
+	}
+
+	f, err := os.Create(partName)
+	if err != nil {
+		return err
+	}
+
+	received, err := receiveShard(stream, info, f)
+	f.Close()
+	if err != nil {
+		os.Remove(partName)
+		return err
+	}
+
+	complete := received == info.Size
+	if complete {
+		err = os.Rename(partName, p.path(replicaName(info.Name)))
+
+		// Counts of blocks aren't keys, they only come along with one
+		if !isRefs(info.Name) {
+			p.ring.SaveReplicaKey(info.Name)
+			if digest, err := fileDigest(p.path(replicaName(info.Name))); err == nil {
+				p.ring.SetKeyDigest(info.Name, digest)
+			}
+		}
+	} else {
+		err = os.Remove(partName)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(&HandoffReply{Received: received, Complete: complete})
+}
+
+// DropReplica removes a copy of a shard
+func (p *Peer) DropReplica(ctx context.Context, r *DropReplicaRequest) (*DeleteReply, error) {
+
+	if err := p.verifyKeeper(ctx, r.Name); err != nil {
+		return &DeleteReply{}, err
+	}
+
+	p.ring.RemoveReplicaKey(r.Name)
+
+	defer p.track(p.path(replicaName(r.Name)), p.path(refsName(replicaName(r.Name))))()
+	os.Remove(p.path(refsName(replicaName(r.Name))))
+	err := os.Remove(p.path(replicaName(r.Name)))
+	if os.IsNotExist(err) {
+		return &DeleteReply{Exists: false}, nil
+	}
+	if err != nil {
+		return &DeleteReply{}, err
+	}
+
+	return &DeleteReply{Exists: true}, nil
+}
+
+////////
+// Owner side
+////////
+
+// replicaHolders returns IPs of the successors that have to keep copies of our shards
+func (p *Peer) replicaHolders() []string {
+
+	succs := make([]string, 0, p.replicas)
+	for _, ip := range p.ring.Successors() {
+		if len(succs) == p.replicas {
+			break
+		}
+
+		// Our other positions are on the same disk
+		if !p.siblings[ip] {
+			succs = append(succs, ip)
+		}
+	}
+
+	return succs
+}
+
+// replicateFile sends local file fpath to targetIP as a copy of shard fname
+func replicateFile(targetIP string, fpath string, fname string) error {
+
+	cl, release, err := Connect(targetIP)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	rstream, err := cl.Replicate(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if _, err = sendShard(rstream, fpath, fname, 0); err != nil {
+		return err
+	}
+
+	return sendRefs(targetIP, fpath, fname)
+}
+
+// replicate copies our shard to the first successors
+func (p *Peer) replicate(fname string) {
+
+	for _, ip := range p.replicaHolders() {
+		if err := replicateFile(ip, p.path(fname), fname); err != nil {
+			fmt.Println(err.Error())
+			fmt.Printf("Couldn't replicate %s to %s\n", fname, ip)
+		}
+	}
+}
+
+// dropReplicaOn removes a copy of the shard from targetIP
+func dropReplicaOn(targetIP string, fname string) error {
+
+	cl, release, err := Connect(targetIP)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = cl.DropReplica(context.Background(), &DropReplicaRequest{Name: fname})
+	return err
+}
+
+// dropReplicas removes copies of a deleted shard from the successors
+func (p *Peer) dropReplicas(fname string) {
+
+	for _, ip := range p.replicaHolders() {
+		if err := dropReplicaOn(ip, fname); err != nil {
+			fmt.Println(err.Error())
+			fmt.Printf("Couldn't drop replica of %s on %s\n", fname, ip)
+		}
+	}
+}
+
+// promoteReplica makes our copy of a dead node's shard the primary one
+func (p *Peer) promoteReplica(key string) {
+
+	if _, err := os.Stat(p.path(key)); os.IsNotExist(err) {
+
+		makeParent(p.path(key))
+		if err := os.Rename(p.path(replicaName(key)), p.path(key)); err != nil {
+			// Nobody has the data, so don't keep a dangling name
+			fmt.Printf("%s has no replica of %s, forgetting it\n", p.ownIP, key)
+			p.ring.RemoveKey(key)
+			return
+		}
+		if err := moveRefs(p.path(replicaName(key)), p.path(key)); err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+	p.ring.RemoveReplicaKey(key)
+
+	// Our successors changed together with the owner
+	p.replicate(key)
+}
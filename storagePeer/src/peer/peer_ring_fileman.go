@@ -4,25 +4,51 @@ package peer
 import (
 	"context"
 	"fmt"
+	"os"
 	"storagePeer/src/dht"
 	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Service func to connect to the ringIP, and find successor on that ring
-func findSuccessorWithRingIP(ringIP string, id uint64) (string, error) {
+func findSuccessorWithRingIP(ringIP string, id dht.ID) (string, error) {
 
-	someConn, somePeer, err := Connect(ringIP)
+	targets, err := findTargetsWithRingIP(ringIP, id)
 	if err != nil {
 		return "", err
 	}
-	defer someConn.Close()
 
-	ip := ""
+	return targets[0], nil
+}
+
+// Same as findSuccessorWithRingIP, but nodes that follow the successor go after it.
+// The answer is remembered for the whole range of the successor.
+func findTargetsWithRingIP(ringIP string, id dht.ID) ([]string, error) {
+	return askTargets(ringIP, id, false)
+}
+
+// askTargets asks the ring, fresh makes the node do a lookup even if it has a cached route
+func askTargets(ringIP string, id dht.ID, fresh bool) ([]string, error) {
+
+	somePeer, release, err := Connect(ringIP)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var targets []string
 	for {
-		succReply, err := somePeer.FindSuccessorInRing(context.Background(), &FindSuccRequest{Id: id})
+		succReply, err := somePeer.FindSuccessorInRing(context.Background(), &FindSuccRequest{Id: id.Bytes(), Fresh: fresh})
 
 		if err == nil {
-			ip = succReply.Ip
+			targets = append([]string{succReply.Ip}, succReply.Successors...)
+
+			// Older nodes don't tell the range
+			if len(succReply.Start) != 0 && len(succReply.End) != 0 {
+				routes.put(ringIP, dht.IDFromBytes(succReply.Start), dht.IDFromBytes(succReply.End), targets)
+			}
 			break
 		} else {
 			fmt.Println(err.Error())
@@ -31,41 +57,103 @@ func findSuccessorWithRingIP(ringIP string, id uint64) (string, error) {
 		}
 	}
 
-	fmt.Printf("Ring has answered with ip %s\n", ip)
-	return ip, nil
+	fmt.Printf("Ring has answered with ip %s\n", targets[0])
+	return targets, nil
 }
 
-// uploadFile uploads file to the successor of an id. ringIP - ip of someone on the ring
-func uploadFile(ringIP string, fname string, ringsz uint64, fcontent []byte, certificate string) error {
+// withTargets runs op on the nodes responsible for id. Cached route goes first, if it turns
+// out to be stale the ring is asked again.
+func withTargets(ringIP string, id dht.ID, op func(targets []string) error) error {
+
+	fresh := false
+	if cached, ok := routes.get(ringIP, id); ok {
+		err := op(cached.targets)
+
+		// Missing file might have moved to another owner too
+		if !stale(err) && err != os.ErrNotExist {
+			return err
+		}
+
+		fmt.Printf("Cached route to %s failed, asking the ring\n", cached.targets[0])
+		routes.invalidate(ringIP, id)
 
-	id := dht.Hash([]byte(fname), ringsz)
-	targetIP, err := findSuccessorWithRingIP(ringIP, id)
+		// The node we ask might have cached the same route
+		fresh = true
+	}
+
+	targets, err := askTargets(ringIP, id, fresh)
 	if err != nil {
 		return err
 	}
 
-	return sendFile(targetIP, fname, fcontent, certificate)
+	err = op(targets)
+	if stale(err) {
+		routes.invalidate(ringIP, id)
+	}
+
+	return err
 }
 
-// downloadFile downloads file from the corresponding node
-func downloadFile(ringIP string, fname string, ringsz uint64, fcontent []byte, certificate string) (int, error) {
-	id := dht.Hash([]byte(fname), ringsz)
-	targetIP, err := findSuccessorWithRingIP(ringIP, id)
+// uploadFile uploads file to the successor of an id. ringIP - ip of someone on the ring
+func uploadFile(ringIP string, fname string, fcontent []byte, certificate string) error {
 
-	if err != nil {
-		return 0, err
-	}
+	id := dht.Hash([]byte(fname))
+	return withTargets(ringIP, id, func(targets []string) (err error) {
+
+		// Full nodes send us further along the succ list
+		for i, targetIP := range targets {
+			err = follow(ringIP, id, targetIP, func(ip string) error {
+				return sendFile(ip, fname, fcontent, certificate, i > 0)
+			})
+			if status.Code(err) != codes.ResourceExhausted {
+				return err
+			}
+
+			fmt.Printf("%s is full, trying the next one\n", targetIP)
+		}
 
-	return recvFile(targetIP, fname, fcontent, certificate)
+		return err
+	})
 }
 
-func deleteFile(ringIP string, fname string, ringsz uint64, certificate string) error {
-	id := dht.Hash([]byte(fname), ringsz)
-	targetIP, err := findSuccessorWithRingIP(ringIP, id)
+// downloadFile downloads file from the corresponding node
+func downloadFile(ringIP string, fname string, fcontent []byte, certificate string) (int, error) {
+
+	id := dht.Hash([]byte(fname))
+	empty := 0
+	err := withTargets(ringIP, id, func(targets []string) (err error) {
+
+		// File might have been written further along if the successor was full
+		for i, targetIP := range targets {
+			err = follow(ringIP, id, targetIP, func(ip string) (err error) {
+				empty, err = recvFile(ip, fname, fcontent, certificate, i > 0)
+				return err
+			})
+			if err != os.ErrNotExist {
+				return err
+			}
+		}
 
-	if err != nil {
 		return err
-	}
+	})
+
+	return empty, err
+}
 
-	return remvFile(targetIP, fname, certificate)
+func deleteFile(ringIP string, fname string, certificate string) error {
+
+	id := dht.Hash([]byte(fname))
+	return withTargets(ringIP, id, func(targets []string) (err error) {
+
+		for i, targetIP := range targets {
+			err = follow(ringIP, id, targetIP, func(ip string) error {
+				return remvFile(ip, fname, certificate, i > 0)
+			})
+			if err != os.ErrNotExist {
+				return err
+			}
+		}
+
+		return err
+	})
 }
@@ -0,0 +1,138 @@
+// Remembering which node owns which range of ids, so not every shard needs a lookup
+package peer
+
+import (
+	"context"
+	"storagePeer/src/dht"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RouteTTL is how long a cached owner of a range is trusted
+const RouteTTL = 30 * time.Second
+
+type route struct {
+	start   dht.ID // Owner is responsible for (start, end]
+	end     dht.ID
+	targets []string // Owner first, then the nodes that follow it
+	expires time.Time
+	known   bool // Range and successors are known, not only the owner
+}
+
+// Routes are kept per ring we asked, different rings don't mix
+type routeCache struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	routes map[string][]route
+}
+
+func newRouteCache(ttl time.Duration) *routeCache {
+	return &routeCache{ttl: ttl, routes: make(map[string][]route)}
+}
+
+// Routes of the client side, shared by uploads, downloads and deletes. Nodes have their own.
+var routes = newRouteCache(RouteTTL)
+
+// get returns the route for id, false if there is no fresh one
+func (c *routeCache) get(ringIP string, id dht.ID) (route, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, r := range c.routes[ringIP] {
+		if now.Before(r.expires) && dht.InRange(r.start, r.end, id) {
+			return r, true
+		}
+	}
+
+	return route{}, false
+}
+
+// put remembers targets for (start, end], old routes overlapping it are dropped
+func (c *routeCache) put(ringIP string, start dht.ID, end dht.ID, targets []string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	kept := make([]route, 0, len(c.routes[ringIP])+1)
+	for _, r := range c.routes[ringIP] {
+		overlaps := dht.InRange(r.start, r.end, end) || dht.InRange(start, end, r.end)
+		if now.Before(r.expires) && !overlaps {
+			kept = append(kept, r)
+		}
+	}
+
+	c.routes[ringIP] = append(kept, route{start: start, end: end, targets: targets, expires: now.Add(c.ttl), known: true})
+}
+
+// invalidate drops the route for id
+func (c *routeCache) invalidate(ringIP string, id dht.ID) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kept := make([]route, 0, len(c.routes[ringIP]))
+	for _, r := range c.routes[ringIP] {
+		if !dht.InRange(r.start, r.end, id) {
+			kept = append(kept, r)
+		}
+	}
+
+	c.routes[ringIP] = kept
+}
+
+// stale tells whether the error means that the route we used is wrong: the node is unreachable
+// or isn't responsible for the id anymore
+func stale(err error) bool {
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.FailedPrecondition:
+		return true
+	}
+
+	return false
+}
+
+// ownerRoute returns the owner of id in our ring together with the nodes that follow it.
+// Routes of other nodes are cached, the path is only there when the ring was asked.
+func (p *Peer) ownerRoute(ctx context.Context, id dht.ID) (route, []string, error) {
+
+	// Clients asking for the same range don't start a lookup each time
+	if cached, ok := p.routes.get("", id); ok {
+		return cached, nil, nil
+	}
+
+	found, err := p.ring.Lookup(id)
+	r := route{start: found.Start, end: found.End, targets: []string{found.IP}}
+	if err != nil {
+		return r, found.Path, err
+	}
+
+	if found.IP == p.ownIP {
+		r.targets = append(r.targets, p.ring.Successors()...)
+		r.known = true
+		return r, found.Path, nil
+	}
+
+	cl, release, err := Connect(found.IP)
+	if err != nil {
+		return r, found.Path, nil
+	}
+	defer release()
+
+	stats, err := cl.Stats(ctx, &StatsRequest{})
+	if err != nil {
+		return r, found.Path, nil
+	}
+
+	r.targets = append(r.targets, stats.Successors...)
+	r.known = true
+	p.routes.put("", r.start, r.end, r.targets)
+
+	return r, found.Path, nil
+}
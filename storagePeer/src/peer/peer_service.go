@@ -6,26 +6,164 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"storagePeer/src/dht"
+	"storagePeer/src/pool"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
 )
 
-// NewPeer creates new peer
-func NewPeer(ownIP string, listeningIP string, maxNodes uint64, existingIP string, deltaT time.Duration) *Peer {
+// How many salted ids a node tries if its own one is taken
+const joinAttempts = 3
 
-	fmt.Println("Fucking your wife")
-	p := Peer{ownIP: ownIP, ring: dht.NewRingNode(ownIP, maxNodes, deltaT), Errs: make(chan error, 1)}
+// NewPeer creates new peer talking plaintext, for local tests
+func NewPeer(ownIP string, listeningIP string, existingIP string, deltaT time.Duration) *Peer {
 
-	p.start(listeningIP)
+	return NewPeerWithConfig(Config{
+		OwnIP:       ownIP,
+		ListeningIP: listeningIP,
+		ExistingIP:  existingIP,
+		DeltaT:      deltaT,
+		Replicas:    DefaultReplicas,
+		Insecure:    true,
+	})
+}
 
-	// Join the network. Build finger table and adapt the other ones.
-	p.ring.Join(existingIP)
+// NewPeerWithConfig creates new peer as described in the config
+func NewPeerWithConfig(cfg Config) *Peer {
+
+	fmt.Println("Fucking your wife")
+	p := newPeer(cfg)
 
 	fmt.Println("Notifying server...")
 	p.notifyAboutArrival()
 
+	return p
+}
+
+// newPeer starts the node with all of its virtual nodes
+func newPeer(cfg Config) *Peer {
+
+	if cfg.DeltaT < MinDeltaT {
+		cfg.DeltaT = MinDeltaT
+	}
+
+	k := virtualNodes(cfg)
+
+	opts, err := serverOptions(cfg)
+	if err != nil {
+		log.Fatalf("failed to set up TLS: %v", err)
+	}
+
+	var keys *keySet
+	if cfg.JWKS != "" {
+		if keys, err = newKeySet(cfg.JWKS); err != nil {
+			log.Fatalf("failed to load token keys: %v", err)
+		}
+		go keys.refreshRoutine()
+	}
+
+	auth := newTokenAuth(authURL, cfg.Revocations, cfg.AuthGrace)
+	go auth.revocationRoutine()
+
+	// Copies on our own positions don't protect anything, so we have to know them
+	siblings := make(map[string]bool, k)
+	for i := 0; i < k; i++ {
+		siblings[virtualConfig(cfg, i).OwnIP] = true
+	}
+
+	store := &storage{capacity: int64(cfg.Capacity)}
+	if cfg.DataDir != "" {
+		// Shards from the previous run take their space too
+		used, err := dirSize(cfg.DataDir)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println(err.Error())
+		}
+		store.add(used)
+	}
+
+	p := newPosition(cfg, siblings, store, keys, auth, opts)
+
+	for i := 1; i < k; i++ {
+		v := newPosition(virtualConfig(cfg, i), siblings, store, keys, auth, opts)
+		p.virtual = append(p.virtual, v)
+
+		go func() {
+			for err := range v.Errs {
+				fmt.Println("Virtual node", v.ownIP, "error:", err)
+			}
+		}()
+	}
+
+	return p
+}
+
+// newPosition starts one position of the node and joins the ring. With a data directory the node
+// picks up keys and neighbours it had before the restart.
+func newPosition(cfg Config, siblings map[string]bool, store *storage, keys *keySet, auth *tokenAuth, opts []grpc.ServerOption) *Peer {
+
+	p := Peer{
+		ownIP:    cfg.OwnIP,
+		replicas: cfg.Replicas,
+		deltaT:   cfg.DeltaT,
+		dataDir:  cfg.DataDir,
+		siblings: siblings,
+		store:    store,
+		keys:     keys,
+		auth:     auth,
+		routes:   newRouteCache(RouteTTL),
+		Errs:     make(chan error, 1),
+		stop:     make(chan struct{}),
+
+		legacyNames: cfg.LegacyNames,
+	}
+
+	if err := os.MkdirAll(p.path(replicaDir), 0755); err != nil {
+		log.Fatalf("failed to create replica directory: %v", err)
+	}
+
+	if p.dataDir == "" {
+		// Nowhere to keep the id, so it comes from the IP
+		p.ring = dht.NewRingNode(cfg.OwnIP, cfg.DeltaT)
+	}
+
+	existingIP := cfg.ExistingIP
+	if p.dataDir != "" {
+		state, err := p.loadState()
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+
+		// Node keeps its id whatever IP it gets
+		p.ring = dht.NewRingNodeWithID(cfg.OwnIP, p.nodeID(state), cfg.DeltaT)
+
+		if err = p.restoreKeys(state); err != nil {
+			log.Fatalf("failed to restore keys: %v", err)
+		}
+
+		existingIP = p.bootstrapIP(state, existingIP)
+	}
+
+	p.start(cfg.ListeningIP, opts)
+
+	// Join the network. Build finger table and adapt the other ones.
+	// Taken id is replaced by a salted one, saved state keeps it from then on.
+	if err := p.ring.JoinWithSalt(existingIP, joinAttempts); err != nil {
+		log.Fatalf("failed to join the ring: %v", err)
+	}
+
+	if p.dataDir != "" {
+		// Some of the restored keys might belong to other nodes by now
+		p.ring.ReconcileKeys()
+
+		if err := p.saveState(); err != nil {
+			fmt.Println(err.Error())
+		}
+		go p.persistRoutine()
+	}
+
 	return &p
 }
 
@@ -33,16 +171,24 @@ func NewPeer(ownIP string, listeningIP string, maxNodes uint64, existingIP strin
 func (p *Peer) MarshalJSON() ([]byte, error) {
 
 	return json.Marshal(struct {
-		OwnIP string
-		Ring  *dht.RingNode
+		OwnIP           string
+		Ring            *dht.RingNode
+		UnderReplicated int64
+		Capacity        int64
+		Used            int64
+		Virtual         []*Peer `json:",omitempty"`
 	}{
-		OwnIP: p.ownIP,
-		Ring:  p.ring,
+		OwnIP:           p.ownIP,
+		Ring:            p.ring,
+		UnderReplicated: atomic.LoadInt64(&p.underReplicated),
+		Capacity:        p.store.capacity,
+		Used:            p.store.usage(),
+		Virtual:         p.virtual,
 	})
 }
 
 // Start starts gRPC server for peer in a seperate go routine
-func (p *Peer) start(listeningIP string) {
+func (p *Peer) start(listeningIP string, opts []grpc.ServerOption) {
 	// Configure listening
 
 	lis, err := net.Listen("tcp", listeningIP)
@@ -51,7 +197,8 @@ func (p *Peer) start(listeningIP string) {
 	}
 
 	// create a gRPC server object
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(opts...)
+	p.server = grpcServer
 
 	// attach services to handler object
 
@@ -66,26 +213,41 @@ func (p *Peer) start(listeningIP string) {
 
 	// Start a fix routine
 	go p.fixRoutine()
+	go p.antiEntropyRoutine()
 }
 
-// Connect connects to peer with specified IP
-func Connect(targetIP string) (*grpc.ClientConn, PeerServiceClient, error) {
-	conn, err := grpc.Dial(targetIP, grpc.WithInsecure())
+// Stop shuts down the node with its virtual positions. Nobody is told, neighbours find out
+// when they fix the ring.
+func (p *Peer) Stop() {
 
-	if err != nil {
-		for {
-			conn, err = grpc.Dial(targetIP, grpc.WithInsecure())
-			if err != nil {
-				fmt.Println(err)
-				fmt.Println("Couldn't connect to node", targetIP)
-			} else {
-				break
-			}
-
-			time.Sleep(time.Second * 1)
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		for _, v := range p.virtual {
+			v.Stop()
 		}
+		p.ring.Halt()
+		p.server.Stop()
+	})
+}
+
+// sleep waits for the next run of a routine, false means the node was stopped
+func (p *Peer) sleep() bool {
+
+	select {
+	case <-p.stop:
+		return false
+	case <-time.After(p.deltaT):
+		return true
+	}
+}
+
+// Connect gets a connection to peer with specified IP from the shared pool, release it when done
+func Connect(targetIP string) (PeerServiceClient, func(), error) {
+
+	conn, release, err := pool.Get(targetIP)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	cl := NewPeerServiceClient(conn)
-	return conn, cl, nil
+	return NewPeerServiceClient(conn), release, nil
 }
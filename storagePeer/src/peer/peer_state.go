@@ -0,0 +1,251 @@
+// Keeping the state of the node on disk, so a restarted node doesn't start empty
+package peer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"storagePeer/src/dht"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// State file lives in the data directory next to the shards
+const stateFile = "node.json"
+
+// How long we wait for a saved neighbour before trying the next one
+const bootstrapTimeout = 2 * time.Second
+
+type nodeState struct {
+	IP          string
+	ID          dht.ID
+	Neighbours  []string // Last known nodes of the ring, closest first
+	Keys        []string
+	ReplicaKeys []string
+	Digests     map[string][]byte
+}
+
+// path of a shard (or any other file) inside the data directory
+func (p *Peer) path(name string) string {
+	return filepath.Join(p.dataDir, name)
+}
+
+// makeParent creates the directory of a file, names of namespaced shards have one
+func makeParent(fpath string) error {
+	return os.MkdirAll(filepath.Dir(fpath), 0755)
+}
+
+////////
+// Saving
+////////
+
+// saveState writes identity, key index and neighbours of the node to the data directory
+func (p *Peer) saveState() error {
+
+	ip := p.ring.RingInfo()
+	state := nodeState{
+		IP:          ip,
+		ID:          p.ring.ID(),
+		Neighbours:  p.ring.Neighbours(),
+		Keys:        p.ring.Keys(),
+		ReplicaKeys: p.ring.ReplicaKeys(),
+		Digests:     make(map[string][]byte),
+	}
+
+	for _, key := range append(state.Keys, state.ReplicaKeys...) {
+		if digest := p.ring.KeyDigest(key); digest != nil {
+			state.Digests[key] = digest
+		}
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write the whole file first so a crash doesn't leave half of it
+	tmp := p.path(stateFile + ".tmp")
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p.path(stateFile))
+}
+
+// persistRoutine saves the state whenever keys or neighbours of the node change
+func (p *Peer) persistRoutine() {
+
+	saved := false
+	var version uint64
+	var id dht.ID
+	var neighbours []string
+
+	for p.sleep() {
+		v, i, n := p.ring.Version(), p.ring.ID(), p.ring.Neighbours()
+		if saved && v == version && i == id && equalStrings(n, neighbours) {
+			continue
+		}
+
+		if err := p.saveState(); err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		saved, version, id, neighbours = true, v, i, n
+	}
+}
+
+func equalStrings(a []string, b []string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+////////
+// Restoring
+////////
+
+// loadState reads the saved state, nil if the node was never run in this directory
+func (p *Peer) loadState() (*nodeState, error) {
+
+	data, err := ioutil.ReadFile(p.path(stateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state nodeState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// nodeID returns the saved id of the node, a new one is generated on the first run
+func (p *Peer) nodeID(state *nodeState) dht.ID {
+
+	if state != nil {
+		return state.ID
+	}
+
+	return dht.NewNodeID()
+}
+
+// scanDataDir lists shards and replicas that are on disk
+func (p *Peer) scanDataDir() ([]string, []string, error) {
+
+	keys := make([]string, 0)
+	replicaKeys := make([]string, 0)
+
+	err := filepath.Walk(p.path(""), func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.path(""), fpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		// Unfinished transfers and writes, counts of blocks and our own files are not shards
+		if strings.HasSuffix(rel, handoffPartName("")) || strings.HasSuffix(rel, writeSuffix) || isRefs(strings.TrimSuffix(rel, ".tmp")) || rel == stateFile || rel == stateFile+".tmp" {
+			return nil
+		}
+
+		// Other positions of the node keep their own shards
+		if strings.HasPrefix(rel, virtualDir+"/") {
+			return nil
+		}
+
+		if strings.HasPrefix(rel, replicaDir+"/") {
+			replicaKeys = append(replicaKeys, strings.TrimPrefix(rel, replicaDir+"/"))
+		} else {
+			keys = append(keys, rel)
+		}
+
+		return nil
+	})
+
+	return keys, replicaKeys, err
+}
+
+// restoreKeys rebuilds key lists from the data directory. Files on disk are what counts,
+// saved state only spares us from hashing every shard again.
+func (p *Peer) restoreKeys(state *nodeState) error {
+
+	keys, replicaKeys, err := p.scanDataDir()
+	if err != nil {
+		return err
+	}
+
+	p.ring.RestoreKeys(keys, replicaKeys)
+
+	if state != nil {
+		if state.IP != p.ownIP {
+			fmt.Printf("Node %s moved from %s to %s\n", state.ID, state.IP, p.ownIP)
+		}
+
+		for _, key := range append(keys, replicaKeys...) {
+			if digest, ok := state.Digests[key]; ok {
+				p.ring.SetKeyDigest(key, digest)
+			}
+		}
+	}
+
+	fmt.Printf("%s restored %d keys and %d replicas\n", p.ownIP, len(keys), len(replicaKeys))
+	return nil
+}
+
+// alive checks that there is a node listening on ip
+func alive(ip string) bool {
+
+	ctx, cancel := context.WithTimeout(context.Background(), bootstrapTimeout)
+	defer cancel()
+
+	cl, release, err := Connect(ip)
+	if err != nil {
+		return false
+	}
+	defer release()
+
+	// Wait for the connection up to the timeout instead of failing at once
+	_, err = cl.Ping(ctx, &PingMessage{Ok: true}, grpc.WaitForReady(true))
+	return err == nil
+}
+
+// bootstrapIP chooses a node to join through. Given IP goes first, then the saved neighbours.
+// Empty string means that nobody is there and we start a new ring.
+func (p *Peer) bootstrapIP(state *nodeState, existingIP string) string {
+
+	if existingIP != "" || state == nil {
+		return existingIP
+	}
+
+	for _, ip := range state.Neighbours {
+		if ip != p.ownIP && alive(ip) {
+			fmt.Printf("%s rejoins through %s\n", p.ownIP, ip)
+			return ip
+		}
+	}
+
+	return ""
+}
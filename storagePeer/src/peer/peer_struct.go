@@ -3,11 +3,77 @@ package peer
 
 import (
 	"storagePeer/src/dht"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
 )
 
+// DefaultReplicas is the number of successors that keep a copy of every shard by default
+const DefaultReplicas = 2
+
+// MinDeltaT is how often routines of the node run at most, shorter DeltaT is raised to it
+const MinDeltaT = time.Second
+
+// Config describes how a peer should be run
+type Config struct {
+	OwnIP       string        // External IP of the node
+	ListeningIP string        // Local IP that we listen to
+	ExistingIP  string        // IP of some node in the ring (empty for the first node)
+	DeltaT      time.Duration // Time in which fix routine is invoked (at least MinDeltaT)
+	Replicas    int           // Number of successors that keep a copy of each shard
+	DataDir     string        // Directory with shards and node state (empty for the working directory without state)
+
+	VirtualNodes int    // Number of positions on the ring (0 to derive it from Capacity)
+	Capacity     uint64 // Disk space given to the node in bytes (0 for no limit), weights the number of positions
+
+	CAFile   string // CA bundle that signs certificates of nodes and clients
+	CertFile string // Certificate of the node, issued for its external address with the "node" OU
+	KeyFile  string
+	Insecure bool // Plaintext instead of mutual TLS, for clients that have no certificates yet
+
+	JWKS string // File or URL with public keys that sign tokens, without it every token is refused
+
+	Revocations string        // File or URL with ids of revoked tokens (empty for none)
+	AuthGrace   time.Duration // How long reads go on when the auth server is down (0 for DefaultAuthGrace)
+
+	// Files stored before namespaces have plain names. With this tokens of users can read them too,
+	// any user's token whose name matches, so other users can read the file. Nobody deletes them.
+	// Meant for the time of the migration.
+	LegacyNames bool
+}
+
 // Peer is the peer struct
 type Peer struct {
-	ownIP string
-	ring  *dht.RingNode
-	Errs  chan error
+	ownIP    string
+	ring     *dht.RingNode
+	replicas int
+	deltaT   time.Duration
+	dataDir  string
+	Errs     chan error
+
+	// Other positions of this node on the ring (only the first one keeps them)
+	virtual  []*Peer
+	siblings map[string]bool
+
+	// Disk space is shared by all positions
+	store *storage
+
+	// Keys that sign tokens and answers of the auth server, shared by all positions too
+	keys *keySet
+	auth *tokenAuth
+
+	// Tokens of users may read and delete plain names
+	legacyNames bool
+
+	// Owners of ranges we found for clients
+	routes *routeCache
+
+	// Number of our keys that have less than replicas copies, updated by anti-entropy
+	underReplicated int64
+
+	// Routines of the node end when stop is closed
+	server   *grpc.Server
+	stop     chan struct{}
+	stopOnce sync.Once
 }
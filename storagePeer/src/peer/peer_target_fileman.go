@@ -8,23 +8,31 @@ import (
 	"math"
 	"os"
 	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 const chunksz = 8
 
-// sendFile sends file to the target IP
-func sendFile(targetIP string, fname string, fcontent []byte, certificate string) error {
+// sendFile sends file to the target IP. Overflow asks the node to keep a shard of a full owner.
+func sendFile(targetIP string, fname string, fcontent []byte, certificate string, overflow bool) error {
 
-	conn, cl, err := Connect(targetIP)
+	cl, release, err := Connect(targetIP)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer release()
 
 	fmt.Printf("Opening write stream to %s...", targetIP)
 	// Stream to write
 	wstream, err := cl.Write(context.Background())
 	for err != nil {
+		// Waiting won't help if the node is gone, the caller looks for the new owner
+		if stale(err) {
+			return err
+		}
+
 		fmt.Println(err.Error())
 		fmt.Println("Couldn't initialize remote write stream")
 		time.Sleep(time.Second * 1)
@@ -34,13 +42,14 @@ func sendFile(targetIP string, fname string, fcontent []byte, certificate string
 
 	fmt.Printf("Sending filename %s...", fname)
 	// Send request
-	err = wstream.Send(&WriteRequest{Name: fname, Certificate: certificate})
+	err = wstream.Send(&WriteRequest{Name: fname, Certificate: certificate, Size: int64(len(fcontent)), Overflow: overflow})
 
-	for err != nil {
+	// EOF means that the node refused the write, the reason comes with CloseAndRecv
+	for err != nil && err != io.EOF {
 		fmt.Println(err.Error())
 		fmt.Println("Couldn't send filename")
 		time.Sleep(time.Second * 1)
-		err = wstream.Send(&WriteRequest{Name: fname, Certificate: certificate})
+		err = wstream.Send(&WriteRequest{Name: fname, Certificate: certificate, Size: int64(len(fcontent)), Overflow: overflow})
 	}
 
 	chunkSize := chunksz
@@ -56,6 +65,9 @@ func sendFile(targetIP string, fname string, fcontent []byte, certificate string
 		}
 
 		err := wstream.Send(&WriteRequest{Data: curChunk})
+		if err == io.EOF {
+			break
+		}
 
 		for err != nil {
 			fmt.Println(err.Error())
@@ -67,7 +79,7 @@ func sendFile(targetIP string, fname string, fcontent []byte, certificate string
 
 	reply, err := wstream.CloseAndRecv()
 	if err != nil {
-		return err
+		return redirectOf(err, wstream.Trailer())
 	}
 
 	fmt.Printf("Finished writing %d bytes", reply.Written)
@@ -75,22 +87,22 @@ func sendFile(targetIP string, fname string, fcontent []byte, certificate string
 }
 
 // recvFile recieves file w/ filename=fname, from node targetIP - returns how much empty space is at the end (negative, if buffer is too small)
-func recvFile(targetIP string, fname string, fcontent []byte, certificate string) (int, error) {
+func recvFile(targetIP string, fname string, fcontent []byte, certificate string, overflow bool) (int, error) {
 
-	conn, peer, err := Connect(targetIP)
+	peer, release, err := Connect(targetIP)
 	if err != nil {
 		return 0, err
 	}
-	defer conn.Close()
+	defer release()
 
-	rstream, err := peer.Read(context.Background(), &ReadRequest{Name: fname, ChunkSize: chunksz, Certificate: certificate})
+	rstream, err := peer.Read(context.Background(), &ReadRequest{Name: fname, ChunkSize: chunksz, Certificate: certificate, Overflow: overflow})
 	if err != nil {
 		return 0, err
 	}
 
 	readReply, err := rstream.Recv()
 	if err != nil {
-		return 0, err
+		return 0, redirectOf(err, rstream.Trailer())
 	}
 
 	if !readReply.Exists {
@@ -134,15 +146,19 @@ func recvFile(targetIP string, fname string, fcontent []byte, certificate string
 	return emptySpace, nil
 }
 
-func remvFile(targetIP string, fname string, certificate string) error {
-	conn, peer, err := Connect(targetIP)
+func remvFile(targetIP string, fname string, certificate string, overflow bool) error {
+	peer, release, err := Connect(targetIP)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer release()
 
-	r, err := peer.Delete(context.Background(), &DeleteRequest{Fname: fname, Certificate: certificate})
-	if err == nil && !r.Exists {
+	var trailer metadata.MD
+	r, err := peer.Delete(context.Background(), &DeleteRequest{Fname: fname, Certificate: certificate, Overflow: overflow}, grpc.Trailer(&trailer))
+	if err != nil {
+		return redirectOf(err, trailer)
+	}
+	if !r.Exists {
 		err = os.ErrNotExist
 	}
 
@@ -3,20 +3,44 @@ package peer
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"storagePeer/src/dht"
+	"storagePeer/src/pool"
+
 	"github.com/dgrijalva/jwt-go"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 func genIP() func() string {
@@ -46,56 +70,147 @@ func randString(length int) []byte {
 }
 
 // Make one peer
-func makePeer() (string, uint64, PeerServiceClient, *grpc.ClientConn, error) {
+func makePeer(t *testing.T) (*Peer, string, PeerServiceClient, *grpc.ClientConn, error) {
 	ownIP := IP()
 
-	ringsz := uint64(1000)
-	NewPeer(ownIP, ownIP, ringsz, "", time.Second)
+	p := trustAll(startPeer(t, testConfig(t, ownIP, "")))
 
 	connection, err := grpc.Dial(ownIP, grpc.WithInsecure())
 	if err != nil {
-		return "", 0, nil, nil, err
+		return nil, "", nil, nil, err
 	}
 
 	client := NewPeerServiceClient(connection)
 
-	return ownIP, ringsz, client, connection, nil
+	return p, ownIP, client, connection, nil
+}
+
+// Local node that trusts tokens signed by testKey, shards go to a directory of the test
+func testConfig(t *testing.T, ownIP string, existingIP string) Config {
+	return Config{OwnIP: ownIP, ListeningIP: ownIP, ExistingIP: existingIP, DeltaT: time.Second, Replicas: DefaultReplicas, Insecure: true, JWKS: testJWKS, DataDir: tempDir(t)}
+}
+
+// Directory that is removed at the end of the test
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "peer_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
+
+// Run a node until the end of the test, it's stopped before its directory is removed
+func startPeer(t *testing.T, cfg Config) *Peer {
+	p := newPeer(cfg)
+	t.Cleanup(p.Stop)
+	return p
+}
+
+// Auth server that accepts every token, shared by the nodes of the tests
+var testAuth = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(FileValidationResponse{Valid: true})
+}))
+
+// Point the node to testAuth instead of the real auth server
+func trustAll(p *Peer) *Peer {
+	p.auth.url = testAuth.URL
+	return p
 }
 
 // Make n peers in one ring
-func makeRing(n uint) (string, uint64) {
+func makeRing(t *testing.T, n uint) (string, []*Peer) {
 
-	ringsz := uint64(1000)
 	host := IP()
 
-	NewPeer(host, host, ringsz, "", time.Second)
+	peers := []*Peer{trustAll(startPeer(t, testConfig(t, host, "")))}
 
 	ips := make([]string, n)
 	for i := uint(0); i < n; i++ {
 		ips[i] = IP()
-		NewPeer(ips[i], ips[i], ringsz, host, time.Second)
+		peers = append(peers, trustAll(startPeer(t, testConfig(t, ips[i], host))))
 	}
 
-	return host, ringsz
+	return host, peers
 }
 
-// Generate a certificate
-func genCertificate(fname string, fsize int64, act int8) (string, error) {
-	key := []byte("qwertyuiopasdfghjklzxcvbnm123456")
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, &FileClaim{Name: fname, Size: fsize, Act: act})
+// Key that signs certificates of the tests, nodes find it in testJWKS
+var testKey, testJWKS = testKeys()
+
+func testKeys() (ed25519.PrivateKey, string) {
+	pub, priv, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	f, err := ioutil.TempFile("", "peer_jwks")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+
+	if err = writeJWKS(f.Name(), map[string]interface{}{"test": pub}); err != nil {
+		panic(err)
+	}
+
+	return priv, f.Name()
+}
+
+// Write public keys to a JWKS file
+func writeJWKS(path string, keys map[string]interface{}) error {
+	enc := base64.RawURLEncoding
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kty: "RSA", Kid: kid, N: enc.EncodeToString(key.N.Bytes()), E: enc.EncodeToString(big.NewInt(int64(key.E)).Bytes())})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kty: "OKP", Crv: "Ed25519", Kid: kid, X: enc.EncodeToString(key)})
+		}
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
 
-	tokenString, err := token.SignedString(key)
+// Generate a certificate or fail the test
+func genCert(t *testing.T, fname string, fsize int64, act int8) string {
+	cert, err := genCertificate(fname, fsize, act)
 	if err != nil {
-		return "", err
+		t.Fatal(err)
 	}
 
-	return tokenString, nil
+	return cert
+}
+
+// Sign claims with the key
+func signToken(method jwt.SigningMethod, key interface{}, kid string, claims *FileClaim) (string, error) {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	return token.SignedString(key)
+}
+
+// Generate a certificate
+func genCertificate(fname string, fsize int64, act int8) (string, error) {
+	claims := &FileClaim{Name: fname, Size: fsize, Act: act}
+	claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+
+	return signToken(SigningMethodEdDSA, testKey, "test", claims)
 }
 
 // TestRW tests read/write capabilities of a peer
 func TestRW(t *testing.T) {
 
-	_, _, client, connection, err := makePeer()
+	_, _, client, connection, err := makePeer(t)
 	defer connection.Close()
 	if err != nil {
 		t.Error(err)
@@ -105,11 +220,12 @@ func TestRW(t *testing.T) {
 
 	wstream, err := client.Write(context.Background())
 	if err != nil {
-		t.Error("Creating write stream failed:", err)
+		t.Fatal("Creating write stream failed:", err)
 	}
 
 	chunkAmnt := rand.Intn(16) + 16
-	fLength := chunkAmnt * 8
+	lastChunkLen := rand.Intn(4) + 3
+	fLength := chunkAmnt*8 + lastChunkLen
 	fContent := make([]byte, 0)
 	writeCert, err := genCertificate(fName, int64(fLength), WRITACT)
 	if err != nil {
@@ -129,10 +245,8 @@ func TestRW(t *testing.T) {
 		}
 	}
 
-	lastChunkLen := rand.Intn(4) + 3
 	lastChunk := randString(lastChunkLen)
 
-	fLength += lastChunkLen
 	fContent = append(fContent, lastChunk...)
 
 	if err := wstream.Send(&WriteRequest{Data: lastChunk}); err != nil {
@@ -141,7 +255,7 @@ func TestRW(t *testing.T) {
 
 	writeReply, err := wstream.CloseAndRecv()
 	if err != nil {
-		t.Error("Error closing write stream!", err)
+		t.Fatal("Error closing write stream!", err)
 	}
 
 	written := int(writeReply.Written)
@@ -152,7 +266,7 @@ func TestRW(t *testing.T) {
 	}
 	rstream, err := client.Read(context.Background(), &ReadRequest{Name: fName, ChunkSize: 8, Certificate: readCert})
 	if err != nil {
-		t.Error("Creating read stream failed:", err)
+		t.Fatal("Creating read stream failed:", err)
 	}
 
 	readContent := make([]byte, 0)
@@ -164,7 +278,7 @@ func TestRW(t *testing.T) {
 		}
 
 		if err != nil {
-			t.Error("Error reading from stream:", err)
+			t.Fatal("Error reading from stream:", err)
 		}
 
 		nextChunk := readReply.Data[:readReply.Size]
@@ -181,13 +295,11 @@ func TestRW(t *testing.T) {
 			t.Error("Read data different from written data")
 		}
 	}
-
-	os.Remove(fName)
 }
 
 func TestUpload(t *testing.T) {
 
-	ownIP, ringsz, _, connection, err := makePeer()
+	p, ownIP, _, connection, err := makePeer(t)
 	defer connection.Close()
 	if err != nil {
 		t.Error(err)
@@ -201,12 +313,12 @@ func TestUpload(t *testing.T) {
 		t.Error("Error creating write certificate!", err)
 	}
 
-	err = uploadFile(ownIP, fname, ringsz, fcontent, wCert)
+	err = uploadFile(ownIP, fname, fcontent, wCert)
 	if err != nil {
 		t.Error("Unable to send file", err)
 	}
 
-	fcontentRead, err := ioutil.ReadFile(fname)
+	fcontentRead, err := ioutil.ReadFile(p.path(fname))
 	if err != nil {
 		t.Error("Unable to read sent file", err)
 	}
@@ -220,13 +332,11 @@ func TestUpload(t *testing.T) {
 			t.Error("Content doesn't match!")
 		}
 	}
-
-	os.Remove(fname)
 }
 
 func TestDownload(t *testing.T) {
 
-	ownIP, ringsz, _, connection, err := makePeer()
+	p, ownIP, _, connection, err := makePeer(t)
 	defer connection.Close()
 	if err != nil {
 		t.Error(err)
@@ -240,10 +350,10 @@ func TestDownload(t *testing.T) {
 		t.Error("Error creating read certificate!", err)
 	}
 
-	ioutil.WriteFile(fname, fcontent, 0644)
+	ioutil.WriteFile(p.path(fname), fcontent, 0644)
 
 	fcontentRead := make([]byte, len(fcontent))
-	empty, err := downloadFile(ownIP, fname, ringsz, fcontentRead, rCert)
+	empty, err := downloadFile(ownIP, fname, fcontentRead, rCert)
 	if err != nil {
 		t.Error("Unable to download file", err)
 	}
@@ -257,12 +367,10 @@ func TestDownload(t *testing.T) {
 			t.Error("Content doesn't match!")
 		}
 	}
-
-	os.Remove(fname)
 }
 
 func TestUD(t *testing.T) {
-	ownIP, ringsz, _, connection, err := makePeer()
+	_, ownIP, _, connection, err := makePeer(t)
 	if err != nil {
 		t.Error(err)
 	}
@@ -276,7 +384,7 @@ func TestUD(t *testing.T) {
 	if err != nil {
 		t.Error("Error creating write certificate!", err)
 	}
-	err = uploadFile(ownIP, fname, ringsz, fcontent, wCert)
+	err = uploadFile(ownIP, fname, fcontent, wCert)
 	if err != nil {
 		t.Error("Unable to send file", err)
 	}
@@ -287,7 +395,7 @@ func TestUD(t *testing.T) {
 		t.Error("Error creating read certificate!", err)
 	}
 
-	empty, err := downloadFile(ownIP, fname, ringsz, fcontentRead, rCert)
+	empty, err := downloadFile(ownIP, fname, fcontentRead, rCert)
 	if err != nil {
 		t.Error("Unable to download file", err)
 	}
@@ -307,7 +415,7 @@ func TestUD(t *testing.T) {
 		t.Error("Error creating delete certificate!", err)
 	}
 
-	if err = deleteFile(ownIP, fname, ringsz, dCert); err != nil {
+	if err = deleteFile(ownIP, fname, dCert); err != nil {
 		t.Error("Error deleting file", err)
 	}
 }
@@ -326,7 +434,7 @@ func findBin() (string, error) {
 }
 
 func TestC(t *testing.T) {
-	ip, ringsz, _, conn, err := makePeer()
+	_, ip, _, conn, err := makePeer(t)
 	if err != nil {
 		t.Error("Unable to create peer", err)
 	}
@@ -338,7 +446,7 @@ func TestC(t *testing.T) {
 	}
 
 	var errStream bytes.Buffer
-	cTest := exec.Cmd{Path: "./c_test", Dir: binpath, Args: []string{binpath + "/c_test", ip, strconv.Itoa(int(ringsz))}, Stderr: &errStream}
+	cTest := exec.Cmd{Path: "./c_test", Dir: binpath, Args: []string{binpath + "/c_test", ip}, Stderr: &errStream}
 	err = cTest.Run()
 	if err != nil {
 		t.Error("Run error:", err, "stderr:", errStream.String())
@@ -346,39 +454,41 @@ func TestC(t *testing.T) {
 }
 
 func TestRSC(t *testing.T) {
-	host, ringsz := makeRing(10)
+	host, peers := makeRing(t, 10)
 
 	fname := "testfile"
 	fcontent := randString(4096)
-	shardSize := int64(len(fcontent)) / dataRSC
-	wCert, err := genCertificate(fname, shardSize, WRITACT)
+	fsize := int64(len(fcontent))
+	wCert, err := genCertificate(fname, fsize, WRITACT)
 	if err != nil {
 		t.Error("Error creating write certificate!", err)
 	}
 
-	rCert, err := genCertificate(fname, shardSize, READACT)
+	rCert, err := genCertificate(fname, fsize, READACT)
 	if err != nil {
 		t.Error("Error creating read certificate!", err)
 	}
 
-	dCert, err := genCertificate(fname, shardSize, DELEACT)
+	dCert, err := genCertificate(fname, fsize, DELEACT)
 	if err != nil {
 		t.Error("Error creating delete certificate!", err)
 	}
 
-	err = UploadFileRSC(host, fname, ringsz, fcontent, wCert)
+	err = UploadFileRSC(host, fname, fcontent, wCert)
 	if err != nil {
 		t.Error("UploadRSC error:", err)
 	}
 
 	f1 := rand.Intn(10)
 	f2 := (f1 + rand.Intn(9) + 1) % 10
-	os.Remove(fmt.Sprintf("%s_rep%d", fname, f1))
-	os.Remove(fmt.Sprintf("%s_rep%d", fname, f2))
+	for _, p := range peers {
+		os.Remove(p.path(fmt.Sprintf("%s_rep%d", fname, f1)))
+		os.Remove(p.path(fmt.Sprintf("%s_rep%d", fname, f2)))
+	}
 
 	fcontentRead := make([]byte, len(fcontent)*2)
 
-	empty, err := DownloadFileRSC(host, fname, ringsz, fcontentRead, rCert)
+	empty, err := DownloadFileRSC(host, fname, fcontentRead, rCert)
 	if err != nil {
 		t.Error("DownloadRSC error:", err)
 	}
@@ -393,9 +503,1653 @@ func TestRSC(t *testing.T) {
 		}
 	}
 
-	err = DeleteFileRSC(host, fname, ringsz, dCert)
+	err = DeleteFileRSC(host, fname, dCert)
 	if err != nil {
 		fmt.Print(err.Error())
 		t.Error(err)
 	}
 }
+
+// Make one peer without registering it on the server
+func makeLocalPeer(t *testing.T, existingIP string) (*Peer, string) {
+	ownIP := IP()
+
+	cfg := testConfig(t, ownIP, existingIP)
+	cfg.Replicas = 1
+	p := startPeer(t, cfg)
+
+	return p, ownIP
+}
+
+func TestHandoff(t *testing.T) {
+
+	p, ownIP := makeLocalPeer(t, "")
+
+	fname := "handoff_test_file"
+	fcontent := randString(3*handoffChunkSize + 17)
+
+	// Previous attempt was interrupted in the middle
+	if err := ioutil.WriteFile(p.path(handoffPartName(fname)), fcontent[:handoffChunkSize+5], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sending side keeps the complete file somewhere else
+	fpath := filepath.Join(tempDir(t), fname)
+	if err := ioutil.WriteFile(fpath, fcontent, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys that are not ours are refused
+	if err := handoffFile(ownIP, fpath, fname); err == nil {
+		t.Error("Handoff of a key that isn't in the key list succeeded")
+	}
+
+	p.ring.SaveKey(fname)
+
+	if err := handoffFile(ownIP, fpath, fname); err != nil {
+		t.Fatal("Handoff failed:", err)
+	}
+
+	if _, err := os.Stat(p.path(handoffPartName(fname))); !os.IsNotExist(err) {
+		t.Error("Partial file is left after complete handoff")
+	}
+
+	fcontentRead, err := ioutil.ReadFile(p.path(fname))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(fcontentRead, fcontent) {
+		t.Error("Content after resumed handoff doesn't match")
+	}
+}
+
+func TestReplication(t *testing.T) {
+
+	p, ownIP := makeLocalPeer(t, "")
+
+	fname := "replication_test_file"
+	fcontent := randString(2*handoffChunkSize + 3)
+
+	if err := ioutil.WriteFile(p.path(fname), fcontent, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replicateFile(ownIP, p.path(fname), fname); err != nil {
+		t.Fatal("Replication failed:", err)
+	}
+
+	replica, err := ioutil.ReadFile(p.path(replicaName(fname)))
+	if err != nil {
+		t.Fatal("Replica wasn't stored:", err)
+	}
+
+	if !bytes.Equal(replica, fcontent) {
+		t.Error("Replica content doesn't match")
+	}
+
+	// Owner died together with the shard, replica has to take its place
+	os.Remove(p.path(fname))
+	p.ring.SaveKey(fname)
+	p.promoteReplica(fname)
+
+	promoted, err := ioutil.ReadFile(p.path(fname))
+	if err != nil {
+		t.Fatal("Replica wasn't promoted:", err)
+	}
+
+	if !bytes.Equal(promoted, fcontent) {
+		t.Error("Promoted content doesn't match")
+	}
+
+	// Without a replica key is forgotten
+	lost := "replication_lost_file"
+	p.ring.SaveKey(lost)
+	p.promoteReplica(lost)
+
+	if p.ring.HasKey(lost) {
+		t.Error("Key without data is still in the key list")
+	}
+
+	// Names can't leave the replica directory
+	for _, name := range []string{"../" + fname, "/tmp/" + fname, "a/../../" + fname} {
+		if err := replicateFile(ownIP, p.path(fname), name); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Replication as %s returned %v, want InvalidArgument", name, err)
+		}
+		if err := dropReplicaOn(ownIP, name); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Drop of %s returned %v, want InvalidArgument", name, err)
+		}
+	}
+	if _, err := os.Stat(p.path(fname)); err != nil {
+		t.Error("Shard was removed through a replica name:", err)
+	}
+}
+
+func TestAntiEntropy(t *testing.T) {
+
+	owner, ownerIP := makeLocalPeer(t, "")
+	holder, _ := makeLocalPeer(t, ownerIP)
+
+	// Find a name that the owner is responsible for
+	fname := ""
+	start, end := owner.ring.Range()
+	for i := 0; fname == ""; i++ {
+		name := fmt.Sprintf("antientropy_test_file%d", i)
+		if dht.InRange(start, end, dht.Hash([]byte(name))) {
+			fname = name
+		}
+	}
+
+	if err := ioutil.WriteFile(owner.path(fname), randString(1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Key was saved but never replicated
+	owner.ring.SaveKey(fname)
+
+	if under := owner.antiEntropy(); under != 0 {
+		t.Error("Got", under, "under-replicated keys after repair, want 0")
+	}
+
+	if !inSlice(holder.ring.ReplicaKeys(), fname) {
+		t.Error("Successor didn't get the missing replica")
+	}
+
+	// Replica got corrupted
+	ioutil.WriteFile(holder.path(replicaName(fname)), randString(10), 0644)
+	holder.ring.SetKeyDigest(fname, []byte("corrupted"))
+	owner.antiEntropy()
+
+	if !bytes.Equal(holder.ring.KeyDigest(fname), owner.ring.KeyDigest(fname)) {
+		t.Error("Outdated replica wasn't replaced")
+	}
+
+	// There are not enough nodes in the ring for three copies
+	owner.replicas = 3
+	if under := owner.antiEntropy(); under != 1 {
+		t.Error("Got", under, "under-replicated keys, want 1")
+	}
+
+	// Nobody should keep copies
+	owner.replicas = 0
+	owner.antiEntropy()
+
+	if inSlice(holder.ring.ReplicaKeys(), fname) {
+		t.Error("Extra replica wasn't trimmed")
+	}
+}
+
+func inSlice(slice []string, key string) bool {
+	for _, k := range slice {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRestart(t *testing.T) {
+
+	dataDir := tempDir(t)
+
+	first, firstIP := makeLocalPeer(t, "")
+	ownIP := IP()
+	firstID := first.ring.ID()
+	// Saved id has nothing to do with the IP, it's on the other side of the ring
+	ownID := firstID
+	ownID[0] ^= 0x80
+
+	// Shards left from the previous run, one of them is in the range of the other node now
+	var ownKey, foreignKey string
+	for i := 0; ownKey == "" || foreignKey == ""; i++ {
+		name := fmt.Sprintf("restart_test_file_%d", i)
+		mine := dht.InRange(firstID, ownID, dht.Hash([]byte(name)))
+		if mine && ownKey == "" {
+			ownKey = name
+		} else if !mine && foreignKey == "" {
+			foreignKey = name
+		}
+	}
+
+	content := randString(1000)
+	for _, name := range []string{ownKey, foreignKey} {
+		if err := ioutil.WriteFile(filepath.Join(dataDir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Node was on another address before the restart
+	state, _ := json.Marshal(nodeState{IP: "127.0.0.1:2", ID: ownID, Neighbours: []string{"127.0.0.1:1", firstIP}})
+	if err := ioutil.WriteFile(filepath.Join(dataDir, stateFile), state, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No entry point given, the node has to find the ring through its saved neighbours
+	p := startPeer(t, Config{OwnIP: ownIP, ListeningIP: ownIP, DeltaT: time.Second, Replicas: 1, Insecure: true, JWKS: testJWKS, DataDir: dataDir})
+
+	if succ := p.ring.Successors(); len(succ) == 0 || succ[0] != firstIP {
+		t.Fatalf("Node didn't rejoin the ring, successors: %v", succ)
+	}
+
+	if p.ring.ID() != ownID {
+		t.Errorf("Node got id %s, want saved %s", p.ring.ID(), ownID)
+	}
+
+	if !p.ring.HasKey(ownKey) {
+		t.Errorf("Key %s wasn't restored", ownKey)
+	}
+
+	if p.ring.HasKey(foreignKey) || !first.ring.HasKey(foreignKey) {
+		t.Errorf("Key %s wasn't given to its owner", foreignKey)
+	}
+
+	// Data follows the key
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, err := ioutil.ReadFile(first.path(foreignKey))
+		if err == nil && bytes.Equal(got, content) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Shard %s wasn't handed over", foreignKey)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	saved, err := p.loadState()
+	if err != nil || saved == nil {
+		t.Fatalf("State wasn't saved: %v", err)
+	}
+	if saved.IP != ownIP || saved.ID != ownID || !inSlice(saved.Keys, ownKey) || !inSlice(saved.Neighbours, firstIP) {
+		t.Errorf("Saved state is wrong: %+v", saved)
+	}
+}
+
+// TestStop checks that routines of the node end with it
+func TestStop(t *testing.T) {
+
+	ownIP := IP()
+	p := newPeer(Config{OwnIP: ownIP, ListeningIP: ownIP, Replicas: 1, Insecure: true, JWKS: testJWKS, DataDir: tempDir(t)})
+	if p.deltaT != MinDeltaT {
+		t.Errorf("Routines run every %v, want %v", p.deltaT, MinDeltaT)
+	}
+
+	p.Stop()
+	p.Stop()
+	<-p.Errs
+	if _, ok := <-p.Errs; ok {
+		t.Error("Server of a stopped node still runs")
+	}
+
+	// Nothing saves the state of a stopped node
+	os.Remove(p.path(stateFile))
+	p.ring.RestoreKeys([]string{"stop_test_file"}, nil)
+	time.Sleep(3 * MinDeltaT)
+	if _, err := os.Stat(p.path(stateFile)); !os.IsNotExist(err) {
+		t.Errorf("State of a stopped node was saved: %v", err)
+	}
+}
+
+func TestVirtualNodes(t *testing.T) {
+
+	// Positions are weighted by capacity unless set explicitly
+	for _, c := range []struct {
+		cfg  Config
+		want int
+	}{
+		{Config{}, 1},
+		{Config{Capacity: 1}, 1},
+		{Config{Capacity: 3 * BytesPerVirtualNode}, 3},
+		{Config{Capacity: 1000 * BytesPerVirtualNode}, MaxVirtualNodes},
+		{Config{VirtualNodes: 5, Capacity: BytesPerVirtualNode}, 5},
+	} {
+		if got := virtualNodes(c.cfg); got != c.want {
+			t.Errorf("Config %+v gives %d virtual nodes, want %d", c.cfg, got, c.want)
+		}
+	}
+
+	// Ports after this one are taken by the virtual nodes
+	ownIP := "127.0.0.1:9500"
+	cfg := testConfig(t, ownIP, "")
+	cfg.Replicas, cfg.VirtualNodes = 1, 3
+	p := startPeer(t, cfg)
+
+	if len(p.virtual) != 2 {
+		t.Fatalf("Got %d virtual nodes, want 2", len(p.virtual))
+	}
+
+	ids := map[dht.ID]bool{p.ring.ID(): true}
+	for _, v := range p.virtual {
+		ids[v.ring.ID()] = true
+		if !inSlice(p.ring.Neighbours(), v.ownIP) && !inSlice(v.ring.Neighbours(), ownIP) {
+			t.Errorf("Virtual node %s isn't on the ring", v.ownIP)
+		}
+	}
+	if len(ids) != 3 {
+		t.Errorf("Positions share ids: %v", ids)
+	}
+
+	// Only our own positions around, nobody to keep the copies
+	if holders := p.replicaHolders(); len(holders) != 0 {
+		t.Errorf("Replicas are kept on our own positions: %v", holders)
+	}
+
+	// Another physical node becomes the holder for every position
+	otherIP := "127.0.0.1:9510"
+	other := testConfig(t, otherIP, ownIP)
+	other.Replicas = 1
+	startPeer(t, other)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, v := range append(p.virtual, p) {
+		for {
+			holders := v.replicaHolders()
+			if len(holders) == 1 && holders[0] == otherIP {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s keeps replicas on %v, want [%s]", v.ownIP, holders, otherIP)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+func TestQuota(t *testing.T) {
+
+	ownIP := IP()
+	cfg := testConfig(t, ownIP, "")
+	cfg.Replicas, cfg.Capacity = 1, 100
+	p := startPeer(t, cfg)
+	other, otherIP := makeLocalPeer(t, ownIP)
+
+	// Writes over the quota are refused before anything is stored
+	fname := "quota_test_file"
+	wCert, err := genCertificate(fname, 200, WRITACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sendFile(ownIP, fname, randString(200), wCert, true)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Write over quota returned %v, want ResourceExhausted", err)
+	}
+	if _, err := os.Stat(p.path(fname)); !os.IsNotExist(err) {
+		t.Errorf("Refused shard %s is on disk", fname)
+	}
+
+	// Copies take space too
+	fpath := filepath.Join(tempDir(t), fname)
+	if err := ioutil.WriteFile(fpath, randString(60), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := replicateFile(ownIP, fpath, fname); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := p.Stats(context.Background(), &StatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Capacity != 100 || stats.Used != 60 {
+		t.Errorf("Stats report %d of %d bytes used, want 60 of 100", stats.Used, stats.Capacity)
+	}
+
+	// Full node doesn't take copies or shards handed over to it
+	fullName := "quota_full_file"
+	fullPath := filepath.Join(tempDir(t), fullName)
+	if err := ioutil.WriteFile(fullPath, randString(60), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := replicateFile(ownIP, fullPath, fullName); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Replication to a full node returned %v, want ResourceExhausted", err)
+	}
+	p.ring.SaveKey(fullName)
+	if err := handoffFile(ownIP, fullPath, fullName); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Handoff to a full node returned %v, want ResourceExhausted", err)
+	}
+	for _, name := range []string{replicaName(fullName), fullName, handoffPartName(fullName), handoffPartName(replicaName(fullName))} {
+		if _, err := os.Stat(p.path(name)); !os.IsNotExist(err) {
+			t.Errorf("Refused %s is on disk", name)
+		}
+	}
+	if used := p.store.usage(); used != 60 {
+		t.Errorf("%d bytes used after refused transfers, want 60", used)
+	}
+	p.ring.RemoveKey(fullName)
+
+	if err := dropReplicaOn(ownIP, fname); err != nil {
+		t.Fatal(err)
+	}
+	if used := p.store.usage(); used != 0 {
+		t.Errorf("%d bytes used after the copy was dropped", used)
+	}
+
+	// Uploads learn where to go when the owner is full
+	targets, err := findTargetsWithRingIP(otherIP, p.ring.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) < 2 || targets[0] != ownIP || targets[1] != otherIP {
+		t.Errorf("Got targets %v, want [%s %s ...]", targets, ownIP, otherIP)
+	}
+
+	// Node that follows the owner takes its shards only when the owner is full for real
+	start, end := p.ring.Range()
+	overflowName := ""
+	for i := 0; overflowName == ""; i++ {
+		if name := fmt.Sprintf("quota_overflow_file%d", i); dht.InRange(start, end, dht.Hash([]byte(name))) {
+			overflowName = name
+		}
+	}
+
+	small, err := genCertificate(overflowName, 10, WRITACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sendFile(otherIP, overflowName, randString(10), small, true)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Overflow write while the owner has room returned %v, want FailedPrecondition", err)
+	}
+
+	big, err := genCertificate(overflowName, 200, WRITACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendFile(otherIP, overflowName, randString(200), big, true); err != nil {
+		t.Errorf("Overflow write for a full owner failed: %v", err)
+	}
+
+	// Node without a quota takes anything
+	if !other.store.fits(1 << 40) {
+		t.Error("Node without a quota is full")
+	}
+}
+
+func TestRouteCache(t *testing.T) {
+
+	p, ownIP := makeLocalPeer(t, "")
+	deadIP := IP()
+	fname := "routed_rep0"
+	id := dht.Hash([]byte(fname))
+
+	// Whole ring goes to a node that isn't there
+	routes.put(ownIP, p.ring.ID(), p.ring.ID(), []string{deadIP})
+	if cached, ok := routes.get(ownIP, id); !ok || cached.targets[0] != deadIP {
+		t.Fatalf("Route wasn't cached: %v", cached.targets)
+	}
+
+	// Unreachable owner is dropped and the ring is asked again
+	_, err := downloadFile(ownIP, fname, make([]byte, 10), "")
+	if err != os.ErrNotExist {
+		t.Errorf("Download returned %v, want %v", err, os.ErrNotExist)
+	}
+	cached, ok := routes.get(ownIP, id)
+	if !ok || cached.targets[0] != ownIP {
+		t.Errorf("Route after the lookup: %v", cached.targets)
+	}
+
+	// Overlapping ranges replace each other, expired ones are gone
+	c := newRouteCache(50 * time.Millisecond)
+	c.put(ownIP, dht.Hash([]byte("a")), dht.Hash([]byte("b")), []string{"first"})
+	c.put(ownIP, dht.Hash([]byte("b")), dht.Hash([]byte("a")), []string{"second"})
+	c.put(ownIP, dht.Hash([]byte("a")), dht.Hash([]byte("a")), []string{"whole"})
+	if len(c.routes[ownIP]) != 1 {
+		t.Errorf("%d routes after overlapping puts", len(c.routes[ownIP]))
+	}
+	c.invalidate(ownIP, id)
+	if _, ok := c.get(ownIP, id); ok {
+		t.Error("Invalidated route is still there")
+	}
+	c.put(ownIP, dht.Hash([]byte("a")), dht.Hash([]byte("a")), []string{"whole"})
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := c.get(ownIP, id); ok {
+		t.Error("Expired route is still there")
+	}
+}
+
+func TestRedirect(t *testing.T) {
+
+	first, ownIP := makeLocalPeer(t, "")
+	second, otherIP := makeLocalPeer(t, ownIP)
+	peers := []*Peer{first, second}
+
+	// Names the other node is responsible for
+	var names []string
+	for i := 0; len(names) < 2; i++ {
+		name := fmt.Sprintf("redirect_test_file_%d", i)
+		if peers[1].responsible(name) {
+			names = append(names, name)
+		}
+	}
+	fname, missing := names[0], names[1]
+	id := dht.Hash([]byte(fname))
+
+	// Node refuses what it doesn't own and says who to ask
+	wCert, err := genCertificate(fname, 100, WRITACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sendFile(ownIP, fname, randString(100), wCert, false)
+	if r, ok := err.(*redirectError); !ok || r.owner != otherIP || status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Write to a wrong node returned %v, want a redirect to %s", err, otherIP)
+	}
+	if peers[0].ring.HasKey(fname) {
+		t.Error("Wrong node stored the shard")
+	}
+
+	// Upload with a stale route follows the redirect
+	routes.put(ownIP, peers[0].ring.ID(), peers[0].ring.ID(), []string{ownIP})
+	if err := uploadFile(ownIP, fname, randString(100), wCert); err != nil {
+		t.Fatal(err)
+	}
+	if !peers[1].ring.HasKey(fname) {
+		t.Error("Owner doesn't have the shard")
+	}
+	if _, ok := routes.get(ownIP, id); ok {
+		t.Error("Route that led to a redirect is still cached")
+	}
+
+	// Missing shard is looked for at its owner
+	_, err = recvFile(ownIP, missing, make([]byte, 10), "", false)
+	if r, ok := err.(*redirectError); !ok || r.owner != otherIP {
+		t.Errorf("Read from a wrong node returned %v, want a redirect to %s", err, otherIP)
+	}
+	_, err = recvFile(ownIP, missing, make([]byte, 10), "", true)
+	if err != os.ErrNotExist {
+		t.Errorf("Read of a passed on shard returned %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+// Write a PEM certificate for 127.0.0.1 and its key, signed by parent (self-signed if nil)
+func writeCert(t *testing.T, dir string, name string, unit string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(rand.Int63()),
+		Subject:               pkix.Name{CommonName: name, OrganizationalUnit: []string{unit}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestTLS(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "peer_tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeCert(t, dir, "ca", "", true, nil, nil)
+	writeCert(t, dir, "node", dht.NodeUnit, false, ca, caKey)
+	writeCert(t, dir, "other", dht.NodeUnit, false, ca, caKey)
+	writeCert(t, dir, "client", "", false, ca, caKey)
+	writeCert(t, dir, "rogue", dht.NodeUnit, false, nil, nil)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	load := func(name string) *tls.Config {
+		conf, err := loadTLS(file("ca.pem"), file(name+".pem"), file(name+".key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conf
+	}
+	conf := load("node")
+
+	// Ring node served over mutual TLS only
+	ip := IP()
+	ring := dht.NewRingNode(ip, time.Minute)
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(conf)), grpc.UnaryInterceptor(unaryNodeOnly), grpc.StreamInterceptor(streamNodeOnly))
+	ring.Start(srv)
+	lis, err := net.Listen("tcp", ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	defer srv.Stop()
+	ring.Join("")
+
+	call := func(opts ...grpc.DialOption) (dht.RingServiceClient, func()) {
+		p := pool.New(time.Minute, opts...)
+		conn, release, err := p.Get(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dht.NewRingServiceClient(conn), func() { release(); p.Close() }
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Node with a certificate of the CA gets in
+	cl, done := call(grpc.WithTransportCredentials(credentials.NewTLS(conf)))
+	defer done()
+	if _, err := cl.GetNodeSelf(ctx, &dht.GetNodeSelfRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// but can't claim an address its certificate isn't issued for
+	_, err = cl.UpdatePredecessor(ctx, &dht.UpdatePredRequest{IP: "10.0.0.1:9000", ID: dht.NewNodeID().Bytes()})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Claim of another address returned %v, want PermissionDenied", err)
+	}
+
+	// Id belongs to the node that claimed it first
+	id := dht.NewNodeID().Bytes()
+	if _, err := cl.UpdateSpecificFinger(ctx, &dht.UpdateSpecificFingerRequest{IP: "127.0.0.1:1", ID: id}); err != nil {
+		t.Fatal(err)
+	}
+	cl, done = call(grpc.WithTransportCredentials(credentials.NewTLS(load("other"))))
+	defer done()
+	_, err = cl.UpdateSpecificFinger(ctx, &dht.UpdateSpecificFingerRequest{IP: "127.0.0.1:1", ID: id})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Claim of a taken id returned %v, want PermissionDenied", err)
+	}
+
+	// Clients of the same CA don't get to the ring
+	cl, done = call(grpc.WithTransportCredentials(credentials.NewTLS(load("client"))))
+	defer done()
+	if _, err := cl.GetNodeSelf(ctx, &dht.GetNodeSelfRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Client call of the ring returned %v, want PermissionDenied", err)
+	}
+
+	// Certificate from another CA and plaintext are refused
+	cl, done = call(grpc.WithTransportCredentials(credentials.NewTLS(load("rogue"))))
+	defer done()
+	if _, err := cl.GetNodeSelf(ctx, &dht.GetNodeSelfRequest{}); err == nil {
+		t.Error("Node with a foreign certificate got in")
+	}
+
+	cl, done = call(grpc.WithInsecure())
+	defer done()
+	if _, err := cl.GetNodeSelf(ctx, &dht.GetNodeSelfRequest{}); err == nil {
+		t.Error("Plaintext client got in")
+	}
+}
+
+// TestTokens checks that nodes trust only tokens signed by their keys
+func TestTokens(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "peer_tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(crand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, forgedKey, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Old key is still around while the new one is rolled out
+	jwks := filepath.Join(dir, "jwks.json")
+	if err = writeJWKS(jwks, map[string]interface{}{"old": &rsaKey.PublicKey, "new": edPub}); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := newKeySet(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(exp time.Time, nbf time.Time) *FileClaim {
+		c := &FileClaim{Name: "token_test_file", Size: 100, Act: WRITACT}
+		c.ExpiresAt = exp.Unix()
+		c.NotBefore = nbf.Unix()
+		return c
+	}
+	valid := claims(now.Add(time.Hour), now.Add(-time.Minute))
+
+	sign := func(method jwt.SigningMethod, key interface{}, kid string, c *FileClaim) string {
+		token, err := signToken(method, key, kid, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	oldToken := sign(jwt.SigningMethodRS256, rsaKey, "old", valid)
+
+	for name, token := range map[string]string{
+		"EdDSA": sign(SigningMethodEdDSA, edKey, "new", valid),
+		"RS256": oldToken,
+	} {
+		if c, err := ks.verify(context.Background(), token); err != nil || c.Name != valid.Name {
+			t.Errorf("%s token was refused: %v", name, err)
+		}
+	}
+
+	// Auth server sends the id of the user as a string, a number doesn't fit the subject
+	server := func(sub interface{}) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"exp":  now.Add(time.Hour).Unix(),
+			"iat":  now.Unix(),
+			"sub":  sub,
+			"size": 80,
+			"act":  WRITACT,
+			"name": "server_file",
+		})
+		token.Header["kid"] = "old"
+		signed, err := token.SignedString(rsaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	if c, err := ks.verify(context.Background(), server("42")); err != nil || c.Subject != "42" || c.Size != 80 || c.Act != WRITACT || c.Name != "server_file" {
+		t.Errorf("Token of the auth server was read as %+v: %v", c, err)
+	}
+	if _, _, err := (&Peer{keys: ks}).ValidateFile(context.Background(), nsKey("42", "server_file_rep0"), filepath.Join(dir, "server_file_rep0"), server("42"), WRITACT); err != nil {
+		t.Errorf("Token of the auth server was refused for its namespace: %v", err)
+	}
+	if _, err := ks.verify(context.Background(), server(42)); err == nil {
+		t.Error("Token with a numeric subject was accepted")
+	}
+
+	noExp := claims(now, now)
+	noExp.ExpiresAt = 0
+	for name, token := range map[string]string{
+		"forged":        sign(SigningMethodEdDSA, forgedKey, "new", valid),
+		"wrong key":     sign(SigningMethodEdDSA, edKey, "old", valid),
+		"expired":       sign(SigningMethodEdDSA, edKey, "new", claims(now.Add(-time.Minute), now.Add(-time.Hour))),
+		"not yet valid": sign(SigningMethodEdDSA, edKey, "new", claims(now.Add(time.Hour), now.Add(time.Minute))),
+		"no expiry":     sign(SigningMethodEdDSA, edKey, "new", noExp),
+		"HS256":         sign(jwt.SigningMethodHS256, []byte("qwertyuiopasdfghjklzxcvbnm123456"), "new", valid),
+	} {
+		if _, err := ks.verify(context.Background(), token); err == nil {
+			t.Errorf("%s token was accepted", name)
+		}
+	}
+
+	// Rotated out key isn't trusted anymore
+	if err = writeJWKS(jwks, map[string]interface{}{"new": edPub}); err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.verify(context.Background(), oldToken); err == nil {
+		t.Error("Token of the rotated out key was accepted")
+	}
+
+	// Writes are checked like everything else, nodes without keys trust nobody
+	p := &Peer{keys: ks}
+	forged := sign(SigningMethodEdDSA, forgedKey, "new", valid)
+	if _, _, err := p.ValidateFile(context.Background(), valid.Name, filepath.Join(dir, valid.Name), forged, WRITACT); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Forged write token returned %v, want Unauthenticated", err)
+	}
+	good := sign(SigningMethodEdDSA, edKey, "new", valid)
+	if _, _, err := p.ValidateFile(context.Background(), valid.Name, filepath.Join(dir, valid.Name), good, WRITACT); err != nil {
+		t.Errorf("Write token was refused: %v", err)
+	}
+	if _, _, err := p.ValidateFile(context.Background(), valid.Name, filepath.Join(dir, valid.Name), good, DELEACT); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Write token used for delete returned %v, want PermissionDenied", err)
+	}
+	if _, _, err := (&Peer{}).ValidateFile(context.Background(), valid.Name, filepath.Join(dir, valid.Name), good, WRITACT); err == nil {
+		t.Error("Node without keys accepted a token")
+	}
+
+	// Key server that doesn't answer holds the request only as long as its context
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+	stuck := &keySet{source: hanging.URL}
+	stuck.keys.Store(map[string]interface{}{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := stuck.verify(ctx, good); err == nil {
+		t.Error("Token was accepted without keys")
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("Reload of the keys held the request for %v", waited)
+	}
+}
+
+// TestNameBinding checks that certificates are good only for their files
+func TestNameBinding(t *testing.T) {
+
+	for shard, base := range map[string]string{
+		"file":               "file",
+		"file_rep0":          "file",
+		"my_file_rep12":      "my",
+		"file_a_rep3":        "file",
+		"file_ab_manifest":   "file",
+		"docs/my_file_rep0":  "docs/my",
+		"file_rep1_rep2":     "file_rep1",
+		"file_rep":           "file_rep",
+		"file_rep3a":         "file_rep3a",
+		"file_REP3":          "file_REP3",
+		"docs/report_rep":    "docs/report_rep",
+		"docs/a_rep7":        "docs/a",
+		"file_manifest":      "file",
+		"file_rep0_manifest": "file_rep0",
+		"file_Ab_rep3":       "file_Ab",
+	} {
+		got, err := getBaseName(shard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != base {
+			t.Errorf("Base name of %s is %s, want %s", shard, got, base)
+		}
+	}
+
+	for _, c := range []struct {
+		cert, base string
+		ok         bool
+	}{
+		{"file", "file", true},
+		{"file", "file2", false},
+		{"file", "fil", false},
+		{"build_*", "build_42", true},
+		{"build_*", "test_42", false},
+		{"docs/", "docs/report", true},
+		{"docs/", "docs", false},
+		{"docs/", "docs/", false},
+		{"docs/", "other/report", false},
+		{"*", "file", false},
+		{"", "", false},
+	} {
+		if nameAllowed(c.cert, c.base) != c.ok {
+			t.Errorf("Certificate for %q allows %q: %v, want %v", c.cert, c.base, !c.ok, c.ok)
+		}
+	}
+
+	ks, err := newKeySet(testJWKS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Peer{keys: ks}
+
+	// Shards of the file are covered, other files aren't
+	wCert, err := genCertificate("bound_file", 100, WRITACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for shard, ok := range map[string]bool{"bound_file_rep0": true, "bound_file_rep5": true, "bound_file": true, "other_file_rep0": false, "bound_file2_rep0": false, "bound_file_manifest": true} {
+		_, _, err := p.ValidateFile(context.Background(), shard, shard, wCert, WRITACT)
+		if ok && err != nil {
+			t.Errorf("Certificate of bound_file refused for %s: %v", shard, err)
+		}
+		if !ok && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Certificate of bound_file for %s returned %v, want PermissionDenied", shard, err)
+		}
+	}
+
+	rCert, err := genCertificate("bound_file", 100, READACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.ValidateFile(context.Background(), "secret_file_rep0", "secret_file_rep0", rCert, READACT); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Read certificate of another file returned %v, want PermissionDenied", err)
+	}
+
+	// C++ client uploads chunks of the file with the token of the whole file
+	chunkCert, err := genCertificate("movie", 1000, WRITACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for shard, ok := range map[string]bool{"movie_a_rep3": true, "movie_ab_manifest": true, "movie_rep0": true, "moviea_rep0": false, "movie_a_b_rep0": false} {
+		_, _, err := p.ValidateFile(context.Background(), shard, shard, chunkCert, WRITACT)
+		if ok && err != nil {
+			t.Errorf("Certificate of movie refused for %s: %v", shard, err)
+		}
+		if !ok && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Certificate of movie for %s returned %v, want PermissionDenied", shard, err)
+		}
+	}
+}
+
+// TestSizeLimit checks that writes stop at the size the certificate allows
+func TestSizeLimit(t *testing.T) {
+
+	for _, c := range []struct {
+		shard, base string
+		size, limit int64
+	}{
+		{"f", "f", 801, 817},
+		{"f_rep0", "f", 800, 102},
+		{"f_rep9", "f", 801, 103},
+		{"f_rep0", "f", 2 * stripeSize, (2*stripeSize + 2*sealOverhead) / dataRSC},
+		{"f_rep1", "f", 0, 0},
+		{"f_manifest", "f", 10, maxManifestSize},
+	} {
+		if limit := shardLimit(c.shard, c.base, c.size); limit != c.limit {
+			t.Errorf("Shard %s of %d bytes may take %d bytes, want %d", c.shard, c.size, limit, c.limit)
+		}
+	}
+
+	p, ownIP := makeLocalPeer(t, "")
+
+	// File of 80 bytes has 10 bytes in each shard, 12 once the tag of encryption is added
+	fname := "limit_test_file_rep0"
+	wCert, err := genCertificate("limit_test_file", 80, WRITACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fcontent := randString(12)
+	if err := sendFile(ownIP, fname, fcontent, wCert, true); err != nil {
+		t.Fatal(err)
+	}
+	err = sendFile(ownIP, fname, randString(13), wCert, true)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Write over the certificate size returned %v, want ResourceExhausted", err)
+	}
+
+	// Announced size doesn't matter, received bytes do
+	conn, err := grpc.Dial(ownIP, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	wstream, err := NewPeerServiceClient(conn).Write(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wstream.Send(&WriteRequest{Name: fname, Certificate: wCert, Size: 5, Overflow: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := wstream.Send(&WriteRequest{Data: randString(chunksz)}); err != nil {
+			break
+		}
+	}
+	if _, err := wstream.CloseAndRecv(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Stream over the certificate size returned %v, want ResourceExhausted", err)
+	}
+
+	// Refused writes leave the shard that was there before
+	if stored, err := ioutil.ReadFile(p.path(fname)); err != nil || !bytes.Equal(stored, fcontent) {
+		t.Errorf("Shard %s changed after refused writes: %v", fname, err)
+	}
+	if files, _ := filepath.Glob(p.path(fname + "*" + writeSuffix)); len(files) != 0 {
+		t.Errorf("Refused writes left %v", files)
+	}
+}
+
+// TestAuthCache checks that answers of the auth server are kept and revocations win over them
+func TestAuthCache(t *testing.T) {
+
+	var calls int32
+	var down int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		valid := !strings.Contains(string(body), "bad")
+		json.NewEncoder(w).Encode(FileValidationResponse{Valid: valid, Message: "told so"})
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "peer_auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	revoked := filepath.Join(dir, "revoked.json")
+
+	a := newTokenAuth(srv.URL, revoked, time.Hour)
+	claims := func(id string) *FileClaim {
+		c := &FileClaim{Name: "auth_test_file", Act: READACT}
+		c.Id = id
+		c.ExpiresAt = time.Now().Add(time.Hour).Unix()
+		return c
+	}
+
+	// Server is asked once per token
+	for i := 0; i < 3; i++ {
+		if err := a.check("token_good", claims("good"), READACT); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Server was asked %d times, want 1", n)
+	}
+	if err := a.check("token_bad", claims("bad"), READACT); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Token refused by the server returned %v, want PermissionDenied", err)
+	}
+
+	// Revoked token is refused even if the server confirmed it
+	if err := ioutil.WriteFile(revoked, []byte(`["good"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.reloadRevocations(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.check("token_good", claims("good"), READACT); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Revoked token returned %v, want PermissionDenied", err)
+	}
+
+	// Writes don't ask the server, but revoked tokens can't write
+	p, _ := makeStoragePeer(t)
+	p.auth.mu.Lock()
+	p.auth.revoked = map[string]bool{"good": true}
+	p.auth.mu.Unlock()
+	wClaims := claims("good")
+	wClaims.Act = WRITACT
+	wCert, err := signToken(SigningMethodEdDSA, testKey, "test", wClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.ValidateFile(context.Background(), "auth_test_file", p.path("auth_test_file"), wCert, WRITACT); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Write with a revoked token returned %v, want PermissionDenied", err)
+	}
+
+	// Reads go on while the server is down, but only for the grace period
+	atomic.StoreInt32(&down, 1)
+	if err := a.check("token_other", claims("other"), READACT); err != nil {
+		t.Errorf("Read during the grace period was refused: %v", err)
+	}
+	if err := a.check("token_other", claims("other"), DELEACT); status.Code(err) != codes.Unavailable {
+		t.Errorf("Delete while the server is down returned %v, want Unavailable", err)
+	}
+	a.mu.Lock()
+	a.lastSeen = time.Now().Add(-2 * time.Hour)
+	a.mu.Unlock()
+	if err := a.check("token_other", claims("other"), READACT); status.Code(err) != codes.Unavailable {
+		t.Errorf("Read after the grace period returned %v, want Unavailable", err)
+	}
+}
+
+// TestCapabilities checks tokens that cover many files and actions
+func TestCapabilities(t *testing.T) {
+
+	capability := func(c *FileClaim) string {
+		c.ExpiresAt = time.Now().Add(time.Hour).Unix()
+		token, err := signToken(SigningMethodEdDSA, testKey, "test", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	p, ownIP := makeLocalPeer(t, "")
+	ctx := context.Background()
+
+	// Actions and scopes
+	rw := capability(&FileClaim{Acts: []int8{READACT, WRITACT}, Scopes: []string{"builds/", "logs_*.txt"}})
+	for _, c := range []struct {
+		shard  string
+		action int8
+		ok     bool
+	}{
+		{"builds/app_rep0", WRITACT, true},
+		{"builds/nested/app_rep3", WRITACT, true},
+		{"logs_monday.txt", WRITACT, true},
+		{"logs_monday.txt_rep1", WRITACT, true},
+		{"logs_monday.csv", WRITACT, false},
+		{"other/app_rep0", WRITACT, false},
+		{"builds/app_rep0", DELEACT, false},
+		{"builds/../../app_rep0", WRITACT, false},
+	} {
+		_, _, err := p.ValidateFile(ctx, c.shard, c.shard, rw, c.action)
+		if c.ok && err != nil {
+			t.Errorf("Capability refused action %d on %s: %v", c.action, c.shard, err)
+		}
+		if !c.ok && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Capability for action %d on %s returned %v, want PermissionDenied", c.action, c.shard, err)
+		}
+	}
+
+	// Quota is shared by all writes of the token on the node
+	quota := capability(&FileClaim{Acts: []int8{WRITACT}, Scopes: []string{"quota_*"}, Quota: 30})
+	if err := sendFile(ownIP, "quota_a", randString(20), quota, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendFile(ownIP, "quota_b", randString(20), quota, true); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Write over the token quota returned %v, want PermissionDenied", err)
+	}
+	if _, limit, err := p.ValidateFile(ctx, "quota_b", "quota_b", quota, WRITACT); err != nil || limit != 10 {
+		t.Errorf("Token has %d bytes left (%v), want 10", limit, err)
+	}
+
+	// Clients don't go to the successors when the quota is used up, they count it as well
+	if err := sendFile(ownIP, "quota_b", randString(10), quota, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.ValidateFile(ctx, "quota_b", "quota_b", quota, WRITACT); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Token with the quota used up returned %v, want PermissionDenied", err)
+	}
+	if err := uploadFile(ownIP, "quota_c", randString(5), quota); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Upload with the quota used up returned %v, want PermissionDenied", err)
+	}
+
+	// Bound token works only with the certificate of its client
+	cert := &x509.Certificate{Raw: []byte("client certificate")}
+	sum := sha256.Sum256(cert.Raw)
+	bound := capability(&FileClaim{Acts: []int8{WRITACT}, Scopes: []string{"*"}, Cnf: &Confirmation{X5t: base64.RawURLEncoding.EncodeToString(sum[:])}})
+
+	withCert := func(certs ...*x509.Certificate) context.Context {
+		info := credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: certs}}
+		return grpcpeer.NewContext(ctx, &grpcpeer.Peer{AuthInfo: info})
+	}
+	if _, _, err := p.ValidateFile(withCert(cert), "bound_file", "bound_file", bound, WRITACT); err != nil {
+		t.Errorf("Bound token refused for its client: %v", err)
+	}
+	for name, ctx := range map[string]context.Context{
+		"another certificate": withCert(&x509.Certificate{Raw: []byte("other certificate")}),
+		"no certificate":      ctx,
+	} {
+		if _, _, err := p.ValidateFile(ctx, "bound_file", "bound_file", bound, WRITACT); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Bound token with %s returned %v, want PermissionDenied", name, err)
+		}
+	}
+}
+
+// Make one peer with its own data directory and an auth server that trusts every token
+func makeStoragePeer(t *testing.T) (*Peer, string) {
+
+	p, ownIP := makeLocalPeer(t, "")
+
+	return trustAll(p), ownIP
+}
+
+// TestNamespaces checks that users with the same file names don't see each other's files
+func TestNamespaces(t *testing.T) {
+
+	for key, split := range map[string][2]string{
+		"report.pdf":            {"", "report.pdf"},
+		"@alice/report.pdf":     {"alice", "report.pdf"},
+		"@alice/docs/a.txt":     {"alice", "docs/a.txt"},
+		"@/report.pdf":          {"", "@/report.pdf"},
+		"@alice":                {"", "@alice"},
+		"alice/report.pdf":      {"", "alice/report.pdf"},
+		"@alice/report.pdf_rep": {"alice", "report.pdf_rep"},
+	} {
+		if owner, name := splitNamespace(key); owner != split[0] || name != split[1] {
+			t.Errorf("%s splits into %q and %q, want %q and %q", key, owner, name, split[0], split[1])
+		}
+	}
+
+	userCert := func(owner string, fname string, fsize int64, act int8) string {
+		c := &FileClaim{Name: fname, Size: fsize, Act: act}
+		c.Subject = owner
+		c.ExpiresAt = time.Now().Add(time.Hour).Unix()
+		token, err := signToken(SigningMethodEdDSA, testKey, "test", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	p, ownIP := makeStoragePeer(t)
+
+	// Both upload a file with the same name
+	fname := "report.pdf"
+	contents := map[string][]byte{"alice": randString(800), "bob": randString(800)}
+	for owner, content := range contents {
+		if err := UploadFileRSC(ownIP, fname, content, userCert(owner, fname, 800, WRITACT)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for owner, content := range contents {
+		if !p.ring.HasKey(getShardName(nsKey(owner, fname), 0)) {
+			t.Errorf("Shard of %s isn't in the namespace of the user", owner)
+		}
+
+		read := make([]byte, 2*len(content))
+		if _, err := DownloadFileRSC(ownIP, fname, read, userCert(owner, fname, 800, READACT)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(read[:len(content)], content) {
+			t.Errorf("%s got somebody else's %s", owner, fname)
+		}
+	}
+
+	// Nodes don't let users into namespaces of others
+	shard := getShardName(nsKey("alice", fname), 0)
+	for name, cert := range map[string]string{
+		"another user":        userCert("bob", fname, 800, WRITACT),
+		"token without owner": userCert("", shard, 800, WRITACT),
+		"owner with a slash":  userCert("alice/..", fname, 800, WRITACT),
+	} {
+		if _, _, err := p.ValidateFile(context.Background(), shard, p.path(shard), cert, WRITACT); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Write to the namespace of alice with a token of %s returned %v, want PermissionDenied", name, err)
+		}
+	}
+	if _, _, err := p.ValidateFile(context.Background(), fname+"_rep0", p.path(fname+"_rep0"), userCert("alice", fname, 800, WRITACT), WRITACT); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("User wrote outside of the namespace: %v", err)
+	}
+
+	// Files stored before namespaces stay out of reach unless the node has LegacyNames
+	old := "old_report.pdf"
+	content := randString(800)
+	read := make([]byte, 2*len(content))
+	if err := UploadFileRSC(ownIP, old, content, userCert("", old, 800, WRITACT)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DownloadFileRSC(ownIP, old, read, userCert("alice", old, 800, READACT)); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Read of a plain name returned %v, want PermissionDenied", err)
+	}
+	if err := DeleteFileRSC(ownIP, "missing.pdf", userCert("alice", "missing.pdf", 800, DELEACT)); err != nil {
+		t.Errorf("Delete of a missing file failed: %v", err)
+	}
+
+	legacyIP := IP()
+	legacy := testConfig(t, legacyIP, "")
+	legacy.Replicas, legacy.LegacyNames = 1, true
+	lp := trustAll(startPeer(t, legacy))
+
+	if err := UploadFileRSC(legacyIP, old, content, userCert("", old, 800, WRITACT)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DownloadFileRSC(legacyIP, old, read, userCert("alice", old, 800, READACT)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read[:len(content)], content) {
+		t.Errorf("Plain name %s has different content", old)
+	}
+
+	// Any user can have a file of that name, so nobody deletes or writes it
+	if err := DeleteFileRSC(legacyIP, old, userCert("mallory", old, 800, DELEACT)); err != nil {
+		t.Fatal(err)
+	}
+	if !lp.ring.HasKey(getShardName(old, 0)) {
+		t.Errorf("Plain name %s was deleted with a token of a user", old)
+	}
+	for _, act := range []int8{WRITACT, DELEACT} {
+		if _, _, err := lp.ValidateFile(context.Background(), getShardName(old, 0), lp.path(getShardName(old, 0)), userCert("alice", old, 800, act), act); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Action %d on a plain name returned %v, want PermissionDenied", act, err)
+		}
+	}
+}
+
+// TestEncryption checks that nodes get only ciphertext and the key brings the file back
+func TestEncryption(t *testing.T) {
+
+	p, ownIP := makeStoragePeer(t)
+
+	key, err := NewKey([]byte("correct horse battery staple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKey([]byte("short")); err == nil {
+		t.Error("Short secret made a key")
+	}
+
+	// More than one stripe, the last one is shorter
+	fname := "encrypted_test_file"
+	content := bytes.Repeat([]byte("plain text "), 2*stripeSize/10)
+	size := EncryptedSize(int64(len(content)))
+	if size != int64(len(content))+3*sealOverhead {
+		t.Errorf("Encrypted file takes %d bytes, want %d", size, len(content)+3*sealOverhead)
+	}
+
+	if err := UploadFileWithOptions(ownIP, fname, content, genCert(t, fname, size, WRITACT), Options{Key: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shards and manifest don't show the content
+	for i := 0; i < dataRSC+parityRSC; i++ {
+		shard, err := ioutil.ReadFile(p.path(getShardName(fname, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(shard, []byte("plain text")) {
+			t.Errorf("Shard %d has plaintext in it", i)
+		}
+	}
+
+	read := make([]byte, len(content))
+	rCert := genCert(t, fname, size, READACT)
+	if _, err := DownloadFileWithOptions(ownIP, fname, read, rCert, Options{Key: key}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, content) {
+		t.Error("Decrypted file doesn't match")
+	}
+
+	// Without the right key there is nothing to read
+	other, _ := NewKey([]byte("wrong horse battery staple"))
+	if _, err := DownloadFileWithOptions(ownIP, fname, read, rCert, Options{Key: other}); err == nil {
+		t.Error("Wrong key decrypted the file")
+	}
+	if _, err := DownloadFileRSC(ownIP, fname, read, rCert); err != ErrEncrypted {
+		t.Errorf("Download without a key returned %v, want %v", err, ErrEncrypted)
+	}
+
+	// Manifest can't be changed unnoticed
+	raw, err := ioutil.ReadFile(p.path(manifestName(fname)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := manifest{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatal(err)
+	}
+	sealed := make([]byte, (dataRSC+parityRSC)*((m.Stored+dataRSC-1)/dataRSC))
+	if _, err := downloadRSC(ownIP, fname, sealed, rCert); err != nil {
+		t.Fatal(err)
+	}
+	m.Size -= 10
+	if _, err := key.open(fname, m, sealed[:m.Stored]); err == nil {
+		t.Error("Manifest with a wrong size was accepted")
+	}
+
+	// Manifest goes away with the file
+	if err := DeleteFileRSC(ownIP, fname, genCert(t, fname, size, DELEACT)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p.path(manifestName(fname))); !os.IsNotExist(err) {
+		t.Error("Manifest of the deleted file is left")
+	}
+
+	// Auth server issues certificates for the size of the plain file
+	served := "encrypted_served_file"
+	if err := UploadFileWithOptions(ownIP, served, content, genCert(t, served, int64(len(content)), WRITACT), Options{Key: key}); err != nil {
+		t.Fatalf("Encrypted upload with a certificate of the plain size failed: %v", err)
+	}
+	if _, err := DownloadFileWithOptions(ownIP, served, read, genCert(t, served, int64(len(content)), READACT), Options{Key: key}); err != nil || !bytes.Equal(read, content) {
+		t.Errorf("Encrypted file with a certificate of the plain size doesn't match: %v", err)
+	}
+}
+
+// TestHiddenNames checks that nodes don't learn names of files stored under hidden names
+func TestHiddenNames(t *testing.T) {
+
+	p, ownIP := makeStoragePeer(t)
+
+	key, err := NewKey([]byte("correct horse battery staple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewKey([]byte("wrong horse battery staple"))
+	opts := Options{Key: key, HideName: true}
+
+	fname := "secret_plans.txt"
+	hidden := HiddenName(key, fname)
+	if hidden == HiddenName(other, fname) || hidden != HiddenName(key, fname) {
+		t.Error("Hidden name has to depend on the key and only on it")
+	}
+
+	// Certificates are issued for the hidden name
+	content := randString(1000)
+	size := EncryptedSize(int64(len(content)))
+	if err := UploadFileWithOptions(ownIP, fname, content, genCert(t, hidden, size, WRITACT), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, replicaKeys, err := p.scanDataDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range append(append(keys, replicaKeys...), p.ring.Keys()...) {
+		if strings.Contains(k, "secret") {
+			t.Errorf("Node keeps %s", k)
+		}
+	}
+	if bytes.Contains(dump, []byte("secret")) {
+		t.Error("Node dump shows the name of the file")
+	}
+	if !p.ring.HasKey(getShardName(hidden, 0)) {
+		t.Error("File isn't under its hidden name")
+	}
+
+	// Client finds the file by its name
+	read := make([]byte, len(content))
+	if _, err := DownloadFileWithOptions(ownIP, fname, read, genCert(t, hidden, size, READACT), opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, content) {
+		t.Error("File under a hidden name doesn't match")
+	}
+
+	if err := UploadFileWithOptions(ownIP, fname, content, genCert(t, hidden, size, WRITACT), Options{HideName: true}); err == nil {
+		t.Error("Name was hidden without a key")
+	}
+
+	if err := DeleteFileWithOptions(ownIP, fname, genCert(t, hidden, size, DELEACT), opts); err != nil {
+		t.Fatal(err)
+	}
+	if p.ring.HasKey(getShardName(hidden, 0)) {
+		t.Error("Deleted file is still on the node")
+	}
+}
+
+// TestCompression checks that text shrinks on the ring and comes back the same, with and without a key
+func TestCompression(t *testing.T) {
+
+	p, ownIP := makeStoragePeer(t)
+	key, _ := NewKey([]byte("correct horse battery staple"))
+
+	// Text stripes shrink, the random one in the middle doesn't
+	noise := make([]byte, stripeSize)
+	crand.Read(noise)
+	content := bytes.Repeat([]byte("compressible text "), stripeSize/9)
+	content = append(content[:stripeSize], append(noise, content[stripeSize:]...)...)
+	size := EncryptedSize(int64(len(content)))
+
+	tests := []Options{
+		{Compress: CompressZstd},
+		{Compress: CompressS2},
+		{Compress: CompressZstd, Key: key},
+	}
+
+	for i, opts := range tests {
+		fname := fmt.Sprintf("compressed_test_file%d", i)
+		if err := UploadFileWithOptions(ownIP, fname, content, genCert(t, fname, size, WRITACT), opts); err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := ioutil.ReadFile(p.path(manifestName(fname)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := manifest{}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Compression != opts.Compress || len(m.Frames) != 3 || m.Frames[1] != 0 {
+			t.Errorf("%s: manifest says %s %v", opts.Compress, m.Compression, m.Frames)
+		}
+		if m.Stored >= int64(len(content))/2 {
+			t.Errorf("%s: stored %d bytes of %d", opts.Compress, m.Stored, len(content))
+		}
+
+		// Downloads decompress without being told to
+		read := make([]byte, len(content))
+		if _, err := DownloadFileWithOptions(ownIP, fname, read, genCert(t, fname, size, READACT), Options{Key: opts.Key}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(read, content) {
+			t.Errorf("%s: decompressed file doesn't match", opts.Compress)
+		}
+	}
+
+	// Nothing shrinks, nothing is recorded
+	fname := "incompressible_test_file"
+	if err := UploadFileWithOptions(ownIP, fname, noise, genCert(t, fname, size, WRITACT), Options{Compress: CompressS2}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := downloadManifest(ownIP, fname, genCert(t, fname, size, READACT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Compression != "" || m.Stored != int64(len(noise)) {
+		t.Errorf("Incompressible file was stored as %s with %d bytes", m.Compression, m.Stored)
+	}
+
+	if err := UploadFileWithOptions(ownIP, fname, content, genCert(t, fname, size, WRITACT), Options{Compress: "lzw"}); err == nil {
+		t.Error("Unknown compression was accepted")
+	}
+
+	// Frames that don't add up are refused
+	m = manifest{Size: 10, Compression: CompressS2, Frame: stripeSize, Frames: []int{0}}
+	if _, err := decompress(m, make([]byte, 20)); err == nil {
+		t.Error("Extra bytes after the last stripe were accepted")
+	}
+	m.Frames = []int{0, 0}
+	if _, err := decompress(m, make([]byte, 10)); err == nil {
+		t.Error("Too many frames were accepted")
+	}
+}
+
+// TestDedup checks that files share their blocks and blocks go away with the last file
+func TestDedup(t *testing.T) {
+
+	p, ownIP := makeStoragePeer(t)
+
+	claims := &FileClaim{Acts: []int8{READACT, WRITACT, DELEACT}, Scopes: []string{"artifact_*", blockDir}}
+	claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+	cert, err := signToken(SigningMethodEdDSA, testKey, "test", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Second artifact differs only in the last block
+	a := make([]byte, 2*blockSize+blockSize/2)
+	crand.Read(a)
+	b := append([]byte(nil), a...)
+	crand.Read(b[2*blockSize:])
+
+	blocks := func() (shards int, refs map[string]string) {
+		refs = make(map[string]string)
+		filepath.Walk(p.path(blockDir), func(fpath string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return nil
+			}
+			if isRefs(fpath) {
+				data, _ := ioutil.ReadFile(fpath)
+				refs[filepath.Base(strings.TrimSuffix(fpath, refsSuffix))] = string(data)
+			} else {
+				shards++
+			}
+			return nil
+		})
+		return shards, refs
+	}
+	hashOf := func(block []byte) string {
+		sum := sha256.Sum256(block)
+		return hex.EncodeToString(sum[:])
+	}
+	shared := getShardName(hashOf(a[:blockSize]), 0)
+
+	opts := Options{Dedup: true}
+	for fname, content := range map[string][]byte{"artifact_a": a, "artifact_b": b} {
+		if err := UploadFileWithOptions(ownIP, fname, content, cert, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Uploading the same file again changes nothing
+	if err := UploadFileWithOptions(ownIP, "artifact_b", b, cert, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	shards, refs := blocks()
+	if shards != 4*(dataRSC+parityRSC) {
+		t.Errorf("%d block shards are stored, want %d", shards, 4*(dataRSC+parityRSC))
+	}
+	if refs[shared] != "2" {
+		t.Errorf("Shared block is referred to %s times, want 2", refs[shared])
+	}
+	if _, err := os.Stat(p.path(getShardName("artifact_a", 0))); !os.IsNotExist(err) {
+		t.Error("Deduplicated file has shards of its own")
+	}
+
+	for fname, content := range map[string][]byte{"artifact_a": a, "artifact_b": b} {
+		read := make([]byte, len(content))
+		if _, err := DownloadFileWithOptions(ownIP, fname, read, cert, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(read, content) {
+			t.Errorf("%s doesn't match", fname)
+		}
+	}
+
+	// Blocks of the other file stay
+	if err := DeleteFileRSC(ownIP, "artifact_a", cert); err != nil {
+		t.Fatal(err)
+	}
+	shards, refs = blocks()
+	if shards != 3*(dataRSC+parityRSC) || refs[shared] != "1" {
+		t.Errorf("%d block shards are left, shared one has %s references", shards, refs[shared])
+	}
+	read := make([]byte, len(b))
+	if _, err := DownloadFileRSC(ownIP, "artifact_b", read, cert); err != nil || !bytes.Equal(read, b) {
+		t.Errorf("File sharing blocks with a deleted one is lost: %v", err)
+	}
+
+	if err := DeleteFileRSC(ownIP, "artifact_b", cert); err != nil {
+		t.Fatal(err)
+	}
+	if shards, refs = blocks(); shards != 0 || len(refs) != 0 {
+		t.Errorf("%d block shards and %d counts are left", shards, len(refs))
+	}
+
+	// Blocks are known only from the manifest, so the file isn't deleted without it
+	if err := UploadFileWithOptions(ownIP, "artifact_c", a, cert, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendFile(ownIP, manifestName("artifact_c"), []byte("damaged"), cert, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFileRSC(ownIP, "artifact_c", cert); err == nil {
+		t.Error("File with a damaged manifest was deleted")
+	}
+	if _, err := os.Stat(p.path(manifestName("artifact_c"))); err != nil {
+		t.Errorf("Manifest of a file that wasn't deleted is gone: %v", err)
+	}
+	os.Remove(p.path(manifestName("artifact_c")))
+
+	// Counts are for nodes only
+	if err := sendFile(ownIP, refsName(blockKey("", shared)), []byte("100"), cert, false); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Writing a count returned %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,118 @@
+// Mutual TLS between nodes and clients
+package peer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"storagePeer/src/dht"
+	"storagePeer/src/pool"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Calls of the storage service that only ring nodes make
+var nodeMethods = map[string]bool{
+	"/peer.PeerService/Handoff":       true,
+	"/peer.PeerService/HandoffOffset": true,
+	"/peer.PeerService/Replicate":     true,
+	"/peer.PeerService/DropReplica":   true,
+	"/peer.PeerService/Stats":         true,
+}
+
+// Clients only store files, everything about the ring is for the nodes
+func nodeOnly(method string) bool {
+	return strings.HasPrefix(method, "/dht.RingService/") || nodeMethods[method]
+}
+
+func unaryNodeOnly(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	if nodeOnly(info.FullMethod) {
+		if err := dht.VerifyNode(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+func streamNodeOnly(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	if nodeOnly(info.FullMethod) {
+		if err := dht.VerifyNode(ss.Context()); err != nil {
+			return err
+		}
+	}
+
+	return handler(srv, ss)
+}
+
+// loadTLS reads the CA bundle, certificate and key. Both sides show certificates signed by the CA,
+// clients check that the node's one is issued for the address they dialed.
+func loadTLS(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		ClientCAs:    roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// UseTLS makes all connections of the process to the nodes go over mutual TLS
+func UseTLS(caFile string, certFile string, keyFile string) error {
+
+	conf, err := loadTLS(caFile, certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	pool.Default.SetOptions(grpc.WithTransportCredentials(credentials.NewTLS(conf)))
+	return nil
+}
+
+// serverOptions sets up TLS of the node, connections to other nodes use the same certificate.
+// The certificate has to be issued to a ring node, with the dht.NodeUnit organizational unit.
+func serverOptions(cfg Config) ([]grpc.ServerOption, error) {
+
+	if cfg.Insecure {
+		return nil, nil
+	}
+
+	if cfg.CAFile == "" || cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("node needs a CA bundle, a certificate and a key")
+	}
+
+	conf, err := loadTLS(cfg.CAFile, cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool.Default.SetOptions(grpc.WithTransportCredentials(credentials.NewTLS(conf)))
+	return []grpc.ServerOption{
+		grpc.Creds(credentials.NewTLS(conf)),
+		grpc.UnaryInterceptor(unaryNodeOnly),
+		grpc.StreamInterceptor(streamNodeOnly),
+	}, nil
+}
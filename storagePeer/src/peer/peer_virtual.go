@@ -0,0 +1,75 @@
+// Several positions on the ring for one physical node, so the key ranges are more even
+package peer
+
+import (
+	"log"
+	"net"
+	"path/filepath"
+	"strconv"
+)
+
+// BytesPerVirtualNode is the disk capacity that gives a node one more position on the ring
+const BytesPerVirtualNode = 64 << 30
+
+// MaxVirtualNodes limits the number of positions of one node
+const MaxVirtualNodes = 32
+
+// Every position except the first one keeps its shards and state here
+const virtualDir = "vnodes"
+
+// virtualNodes returns the number of ring positions for the config
+func virtualNodes(cfg Config) int {
+
+	k := cfg.VirtualNodes
+	if k <= 0 {
+		// Weighted by capacity, a node with no capacity set gets one position
+		k = int((cfg.Capacity + BytesPerVirtualNode - 1) / BytesPerVirtualNode)
+	}
+
+	if k < 1 {
+		k = 1
+	}
+	if k > MaxVirtualNodes {
+		k = MaxVirtualNodes
+	}
+
+	return k
+}
+
+// shiftPort returns the same address with port increased by k
+func shiftPort(ip string, k int) string {
+
+	if k == 0 || ip == "" {
+		return ip
+	}
+
+	host, port, err := net.SplitHostPort(ip)
+	if err != nil {
+		log.Fatalf("virtual nodes need an address with a port: %v", err)
+	}
+
+	num, err := strconv.Atoi(port)
+	if err != nil {
+		log.Fatalf("virtual nodes need a numeric port: %v", err)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(num+k))
+}
+
+// virtualConfig returns the config of k'th position. Positions listen on the next ports
+// and join the ring through the first one.
+func virtualConfig(cfg Config, k int) Config {
+
+	if k == 0 {
+		return cfg
+	}
+
+	v := cfg
+	v.OwnIP = shiftPort(cfg.OwnIP, k)
+	v.ListeningIP = shiftPort(cfg.ListeningIP, k)
+	v.ExistingIP = cfg.OwnIP
+	v.DataDir = filepath.Join(cfg.DataDir, virtualDir, strconv.Itoa(k))
+	v.VirtualNodes = 1
+
+	return v
+}
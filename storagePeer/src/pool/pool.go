@@ -0,0 +1,180 @@
+// Shared gRPC connections between nodes, one per address
+package pool
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// DefaultIdle is how long an unused connection is kept open
+const DefaultIdle = time.Minute
+
+type entry struct {
+	conn     *grpc.ClientConn
+	refs     int
+	lastUsed time.Time
+	dropped  bool // Out of the pool, closed when the last user is done
+}
+
+// Pool keeps connections by address and counts who uses them
+type Pool struct {
+	mu    sync.Mutex
+	idle  time.Duration
+	opts  []grpc.DialOption
+	conns map[string]*entry
+	stop  chan struct{}
+}
+
+// Default is the pool of dht and peer packages
+var Default = New(DefaultIdle, grpc.WithInsecure())
+
+// New creates a pool, connections nobody used for idle are closed
+func New(idle time.Duration, opts ...grpc.DialOption) *Pool {
+
+	p := &Pool{
+		idle:  idle,
+		opts:  opts,
+		conns: make(map[string]*entry),
+		stop:  make(chan struct{}),
+	}
+	go p.evictRoutine()
+
+	return p
+}
+
+// Get returns a connection from the default pool
+func Get(addr string) (*grpc.ClientConn, func(), error) {
+	return Default.Get(addr)
+}
+
+// Get returns a connection to addr, dialing it if there is none. Release has to be called
+// when the caller is done with the connection, instead of closing it.
+func (p *Pool) Get(addr string) (*grpc.ClientConn, func(), error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.conns[addr]
+	if ok && !healthy(e.conn) {
+		// Node might be back on the same address, no need to wait for the backoff
+		p.drop(addr, e)
+		ok = false
+	}
+
+	if !ok {
+		conn, err := grpc.Dial(addr, p.opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		e = &entry{conn: conn}
+		p.conns[addr] = e
+	}
+
+	e.refs++
+	e.lastUsed = time.Now()
+
+	var once sync.Once
+	return e.conn, func() { once.Do(func() { p.release(e) }) }, nil
+}
+
+// SetOptions changes dial options of the new connections, open ones are closed once they are free
+func (p *Pool) SetOptions(opts ...grpc.DialOption) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.opts = opts
+	for addr, e := range p.conns {
+		p.drop(addr, e)
+	}
+}
+
+// Len returns the number of open connections in the pool
+func (p *Pool) Len() int {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.conns)
+}
+
+// Close closes all connections, the ones in use after their users release them
+func (p *Pool) Close() {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	close(p.stop)
+	for addr, e := range p.conns {
+		p.drop(addr, e)
+	}
+}
+
+func (p *Pool) release(e *entry) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.refs--
+	e.lastUsed = time.Now()
+	if e.dropped && e.refs == 0 {
+		e.conn.Close()
+	}
+}
+
+// drop takes the entry out of the pool, p.mu has to be held
+func (p *Pool) drop(addr string, e *entry) {
+
+	delete(p.conns, addr)
+	e.dropped = true
+	if e.refs == 0 {
+		e.conn.Close()
+	}
+}
+
+// Connections that failed are redialed rather than waited for
+func healthy(conn *grpc.ClientConn) bool {
+
+	switch conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	}
+
+	return true
+}
+
+////////
+// Eviction
+////////
+
+func (p *Pool) evictRoutine() {
+
+	ticker := time.NewTicker(p.idle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.evict()
+		}
+	}
+}
+
+// evict closes free connections that are idle for too long or broken
+func (p *Pool) evict() {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for addr, e := range p.conns {
+		if e.refs == 0 && (now.Sub(e.lastUsed) > p.idle || !healthy(e.conn)) {
+			p.drop(addr, e)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Nobody listens there
+const deadAddr = "127.0.0.1:1"
+
+func TestPool(t *testing.T) {
+
+	p := New(50*time.Millisecond, grpc.WithInsecure())
+	defer p.Close()
+
+	// Same address shares the connection
+	first, releaseFirst, err := p.Get(deadAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, releaseSecond, err := p.Get(deadAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || p.Len() != 1 {
+		t.Fatalf("Got %d connections for one address", p.Len())
+	}
+
+	// Connection in use isn't closed, releasing twice doesn't count
+	releaseFirst()
+	releaseFirst()
+	time.Sleep(150 * time.Millisecond)
+	if p.Len() != 1 || first.GetState() == connectivity.Shutdown {
+		t.Fatal("Connection in use was evicted")
+	}
+
+	// Broken connection is replaced, old one is closed by its last user
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for s := first.GetState(); s != connectivity.TransientFailure; s = first.GetState() {
+		if !first.WaitForStateChange(ctx, s) {
+			t.Fatalf("Connection to %s is still %s", deadAddr, s)
+		}
+	}
+
+	third, releaseThird, err := p.Get(deadAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first {
+		t.Error("Broken connection wasn't replaced")
+	}
+	if first.GetState() == connectivity.Shutdown {
+		t.Error("Connection was closed while in use")
+	}
+	releaseSecond()
+	if first.GetState() != connectivity.Shutdown {
+		t.Error("Dropped connection wasn't closed by its last user")
+	}
+
+	// Idle ones go away
+	releaseThird()
+	time.Sleep(150 * time.Millisecond)
+	if p.Len() != 0 || third.GetState() != connectivity.Shutdown {
+		t.Errorf("%d idle connections left", p.Len())
+	}
+}